@@ -0,0 +1,61 @@
+package agenttest_test
+
+import (
+	"context"
+	"fmt"
+	"reAct-agent/agent"
+	"reAct-agent/agent/agenttest"
+	"reAct-agent/chatmodel"
+	"reAct-agent/schema"
+	"reAct-agent/tool"
+)
+
+// An agent under test runs against a scripted model and a recording tool.
+func ExampleChatModel() {
+	ctx := context.Background()
+	model := agenttest.NewChatModel(
+		agenttest.ToolCall("weather", `{"city":"Paris"}`),
+		agenttest.Answer("Final Answer: sunny"),
+	)
+	weather := agenttest.NewTool("weather", map[string]string{"sky": "sunny"})
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{weather}})
+	if err != nil {
+		panic(err)
+	}
+
+	msg, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "weather in Paris?"}})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(msg.Content)
+	fmt.Println(weather.Calls())
+	// The second model call sees the tool result.
+	inputs := model.Inputs()
+	fmt.Println(inputs[1][len(inputs[1])-1].Content)
+	// Output:
+	// Final Answer: sunny
+	// [map[city:Paris]]
+	// {"sky":"sunny"}
+}
+
+// A chatmodel client under test talks to a scripted HTTP client instead of
+// the provider.
+func ExampleHTTPClient() {
+	httpClient := agenttest.NewHTTPClient(agenttest.Response{
+		Body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`,
+	})
+	client, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithHTTPClient(httpClient))
+	if err != nil {
+		panic(err)
+	}
+
+	msg, err := client.Generate(context.Background(), "qwen-test", []*schema.Message{{Role: schema.RoleUser, Content: "hello"}}, nil)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(msg.Content)
+	fmt.Println(len(httpClient.Requests()))
+	// Output:
+	// hi
+	// 1
+}
@@ -0,0 +1,123 @@
+package agenttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	httpclient "reAct-agent/http_client"
+	"sync"
+)
+
+// ErrNoMoreResponses is returned by an HTTPClient whose script is exhausted.
+var ErrNoMoreResponses = errors.New("agenttest: no more scripted responses")
+
+// Response is one scripted HTTP exchange. Send returns Body; SendStream sends
+// Chunks one by one, or Body as a single chunk when Chunks is empty. Err,
+// when set, fails the call instead.
+type Response struct {
+	StatusCode int
+	Body       string
+	Chunks     []string
+	Err        error
+}
+
+// Request is a call recorded by an HTTPClient. Body is the request body
+// encoded as JSON.
+type Request struct {
+	Method httpclient.HTTPMethod
+	Body   []byte
+}
+
+// HTTPClient is an httpclient.IHTTPClient answering from a queue of scripted
+// responses, e.g. to test a chatmodel client against canned provider
+// payloads. A zero StatusCode means 200. It is safe for concurrent use.
+type HTTPClient struct {
+	mu        sync.Mutex
+	responses []Response
+	requests  []Request
+}
+
+var _ httpclient.IHTTPClient = (*HTTPClient)(nil)
+
+// NewHTTPClient returns an HTTPClient answering with responses, in order.
+func NewHTTPClient(responses ...Response) *HTTPClient {
+	return &HTTPClient{responses: responses}
+}
+
+// Enqueue appends responses to the script.
+func (c *HTTPClient) Enqueue(responses ...Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responses = append(c.responses, responses...)
+}
+
+// Requests returns the calls made so far, in order.
+func (c *HTTPClient) Requests() []Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Request(nil), c.requests...)
+}
+
+func (c *HTTPClient) Send(ctx context.Context, method httpclient.HTTPMethod, body interface{}) (*httpclient.HTTPResponse, error) {
+	resp, err := c.next(ctx, method, body)
+	if err != nil {
+		return nil, err
+	}
+	return &httpclient.HTTPResponse{Body: []byte(resp.Body), StatusCode: resp.StatusCode}, nil
+}
+
+func (c *HTTPClient) SendStream(ctx context.Context, method httpclient.HTTPMethod, body interface{}) (httpclient.IOReader, httpclient.IOError) {
+	resp, err := c.next(ctx, method, body)
+	chunks := resp.Chunks
+	if len(chunks) == 0 {
+		chunks = []string{resp.Body}
+	}
+	out := make(chan httpclient.HTTPResponse, len(chunks))
+	errs := make(chan error, 1)
+	if err != nil {
+		errs <- err
+	} else {
+		for _, chunk := range chunks {
+			out <- httpclient.HTTPResponse{Body: []byte(chunk), StatusCode: resp.StatusCode}
+		}
+	}
+	close(out)
+	close(errs)
+	return out, errs
+}
+
+// next records a request and pops the next scripted response.
+func (c *HTTPClient) next(ctx context.Context, method httpclient.HTTPMethod, body interface{}) (Response, error) {
+	if err := ctx.Err(); err != nil {
+		return Response{}, err
+	}
+	var data []byte
+	switch v := body.(type) {
+	case nil:
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return Response{}, err
+		}
+		data = b
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, Request{Method: method, Body: data})
+	if len(c.responses) == 0 {
+		return Response{}, ErrNoMoreResponses
+	}
+	resp := c.responses[0]
+	c.responses = c.responses[1:]
+	if resp.Err != nil {
+		return Response{}, resp.Err
+	}
+	if resp.StatusCode == 0 {
+		resp.StatusCode = 200
+	}
+	return resp, nil
+}
@@ -0,0 +1,133 @@
+// Package agenttest provides test doubles for agents built on this module: a
+// scripted ChatModel, a recording Tool and a scripted IHTTPClient. None of
+// them touches the network or sleeps, so tests using them are fast and
+// deterministic.
+package agenttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reAct-agent/agent"
+	"reAct-agent/schema"
+	"reAct-agent/tool"
+	"sync"
+)
+
+// ErrNoMoreReplies is returned by a ChatModel whose script is exhausted.
+var ErrNoMoreReplies = errors.New("agenttest: no more scripted replies")
+
+// Reply is one scripted model step: Message is returned, or Err when set.
+type Reply struct {
+	Message *schema.Message
+	Err     error
+}
+
+// ChatModel is an agent.ChatModel answering calls from a queue of scripted
+// replies, in order, and recording the history of every call and the tools
+// bound to it. It is safe for concurrent use.
+type ChatModel struct {
+	mu      sync.Mutex
+	replies []Reply
+	inputs  [][]*schema.Message
+	tools   []*tool.ToolInfo
+}
+
+var _ agent.ChatModel = (*ChatModel)(nil)
+
+// NewChatModel returns a ChatModel answering with msgs, one per call.
+func NewChatModel(msgs ...*schema.Message) *ChatModel {
+	m := &ChatModel{}
+	for _, msg := range msgs {
+		m.replies = append(m.replies, Reply{Message: msg})
+	}
+	return m
+}
+
+// Enqueue appends replies to the script.
+func (m *ChatModel) Enqueue(replies ...Reply) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replies = append(m.replies, replies...)
+}
+
+// Generate records history and returns the next scripted reply.
+func (m *ChatModel) Generate(ctx context.Context, history []*schema.Message) (*schema.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inputs = append(m.inputs, append([]*schema.Message(nil), history...))
+	if len(m.replies) == 0 {
+		return nil, ErrNoMoreReplies
+	}
+	reply := m.replies[0]
+	m.replies = m.replies[1:]
+	if reply.Err != nil {
+		return nil, reply.Err
+	}
+	// 返回副本，避免调用方修改脚本中的消息
+	msg := *reply.Message
+	return &msg, nil
+}
+
+// Stream returns the next scripted reply as a single final message.
+func (m *ChatModel) Stream(ctx context.Context, history []*schema.Message) (<-chan *schema.Message, <-chan error) {
+	msgs := make(chan *schema.Message, 1)
+	errs := make(chan error, 1)
+	msg, err := m.Generate(ctx, history)
+	if err != nil {
+		errs <- err
+	} else {
+		msgs <- msg
+	}
+	close(msgs)
+	close(errs)
+	return msgs, errs
+}
+
+// BindTools records the tool infos.
+func (m *ChatModel) BindTools(ctx context.Context, infos []*tool.ToolInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tools = infos
+	return nil
+}
+
+// Inputs returns the history passed to every call so far, in call order.
+func (m *ChatModel) Inputs() [][]*schema.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][]*schema.Message(nil), m.inputs...)
+}
+
+// Tools returns the tool infos last bound to the model.
+func (m *ChatModel) Tools() []*tool.ToolInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tools
+}
+
+// Remaining reports how many scripted replies are left, e.g. to assert that
+// a run used all of them.
+func (m *ChatModel) Remaining() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.replies)
+}
+
+// Answer returns an assistant message with content, a final answer.
+func Answer(content string) *schema.Message {
+	return &schema.Message{Role: schema.RoleAssistant, Content: content}
+}
+
+// ToolCall returns an assistant message calling name with JSON arguments
+// args; the call ID is derived from name.
+func ToolCall(name, args string) *schema.Message {
+	return &schema.Message{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{
+		ID:       fmt.Sprintf("call_%s", name),
+		Type:     "function",
+		Function: schema.FunctionCall{Name: name, Arguments: args},
+	}}}
+}
@@ -0,0 +1,64 @@
+package agenttest_test
+
+import (
+	"context"
+	"errors"
+	"reAct-agent/agent"
+	"reAct-agent/agent/agenttest"
+	"reAct-agent/schema"
+	"reAct-agent/tool"
+	"testing"
+)
+
+func TestChatModelScriptAndErrors(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("boom")
+	model := agenttest.NewChatModel(agenttest.Answer("first"))
+	model.Enqueue(agenttest.Reply{Err: boom})
+
+	msg, err := model.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "a"}})
+	if err != nil || msg.Content != "first" {
+		t.Fatalf("Generate = %v, %v", msg, err)
+	}
+	msgs, errs := model.Stream(ctx, nil)
+	for range msgs {
+		t.Fatal("failed stream should emit no message")
+	}
+	if err := <-errs; !errors.Is(err, boom) {
+		t.Fatalf("expected the scripted error, got %v", err)
+	}
+	if _, err := model.Generate(ctx, nil); !errors.Is(err, agenttest.ErrNoMoreReplies) {
+		t.Fatalf("expected ErrNoMoreReplies, got %v", err)
+	}
+	if n := len(model.Inputs()); n != 3 || model.Remaining() != 0 {
+		t.Fatalf("recorded %d inputs, %d replies left", n, model.Remaining())
+	}
+}
+
+func TestStreamingAgentWithFakes(t *testing.T) {
+	ctx := context.Background()
+	model := agenttest.NewChatModel(agenttest.ToolCall("lookup", `{"id":1}`), agenttest.Answer("done"))
+	lookup := agenttest.NewTool("lookup", nil)
+	lookup.Func = func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		return map[string]interface{}{"id": args["id"], "found": true}, nil
+	}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{lookup}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if tools := model.Tools(); len(tools) != 1 || tools[0].Name != "lookup" {
+		t.Fatalf("tools should be bound to the model, got %v", tools)
+	}
+
+	msgs, errs := reactAgent.Stream(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "find 1"}})
+	var contents []string
+	for m := range msgs {
+		contents = append(contents, m.Content)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(lookup.Calls()) != 1 || contents[len(contents)-1] != "done" {
+		t.Fatalf("unexpected run: calls=%v contents=%q", lookup.Calls(), contents)
+	}
+}
@@ -0,0 +1,50 @@
+package agenttest
+
+import (
+	"context"
+	"reAct-agent/tool"
+	"sync"
+)
+
+// Tool is a tool.Tool returning a fixed result, or computing it with Func,
+// and recording the arguments of every call. It is safe for concurrent use.
+type Tool struct {
+	ToolInfo tool.ToolInfo
+	// Result and Err are returned by Execute unless Func is set.
+	Result interface{}
+	Err    error
+	// Func, when set, computes the result from the arguments.
+	Func func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+
+	mu    sync.Mutex
+	calls []map[string]interface{}
+}
+
+var _ tool.Tool = (*Tool)(nil)
+
+// NewTool returns a Tool named name that takes no declared parameters and
+// returns result.
+func NewTool(name string, result interface{}) *Tool {
+	return &Tool{ToolInfo: tool.ToolInfo{Name: name, Desc: "test tool " + name}, Result: result}
+}
+
+func (t *Tool) Info() tool.ToolInfo {
+	return t.ToolInfo
+}
+
+func (t *Tool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	t.mu.Lock()
+	t.calls = append(t.calls, params)
+	t.mu.Unlock()
+	if t.Func != nil {
+		return t.Func(ctx, params)
+	}
+	return t.Result, t.Err
+}
+
+// Calls returns the arguments of every call so far, in call order.
+func (t *Tool) Calls() []map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]map[string]interface{}(nil), t.calls...)
+}
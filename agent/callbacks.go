@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"reAct-agent/schema"
+	"reAct-agent/tool"
+)
+
+// CallbackInfo identifies the run and loop step a callback fires for.
+type CallbackInfo struct {
+	RunID string
+	Step  int
+}
+
+// Callbacks observes the agent loop. Every hook receives the run's
+// CallbackInfo so events from one run can be correlated. Nil hooks are
+// skipped.
+type Callbacks struct {
+	OnRunStart   func(ctx context.Context, info CallbackInfo, input []*schema.Message)
+	OnModelStart func(ctx context.Context, info CallbackInfo, history []*schema.Message)
+	OnModelEnd   func(ctx context.Context, info CallbackInfo, msg *schema.Message)
+	OnToolStart  func(ctx context.Context, info CallbackInfo, call schema.ToolCall)
+	OnToolEnd    func(ctx context.Context, info CallbackInfo, call schema.ToolCall, observation string)
+	OnError      func(ctx context.Context, info CallbackInfo, err error)
+	OnRunEnd     func(ctx context.Context, info CallbackInfo, output *schema.Message)
+
+	// OnUnknownTool fires when the model calls a tool that is not
+	// registered, typically a hallucinated name.
+	OnUnknownTool func(ctx context.Context, info CallbackInfo, call schema.ToolCall)
+}
+
+func (c *Callbacks) runStart(ctx context.Context, info CallbackInfo, input []*schema.Message) {
+	if c != nil && c.OnRunStart != nil {
+		c.OnRunStart(ctx, info, input)
+	}
+}
+
+func (c *Callbacks) modelStart(ctx context.Context, info CallbackInfo, history []*schema.Message) {
+	if c != nil && c.OnModelStart != nil {
+		c.OnModelStart(ctx, info, history)
+	}
+}
+
+func (c *Callbacks) modelEnd(ctx context.Context, info CallbackInfo, msg *schema.Message) {
+	if c != nil && c.OnModelEnd != nil {
+		c.OnModelEnd(ctx, info, msg)
+	}
+}
+
+func (c *Callbacks) toolStart(ctx context.Context, info CallbackInfo, call schema.ToolCall) {
+	if c != nil && c.OnToolStart != nil {
+		c.OnToolStart(ctx, info, call)
+	}
+}
+
+func (c *Callbacks) toolEnd(ctx context.Context, info CallbackInfo, call schema.ToolCall, observation string) {
+	if c != nil && c.OnToolEnd != nil {
+		c.OnToolEnd(ctx, info, call, observation)
+	}
+}
+
+func (c *Callbacks) unknownTool(ctx context.Context, info CallbackInfo, call schema.ToolCall) {
+	if c != nil && c.OnUnknownTool != nil {
+		c.OnUnknownTool(ctx, info, call)
+	}
+}
+
+func (c *Callbacks) error(ctx context.Context, info CallbackInfo, err error) {
+	if c != nil && c.OnError != nil {
+		c.OnError(ctx, info, err)
+	}
+}
+
+func (c *Callbacks) runEnd(ctx context.Context, info CallbackInfo, output *schema.Message) {
+	if c != nil && c.OnRunEnd != nil {
+		c.OnRunEnd(ctx, info, output)
+	}
+}
+
+// WithRunID returns a context carrying an existing run ID, e.g. one taken
+// from an incoming distributed trace. Generate and Stream reuse it instead of
+// generating a new one.
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return tool.WithRunID(ctx, runID)
+}
+
+// RunIDFromContext returns the run ID carried by ctx, or "". It is the same
+// value tools read with tool.RunIDFromContext.
+func RunIDFromContext(ctx context.Context) string {
+	return tool.RunIDFromContext(ctx)
+}
+
+// newRunID returns a random ID of the form "run_<24 hex chars>".
+func newRunID() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return "run_" + hex.EncodeToString(b[:])
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"reAct-agent/schema"
+	"strings"
+)
+
+// ErrEmptyResponse is returned with ReactAgentConfig.ErrorOnEmptyResponse
+// when the model keeps answering with empty messages.
+var ErrEmptyResponse = errors.New("model returned an empty response")
+
+// ErrDuplicateTool is returned by NewReactAgent when two tools in
+// ReactAgentConfig.Tools share a name.
+var ErrDuplicateTool = errors.New("duplicate tool name")
+
+// ErrInputTooLarge is returned when the input of a run exceeds
+// ReactAgentConfig.MaxInputBytes.
+var ErrInputTooLarge = errors.New("input too large")
+
+// checkInputSize rejects input whose content, summed over the messages,
+// exceeds max bytes; max <= 0 disables the check. The error names the largest
+// message, which is usually the mistake.
+func checkInputSize(input []*schema.Message, max int) error {
+	if max <= 0 {
+		return nil
+	}
+	total, largest, largestSize := 0, 0, 0
+	for i, msg := range input {
+		n := len(msg.Content) + len(msg.ReasoningContent)
+		for _, call := range msg.ToolCalls {
+			n += len(call.Function.Arguments)
+		}
+		total += n
+		if n > largestSize {
+			largest, largestSize = i, n
+		}
+	}
+	if total <= max {
+		return nil
+	}
+	return fmt.Errorf("%w: %d bytes exceed MaxInputBytes %d; largest is message %d (%s, %d bytes)",
+		ErrInputTooLarge, total, max, largest, input[largest].Role, largestSize)
+}
+
+// ErrContentFiltered is matched (via errors.Is) by a *ContentFilterError.
+var ErrContentFiltered = errors.New("content filtered")
+
+// ContentFilterError is returned when the provider ended a message with
+// schema.FinishContentFilter. The withheld or partial content is not treated
+// as an answer; Content keeps it for inspection.
+type ContentFilterError struct {
+	// Categories lists the moderation categories the provider flagged,
+	// when it reported any.
+	Categories []string
+	Content    string
+}
+
+func (e *ContentFilterError) Error() string {
+	if len(e.Categories) == 0 {
+		return ErrContentFiltered.Error()
+	}
+	return ErrContentFiltered.Error() + ": " + strings.Join(e.Categories, ", ")
+}
+
+func (e *ContentFilterError) Unwrap() error {
+	return ErrContentFiltered
+}
+
+// contentFiltered returns a *ContentFilterError for a filtered message.
+func contentFiltered(msg *schema.Message) error {
+	if msg.ResponseMeta == nil || msg.ResponseMeta.FinishReason != schema.FinishContentFilter {
+		return nil
+	}
+	return &ContentFilterError{Categories: msg.ResponseMeta.FilteredCategories, Content: msg.Content}
+}
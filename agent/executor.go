@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reAct-agent/tool"
+)
+
+// ErrToolNotFound is returned by a ToolExecutor asked to run a tool it does
+// not know. The agent answers such calls like calls to unregistered tools.
+var ErrToolNotFound = errors.New("tool not found")
+
+// ToolExecutor dispatches a tool call by name. Implementations may run tools
+// in process, over RPC or in a subprocess; *tool.Result return values are
+// unwrapped as they are for Tool.Execute.
+type ToolExecutor interface {
+	Execute(ctx context.Context, name string, args map[string]interface{}) (interface{}, error)
+}
+
+// ToolLookup is implemented by ToolExecutors that can tell up front whether
+// they serve a tool. The agent then treats unknown names as unregistered
+// before any callback fires; without it, it learns from ErrToolNotFound only
+// after OnToolStart.
+type ToolLookup interface {
+	HasTool(name string) bool
+}
+
+// LocalExecutor runs tools in process. It is the default ToolExecutor,
+// serving ReactAgentConfig.Tools. Tools are looked up in slice order, so if
+// names repeat the first one registered wins; NewReactAgent rejects such
+// configurations.
+type LocalExecutor []tool.Tool
+
+var (
+	_ ToolExecutor = LocalExecutor(nil)
+	_ ToolLookup   = LocalExecutor(nil)
+)
+
+// Execute runs the first tool named name, or fails with ErrToolNotFound.
+func (e LocalExecutor) Execute(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	if t := e.find(name); t != nil {
+		return t.Execute(ctx, args)
+	}
+	return nil, ErrToolNotFound
+}
+
+// HasTool reports whether a tool named name is registered.
+func (e LocalExecutor) HasTool(name string) bool {
+	return e.find(name) != nil
+}
+
+func (e LocalExecutor) find(name string) tool.Tool {
+	for _, t := range e {
+		if t.Info().Name == name {
+			return t
+		}
+	}
+	return nil
+}
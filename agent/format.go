@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reAct-agent/schema"
+	"reAct-agent/tool"
+	"strings"
+)
+
+// ReActFormat selects how a model that writes tool calls into its message
+// content is expected to format them. Native tool calls (schema.Message
+// ToolCalls) are executed in either format.
+type ReActFormat int
+
+const (
+	// FormatJSON reads tool calls as JSON objects such as
+	// {"tool":"calculator","arguments":{...}}, see ToolCallFields. With
+	// ContentToolCalls, an assistant message consisting of such an object
+	// for a registered tool is executed as a tool call. It is the default
+	// and adds no instructions to the system prompt, as models with native
+	// tool calling need none.
+	FormatJSON ReActFormat = iota
+	// FormatText reads the classic ReAct text format, which weak local
+	// models follow more reliably than JSON:
+	//
+	//	Thought: ...
+	//	Action: calculator
+	//	Action Input: {"expression":"2+2"}
+	//
+	// Observations are sent back as user messages starting with
+	// "Observation:", and a message containing "Final Answer:" ends the
+	// run. Without a SystemPrompt, ReActInstructions for the configured
+	// tools is used; it is rendered when a conversation starts, so it lists
+	// the tools configured at that time.
+	FormatText
+)
+
+// String returns "json" or "text".
+func (f ReActFormat) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatText:
+		return "text"
+	}
+	return fmt.Sprintf("ReActFormat(%d)", int(f))
+}
+
+// RenderToolsPrompt lists tools for a system prompt, one entry per tool with
+// its name, description and the JSON schema of its parameters.
+func RenderToolsPrompt(infos []*tool.ToolInfo) string {
+	var b strings.Builder
+	for _, info := range infos {
+		params, _ := json.Marshal(info.JSONSchema())
+		fmt.Fprintf(&b, "%s: %s\nParameters: %s\n\n", info.Name, info.Desc, params)
+	}
+	return b.String()
+}
+
+// ReActInstructions returns a system prompt that describes tools and asks
+// the model to call them in format, for models without native tool calling.
+func ReActInstructions(format ReActFormat, tools []*tool.ToolInfo) string {
+	var b strings.Builder
+	b.WriteString("Answer the question as best you can. You have access to the following tools:\n\n")
+	b.WriteString(RenderToolsPrompt(tools))
+	names := make([]string, len(tools))
+	for i, t := range tools {
+		names[i] = t.Name
+	}
+	if format == FormatText {
+		fmt.Fprintf(&b, `Use the following format:
+
+Thought: think about what to do next
+Action: the tool to use, one of [%s]
+Action Input: the tool arguments as a JSON object
+Observation: the result of the tool
+... (Thought/Action/Action Input/Observation can repeat)
+Thought: I now know the final answer
+Final Answer: the answer to the question
+
+Stop after Action Input and wait for the Observation.`, strings.Join(names, ", "))
+		return b.String()
+	}
+	b.WriteString(`To call a tool, reply with only a JSON object: {"tool": "<tool name>", "arguments": {<tool arguments>}}
+When you know the answer, reply with "Final Answer: " followed by the answer.`)
+	return b.String()
+}
+
+// systemPrompt returns the configured SystemPrompt or, for FormatText, the
+// default instructions for the current tools.
+func (r *ReactAgent) systemPrompt() string {
+	if r.conf.SystemPrompt != "" || r.conf.Format != FormatText {
+		return r.conf.SystemPrompt
+	}
+	infos := make([]*tool.ToolInfo, len(r.conf.Tools))
+	for i, t := range r.conf.Tools {
+		info := t.Info()
+		infos[i] = &info
+	}
+	return ReActInstructions(FormatText, infos)
+}
+
+// contentToolCall reads an assistant message whose whole content is a JSON
+// tool call, as FormatJSON instructions ask for. Only calls naming a tool the
+// agent can run are accepted, so a JSON answer such as {"name":"Alice"} is
+// not mistaken for one. Content over MaxToolArgsBytes is not parsed.
+func (r *ReactAgent) contentToolCall(content string) (schema.ToolCall, bool) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "{") || len(content) > r.conf.MaxToolArgsBytes {
+		return schema.ToolCall{}, false
+	}
+	parsed, ok := parseToolCall(content, r.conf.ToolCallFields)
+	if !ok || (LocalExecutor(r.conf.Tools).find(parsed.Name) == nil && r.conf.ToolExecutor == nil) {
+		return schema.ToolCall{}, false
+	}
+	args, _ := json.Marshal(parsed.Args)
+	if parsed.Args == nil {
+		args = []byte("{}")
+	}
+	return schema.ToolCall{ID: tool.NewCallID(), Type: "function", Function: schema.FunctionCall{Name: parsed.Name, Arguments: string(args)}}, true
+}
+
+// parseTextAction extracts the last Action / Action Input pair from content
+// in the ReAct text format. Anything from an "Observation:" the model made up
+// on its own is ignored, as are code fences around the input.
+func parseTextAction(content string) (name, input string, ok bool) {
+	const action, actionInput = "Action:", "Action Input:"
+	// 模型自行编造的 Observation 不可信，截断后再解析
+	if i := strings.Index(content, "\nObservation:"); i >= 0 {
+		content = content[:i]
+	}
+	i := strings.LastIndex(content, action)
+	if i < 0 {
+		return "", "", false
+	}
+	rest := content[i+len(action):]
+	line, after, _ := strings.Cut(rest, "\n")
+	name = strings.TrimSpace(line)
+	if name == "" {
+		return "", "", false
+	}
+	if j := strings.Index(after, actionInput); j >= 0 {
+		input = strings.TrimSpace(after[j+len(actionInput):])
+		input = strings.TrimPrefix(input, "```json")
+		input = strings.TrimPrefix(input, "```")
+		input = strings.TrimSpace(strings.TrimSuffix(input, "```"))
+	}
+	return name, input, true
+}
+
+// runTextAction executes a tool call written in FormatText and records the
+// observation as a user message, as text-format models expect.
+func (r *ReactAgent) runTextAction(ctx context.Context, info CallbackInfo, msg *schema.Message, name, input string) (*schema.Message, bool, error) {
+	r.state.append(msg)
+	call := schema.ToolCall{ID: tool.NewCallID(), Type: "function", Function: schema.FunctionCall{Name: name, Arguments: input}}
+	outcome := r.runToolCalls(ctx, info, []schema.ToolCall{call})[0]
+	giveUp := false
+	if !outcome.found {
+		giveUp = r.giveUpOnUnknownTool(ctx, info, call)
+		outcome.observation = r.unknownToolObservation(name)
+	}
+	r.state.append(&schema.Message{Role: schema.RoleUser, Content: "Observation: " + outcome.observation})
+	r.state.append(outcome.extra...)
+	if giveUp {
+		return &schema.Message{Role: schema.RoleAssistant, Content: fmt.Sprintf("tool '%s' not found", name)}, true, nil
+	}
+	if outcome.fatal != nil {
+		return nil, true, outcome.fatal
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,149 @@
+package agent_test
+
+import (
+	"context"
+	"reAct-agent/agent"
+	"reAct-agent/schema"
+	"reAct-agent/tool"
+	"strings"
+	"testing"
+)
+
+func TestTextFormatRunsTheLoop(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, Content: "Thought: I should add.\nAction: calculator\nAction Input: ```json\n{\"expression\":\"2+2\"}\n```\nObservation: 5"},
+		{Role: schema.RoleAssistant, Content: "Thought: I now know the final answer\nFinal Answer: 4"},
+	}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}, Format: agent.FormatText})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !strings.HasSuffix(res.Content, "Final Answer: 4") {
+		t.Fatalf("unexpected answer: %q", res.Content)
+	}
+
+	if len(calc.calls) != 1 || calc.calls[0]["expression"] != "2+2" {
+		t.Fatalf("expected one call with the parsed input, got %v", calc.calls)
+	}
+	system := model.history[0][0]
+	if system.Role != schema.RoleSystem || !strings.Contains(system.Content, "Action Input:") || !strings.Contains(system.Content, "calculator") {
+		t.Fatalf("expected text-format instructions as system prompt, got %+v", system)
+	}
+	// 工具结果以 Observation 文本的 user 消息反馈，而非模型编造的结果
+	obs := model.history[1][len(model.history[1])-1]
+	if obs.Role != schema.RoleUser || obs.Content != `Observation: {"ok":true}` {
+		t.Fatalf("unexpected observation message: %+v", obs)
+	}
+}
+
+func TestJSONFormatRunsTheLoop(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, Content: `{"tool":"calculator","arguments":{"expression":"2+2"}}`},
+		{Role: schema.RoleAssistant, Content: "Action: calculator\nAction Input: {}"},
+	}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}, ContentToolCalls: true})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if len(calc.calls) != 1 || calc.calls[0]["expression"] != "2+2" {
+		t.Fatalf("expected one call from the JSON payload, got %v", calc.calls)
+	}
+	if model.history[0][0].Role == schema.RoleSystem {
+		t.Fatal("FormatJSON should not add a system prompt")
+	}
+	// JSON 格式下文本 Action 不被解析，作为最终回答返回
+	if !strings.HasPrefix(res.Content, "Action: calculator") {
+		t.Fatalf("text action should be the final answer in FormatJSON, got %q", res.Content)
+	}
+}
+
+func TestJSONContentIsAnAnswerUnlessContentToolCalls(t *testing.T) {
+	ctx := context.Background()
+	payload := `{"tool":"calculator","arguments":{"expression":"2+2"}}`
+	model := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: payload}}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(calc.calls) != 0 || res.Content != payload {
+		t.Fatalf("JSON content should be the final answer by default, got %q and calls %v", res.Content, calc.calls)
+	}
+
+	// 超过 MaxToolArgsBytes 的内容不解析也不执行
+	model = &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: payload}}}
+	reactAgent, err = agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}, ContentToolCalls: true, MaxToolArgsBytes: len(payload) - 1})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(calc.calls) != 0 {
+		t.Fatalf("oversized content should not be executed, got %v", calc.calls)
+	}
+}
+
+func TestSetToolsRefreshesRenderedPrompt(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, Content: "Final Answer: hi"},
+		{Role: schema.RoleAssistant, Content: "Final Answer: hi again"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{&recordingTool{name: "search"}}, Format: agent.FormatText})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "hi"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if err := reactAgent.SetTools(ctx, []tool.Tool{&recordingTool{name: "weather"}}); err != nil {
+		t.Fatalf("SetTools failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "hi"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	system := model.history[1][0]
+	if !strings.Contains(system.Content, "Action: the tool to use, one of [weather]") {
+		t.Fatalf("system prompt should list the new tools:\n%s", system.Content)
+	}
+	if strings.Contains(model.history[0][0].Content, "weather") {
+		t.Fatal("the message sent earlier should not be modified")
+	}
+}
+
+func TestRenderToolsPromptListsEveryTool(t *testing.T) {
+	weather, err := tool.NewToolInfo("weather", "查询城市天气").
+		AddString("city", "城市名", true).
+		AddInteger("days", "预报天数", false).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	calc := (&tool.CalculatorTool{}).Info()
+
+	prompt := agent.RenderToolsPrompt([]*tool.ToolInfo{&weather, &calc})
+	for _, want := range []string{"weather", "查询城市天气", `"city"`, `"days"`, "calculator", calc.Desc, `"expression"`} {
+		if !strings.Contains(prompt, want) {
+			t.Fatalf("prompt should contain %q:\n%s", want, prompt)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reAct-agent/schema"
+	"strings"
+)
+
+// Memory rewrites the conversation history before every model call, e.g. to
+// keep it within the model's context window.
+type Memory interface {
+	Compact(ctx context.Context, messages []*schema.Message) ([]*schema.Message, error)
+}
+
+// Summarizer produces a summary message from a conversation; ChatModel
+// implementations satisfy it.
+type Summarizer interface {
+	Generate(ctx context.Context, history []*schema.Message) (*schema.Message, error)
+}
+
+// SummaryPrefix starts the content of every summary message produced by
+// SummarizingMemory, which lets later compactions fold it in again.
+const SummaryPrefix = "Summary of the earlier conversation:\n"
+
+const defaultSummaryPrompt = "Summarize the conversation above in a few sentences. " +
+	"Keep facts, decisions, tool results and open questions that later turns may rely on."
+
+// SummarizingMemoryConfig configures NewSummarizingMemory.
+type SummarizingMemoryConfig struct {
+	// Model generates the summaries. Required.
+	Model Summarizer
+	// Threshold is the estimated token count above which compaction runs.
+	// Required.
+	Threshold int
+	// K is the number of oldest messages collapsed per pass. Defaults to half
+	// of the collapsible messages, and at least two are collapsed.
+	K int
+	// Prompt is the instruction appended after the messages to summarize.
+	Prompt string
+	// Counter measures the size of a history, e.g. with the model's real
+	// tokenizer. Wrap counters that cannot fail with TokenCounterFunc.
+	// Defaults to HeuristicTokenCounter.
+	Counter TokenCounter
+}
+
+// SummarizingMemory replaces the oldest messages with a model-generated
+// summary (role system) once the history grows past a token threshold.
+// Leading system messages are kept verbatim, previous summaries are folded
+// into the next one, and a tool call is never separated from its results.
+// Passes repeat until the history fits or nothing more can be collapsed.
+type SummarizingMemory struct {
+	conf *SummarizingMemoryConfig
+}
+
+var _ Memory = (*SummarizingMemory)(nil)
+
+// NewSummarizingMemory constructs a SummarizingMemory.
+func NewSummarizingMemory(conf *SummarizingMemoryConfig) (*SummarizingMemory, error) {
+	if conf.Model == nil {
+		return nil, errors.New("summarization model is required")
+	}
+	if conf.Threshold <= 0 {
+		return nil, errors.New("threshold must be positive")
+	}
+	if conf.Prompt == "" {
+		conf.Prompt = defaultSummaryPrompt
+	}
+	if conf.Counter == nil {
+		conf.Counter = HeuristicTokenCounter{}
+	}
+	return &SummarizingMemory{conf: conf}, nil
+}
+
+// Compact summarizes old messages while the history exceeds the threshold.
+func (m *SummarizingMemory) Compact(ctx context.Context, messages []*schema.Message) ([]*schema.Message, error) {
+	for {
+		size, err := m.count(messages)
+		if err != nil {
+			return nil, err
+		}
+		if size <= m.conf.Threshold {
+			return messages, nil
+		}
+		// 保留开头的系统提示（之前的摘要除外）
+		head := 0
+		for head < len(messages) && messages[head].Role == schema.RoleSystem && !isSummary(messages[head]) {
+			head++
+		}
+		rest := messages[head:]
+		// 至少保留最后一条消息，避免把当前问题也摘要掉
+		if len(rest) < 2 {
+			return messages, nil
+		}
+
+		k := m.conf.K
+		if k <= 0 {
+			k = len(rest) / 2
+		}
+		// 把一条消息换成一条摘要没有收益，至少合并两条
+		if k < 2 {
+			k = 2
+		}
+		if k > len(rest)-1 {
+			k = len(rest) - 1
+		}
+		// 不拆分工具调用与其结果
+		for k < len(rest)-1 && rest[k].Role == schema.RoleTool {
+			k++
+		}
+		if k < 1 || rest[k].Role == schema.RoleTool {
+			return messages, nil
+		}
+
+		summary, err := m.summarize(ctx, rest[:k])
+		if err != nil {
+			return nil, err
+		}
+		compacted := make([]*schema.Message, 0, head+1+len(rest)-k)
+		compacted = append(compacted, messages[:head]...)
+		compacted = append(compacted, summary)
+		compacted = append(compacted, rest[k:]...)
+		compactedSize, err := m.count(compacted)
+		if err != nil {
+			return nil, err
+		}
+		if compactedSize >= size {
+			// 摘要没有缩短历史，停止以免无限循环
+			return compacted, nil
+		}
+		messages = compacted
+	}
+}
+
+func (m *SummarizingMemory) count(messages []*schema.Message) (int, error) {
+	n, err := m.conf.Counter.Count(messages)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count tokens: %w", err)
+	}
+	return n, nil
+}
+
+func (m *SummarizingMemory) summarize(ctx context.Context, old []*schema.Message) (*schema.Message, error) {
+	req := make([]*schema.Message, 0, len(old)+1)
+	req = append(req, old...)
+	req = append(req, &schema.Message{Role: schema.RoleUser, Content: m.conf.Prompt})
+	msg, err := m.conf.Model.Generate(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize history: %w", err)
+	}
+	if msg == nil {
+		return nil, errors.New("failed to summarize history: empty summary")
+	}
+	return &schema.Message{Role: schema.RoleSystem, Content: SummaryPrefix + strings.TrimSpace(msg.Content)}, nil
+}
+
+func isSummary(msg *schema.Message) bool {
+	return strings.HasPrefix(msg.Content, SummaryPrefix)
+}
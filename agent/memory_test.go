@@ -0,0 +1,118 @@
+package agent_test
+
+import (
+	"context"
+	"reAct-agent/agent"
+	"reAct-agent/schema"
+	"strings"
+	"testing"
+)
+
+// countMessages is a token counter that counts one token per message.
+func countMessages(messages []*schema.Message) int { return len(messages) }
+
+func TestSummarizingMemoryCollapsesOldestMessages(t *testing.T) {
+	summarizer := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "user asked about 1 and 2"}}}
+	mem, err := agent.NewSummarizingMemory(&agent.SummarizingMemoryConfig{
+		Model:     summarizer,
+		Threshold: 5,
+		K:         4,
+		Counter:   agent.TokenCounterFunc(countMessages),
+	})
+	if err != nil {
+		t.Fatalf("NewSummarizingMemory failed: %v", err)
+	}
+	history := []*schema.Message{
+		{Role: schema.RoleSystem, Content: "you are helpful"},
+		{Role: schema.RoleUser, Content: "q1"},
+		{Role: schema.RoleAssistant, Content: "a1"},
+		{Role: schema.RoleUser, Content: "q2"},
+		{Role: schema.RoleAssistant, Content: "a2"},
+		{Role: schema.RoleUser, Content: "q3"},
+	}
+
+	got, err := mem.Compact(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected system + summary + last message, got %d messages", len(got))
+	}
+	if got[0] != history[0] || got[2] != history[5] {
+		t.Fatal("system prompt and recent messages must be kept verbatim")
+	}
+	if got[1].Role != schema.RoleSystem || got[1].Content != agent.SummaryPrefix+"user asked about 1 and 2" {
+		t.Fatalf("unexpected summary message %+v", got[1])
+	}
+	// 摘要模型收到最旧的 K 条消息以及摘要指令
+	req := summarizer.history[0]
+	if len(req) != 5 || req[0].Content != "q1" || req[3].Content != "a2" || req[4].Role != schema.RoleUser {
+		t.Fatalf("unexpected summarization request %+v", req)
+	}
+}
+
+func TestSummarizingMemoryBelowThresholdIsNoop(t *testing.T) {
+	summarizer := &sequenceModel{}
+	mem, err := agent.NewSummarizingMemory(&agent.SummarizingMemoryConfig{Model: summarizer, Threshold: 10, Counter: agent.TokenCounterFunc(countMessages)})
+	if err != nil {
+		t.Fatalf("NewSummarizingMemory failed: %v", err)
+	}
+	history := []*schema.Message{{Role: schema.RoleUser, Content: "hi"}}
+	got, err := mem.Compact(context.Background(), history)
+	if err != nil || len(got) != 1 || len(summarizer.history) != 0 {
+		t.Fatalf("expected no compaction, got %v (err %v)", got, err)
+	}
+}
+
+func TestSummarizingMemoryKeepsToolResultsWithTheirCall(t *testing.T) {
+	summarizer := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "summary"}}}
+	mem, err := agent.NewSummarizingMemory(&agent.SummarizingMemoryConfig{Model: summarizer, Threshold: 3, K: 2, Counter: agent.TokenCounterFunc(countMessages)})
+	if err != nil {
+		t.Fatalf("NewSummarizingMemory failed: %v", err)
+	}
+	history := []*schema.Message{
+		{Role: schema.RoleUser, Content: "q1"},
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "a"}, {ID: "b"}}},
+		{Role: schema.RoleTool, Content: "ra", ToolCallID: "a"},
+		{Role: schema.RoleTool, Content: "rb", ToolCallID: "b"},
+		{Role: schema.RoleAssistant, Content: "a1"},
+	}
+	got, err := mem.Compact(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	for _, m := range got {
+		if m.Role == schema.RoleTool {
+			t.Fatalf("tool result left without its call: %+v", got)
+		}
+	}
+	if len(summarizer.history[0]) != 5 {
+		t.Fatalf("expected call and both results to be summarized together, got %d messages", len(summarizer.history[0]))
+	}
+}
+
+func TestAgentAppliesMemoryBeforeModelCall(t *testing.T) {
+	ctx := context.Background()
+	summarizer := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "old stuff"}}}
+	mem, err := agent.NewSummarizingMemory(&agent.SummarizingMemoryConfig{Model: summarizer, Threshold: 2, Counter: agent.TokenCounterFunc(countMessages)})
+	if err != nil {
+		t.Fatalf("NewSummarizingMemory failed: %v", err)
+	}
+	model := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "answer"}}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Memory: mem})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	_, err, _ = reactAgent.Generate(ctx, []*schema.Message{
+		{Role: schema.RoleUser, Content: "q1"},
+		{Role: schema.RoleAssistant, Content: "a1"},
+		{Role: schema.RoleUser, Content: "q2"},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	sent := model.history[0]
+	if len(sent) != 2 || !strings.HasPrefix(sent[0].Content, agent.SummaryPrefix) || sent[1].Content != "q2" {
+		t.Fatalf("model did not receive compacted history: %+v", sent)
+	}
+}
@@ -3,10 +3,15 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reAct-agent/logging"
+	"reAct-agent/metrics"
 	"reAct-agent/schema"
 	"reAct-agent/tool"
 	"strings"
+	"sync"
+	"time"
 )
 
 type ChatModel interface {
@@ -15,24 +20,216 @@ type ChatModel interface {
 	BindTools(ctx context.Context, infos []*tool.ToolInfo) error
 }
 
+// MessageModifer rewrites the messages sent with one model call. It must not
+// change the messages it is given; return copies instead.
 type MessageModifer func(ctx context.Context, msg []*schema.Message) []*schema.Message
 
 type ReactAgentConfig struct {
 	MaxStep int
 	Model   ChatModel
-	Tools   []tool.Tool
-	// MessageModifier MessageModifer
+	// Tools are dispatched by name; names must be unique, NewReactAgent
+	// fails with ErrDuplicateTool otherwise.
+	Tools []tool.Tool
+	// MaxInputBytes, when positive, rejects a Generate or Stream call whose
+	// input messages carry more content than this in total with
+	// ErrInputTooLarge, before anything is sent or recorded.
+	MaxInputBytes int
+	// MessageModifier, when set, rewrites the history sent with every model
+	// call, e.g. NewRedactor to scrub PII. The State keeps the originals.
+	MessageModifier MessageModifer
+
+	// ToolCallFields controls which JSON keys are read when a tool call is
+	// embedded in message content. Empty lists fall back to the defaults.
+	ToolCallFields ToolCallFieldConfig
+
+	// Format selects how tool calls written into message content are
+	// parsed, and the default system prompt for FormatText. The zero value
+	// is FormatJSON.
+	Format ReActFormat
+	// ContentToolCalls, under FormatJSON, executes an assistant message
+	// whose whole content is a JSON tool call for a registered tool, as
+	// ReActInstructions(FormatJSON, ...) asks models without native tool
+	// calling to reply. Off by default, so a final answer that happens to
+	// be JSON is returned as it is.
+	ContentToolCalls bool
+
+	// Callbacks observes model calls, tool executions and errors.
+	Callbacks *Callbacks
+
+	// Memory, when set, compacts the history before every model call.
+	Memory Memory
+
+	// Metrics counts tool executions. Nil reports nothing.
+	Metrics metrics.Metrics
+	// Logger receives the key events of a run: its start and end, each
+	// step and model call at debug level, tool executions, retries and
+	// errors. Nil logs nothing; see logging.WithMinLevel to filter.
+	Logger logging.Logger
+
+	// SystemPrompt, when set, starts every new conversation as a system
+	// message. LoadState re-injects it into dumps made without system
+	// messages.
+	SystemPrompt string
+	// CacheSystemPrompt sets schema.Message.CacheHint on the SystemPrompt
+	// message, so clients with prompt caching reuse it across calls.
+	CacheSystemPrompt bool
+
+	// MergeSystemMessages sends the system messages of the history, e.g.
+	// SystemPrompt and one supplied by the caller, as a single system
+	// message first, for providers that reject several. Their contents are
+	// joined with blank lines in order, skipping repeated ones. The State
+	// keeps the messages as they were.
+	MergeSystemMessages bool
+
+	// FewShot holds example turns sent with every model call, after the
+	// system messages and before the conversation, e.g. to show the
+	// expected tool use. They are never recorded in the State.
+	FewShot []*schema.Message
+
+	// MaxUnknownToolRetries is how many calls to unregistered tools a run
+	// answers with the list of available tools before giving up. Zero
+	// means 2; a negative value gives up on the first one.
+	MaxUnknownToolRetries int
+
+	// ToolCache, when set, serves repeated calls with the same tool name and
+	// arguments from cache instead of calling Execute again.
+	ToolCache tool.ToolCache
+
+	// ToolExecutor, when set, runs every tool call instead of Tools, e.g. on
+	// a remote tool server. Tools still provide the infos bound to the model
+	// and the argument validation for the names they cover; calls to other
+	// names are passed through, and ErrToolNotFound marks them unknown
+	// without recording tool stats or calling OnToolEnd. Implement ToolLookup
+	// to keep OnToolStart from firing for them too.
+	ToolExecutor ToolExecutor
+
+	// AutoContinueOnLength asks the model to continue answers truncated by
+	// the token limit (finish reason "length") and joins the parts, up to
+	// MaxContinuations times per step. Zero MaxContinuations means 3.
+	AutoContinueOnLength bool
+	MaxContinuations     int
+
+	// CoerceJSONStringArgs accepts object and array tool arguments sent as
+	// JSON strings, decoding them before validation and execution; see
+	// tool.WithJSONStringCoercion.
+	CoerceJSONStringArgs bool
+
+	// ResultPostProcessor, when set, transforms every tool result before it
+	// is serialized as the observation, e.g. to drop large fields the model
+	// does not need. It sees the Content of a *tool.Result, and cached
+	// results are stored unprocessed. Output of a tool.StreamingTool and
+	// tool errors bypass it.
+	ResultPostProcessor func(toolName string, result interface{}) interface{}
+
+	// IncludeReturnSchema sends the results of tools declaring a
+	// tool.ToolInfo.ReturnSchema as {"result":...,"result_schema":...},
+	// pairing the observation with the JSON Schema of its shape. Errors and
+	// results of other tools are sent as they are.
+	IncludeReturnSchema bool
+
+	// ParallelToolCalls runs the tool calls of one assistant turn
+	// concurrently. Results are still recorded in the order of the calls,
+	// each paired with its call ID. Tools, Callbacks, Metrics and the
+	// ToolCache must then be safe for concurrent use.
+	ParallelToolCalls bool
+
+	// ToolContext, when set, derives the context passed to every tool call,
+	// e.g. adding shared dependencies with tool.WithDependency.
+	ToolContext func(ctx context.Context) context.Context
+
+	// IsFinalAnswer reports whether a model message is the final answer.
+	// It takes precedence over tool calls: a final answer ends the run and
+	// its pending tool calls are dropped unexecuted. Nil means
+	// DefaultIsFinalAnswer.
+	IsFinalAnswer func(msg *schema.Message) bool
+
+	// NeedsUserInput, when set, reports whether the final message asks the
+	// user for more input, e.g. a clarifying question, rather than
+	// completing the task. The returned message then has
+	// schema.Message.NeedsUserInput set; Stream also emits it once more as
+	// a Final message carrying the flag. See ClarificationMarker.
+	NeedsUserInput func(msg *schema.Message) bool
+
+	// MaxStreamedObservationBytes caps the observation built from a
+	// tool.StreamingTool; elements beyond it are dropped and the result is
+	// marked truncated. Zero means 64KiB.
+	MaxStreamedObservationBytes int
+
+	// MaxToolArgsBytes caps the size of a tool call's arguments. A larger
+	// payload, e.g. from a runaway generation, is not parsed or executed;
+	// the model is told the arguments are too large instead. Zero means
+	// 1MiB.
+	MaxToolArgsBytes int
+
+	// ErrorOnEmptyResponse retries a model call that returned an assistant
+	// message with neither content nor tool calls, up to
+	// MaxEmptyResponseRetries times, then fails with ErrEmptyResponse.
+	// Zero MaxEmptyResponseRetries means 2; a negative value fails on the
+	// first empty message.
+	ErrorOnEmptyResponse    bool
+	MaxEmptyResponseRetries int
+
+	// StepDelay pauses between loop iterations, before every model call but
+	// the first, to pace requests to rate-limited providers. Cancelling the
+	// context interrupts the pause and ends the run with ctx.Err().
+	StepDelay time.Duration
+}
+
+// DefaultIsFinalAnswer recognizes the ReAct convention of a "Final Answer:"
+// line in the content.
+func DefaultIsFinalAnswer(msg *schema.Message) bool {
+	return strings.Contains(msg.Content, "Final Answer:")
+}
+
+// ClarificationMarker returns a NeedsUserInput check for prompts that ask the
+// model to start clarifying questions with marker, e.g. "Question:".
+func ClarificationMarker(marker string) func(msg *schema.Message) bool {
+	return func(msg *schema.Message) bool {
+		return strings.HasPrefix(strings.TrimSpace(msg.Content), marker)
+	}
+}
+
+// ToolCallFieldConfig lists candidate JSON field paths for the tool name and
+// its arguments, tried in order. Nested fields use dots, e.g. "function.name".
+type ToolCallFieldConfig struct {
+	NameFields []string
+	ArgsFields []string
+}
+
+// DefaultToolCallFieldConfig returns the fields recognized out of the box:
+// tool/name/function.name for the name and arguments/args/input for the
+// arguments.
+func DefaultToolCallFieldConfig() ToolCallFieldConfig {
+	return ToolCallFieldConfig{
+		NameFields: []string{"tool", "name", "function.name"},
+		ArgsFields: []string{"arguments", "args", "input"},
+	}
 }
 
 // State tracks the conversation history.
 type State struct {
+	// RunID identifies the most recent run; see Callbacks and WithRunID.
+	RunID string
+	// Stats summarizes the most recent run.
+	Stats RunStats
+
 	messages []*schema.Message
+	// seq is the highest Seq assigned so far.
+	seq int64
+	// unknownToolCalls counts calls to unregistered tools in the current run.
+	unknownToolCalls int
 }
 
 // ReactAgent wires ChatModel and Tool implementations per the UML diagram.
 type ReactAgent struct {
 	state *State
 	conf  *ReactAgentConfig
+	// statsMu guards the tool stats updated by parallel tool calls; see
+	// recordStats.
+	statsMu sync.Mutex
+	// toolsMu is held for reading by every run and for writing by SetTools,
+	// so a run sees one toolset from start to end.
+	toolsMu sync.RWMutex
 }
 
 type ReactAgentOption func(ra *ReactAgent)
@@ -43,17 +240,22 @@ func WithMaxStep(maxStep int) ReactAgentOption {
 	}
 }
 
+// WithToolContext sets ReactAgentConfig.ToolContext.
+func WithToolContext(fn func(ctx context.Context) context.Context) ReactAgentOption {
+	return func(ra *ReactAgent) {
+		ra.conf.ToolContext = fn
+	}
+}
+
 // NewReactAgent constructs an agent with a model and tools, binding tool infos.
 func NewReactAgent(ctx context.Context, conf *ReactAgentConfig, opts ...ReactAgentOption) (*ReactAgent, error) {
 	ra := &ReactAgent{state: &State{messages: make([]*schema.Message, 0)}, conf: conf}
 	for _, opt := range opts {
 		opt(ra)
 	}
-	var infos []*tool.ToolInfo
-	for _, t := range conf.Tools {
-		info := t.Info()
-		i := info
-		infos = append(infos, &i)
+	infos, err := toolInfos(conf.Tools)
+	if err != nil {
+		return nil, err
 	}
 	if ra.conf.Model != nil {
 		ra.conf.Model.BindTools(ctx, infos)
@@ -61,115 +263,931 @@ func NewReactAgent(ctx context.Context, conf *ReactAgentConfig, opts ...ReactAge
 	if ra.conf.MaxStep == 0 {
 		ra.conf.MaxStep = 8
 	}
+	if ra.conf.AutoContinueOnLength && ra.conf.MaxContinuations == 0 {
+		ra.conf.MaxContinuations = 3
+	}
+	if ra.conf.MaxStreamedObservationBytes == 0 {
+		ra.conf.MaxStreamedObservationBytes = 64 << 10
+	}
+	if ra.conf.MaxToolArgsBytes == 0 {
+		ra.conf.MaxToolArgsBytes = 1 << 20
+	}
+	if ra.conf.IsFinalAnswer == nil {
+		ra.conf.IsFinalAnswer = DefaultIsFinalAnswer
+	}
+	if ra.conf.MaxUnknownToolRetries == 0 {
+		ra.conf.MaxUnknownToolRetries = 2
+	}
+	if ra.conf.ErrorOnEmptyResponse && ra.conf.MaxEmptyResponseRetries == 0 {
+		ra.conf.MaxEmptyResponseRetries = 2
+	}
+	defaults := DefaultToolCallFieldConfig()
+	if len(ra.conf.ToolCallFields.NameFields) == 0 {
+		ra.conf.ToolCallFields.NameFields = defaults.NameFields
+	}
+	if len(ra.conf.ToolCallFields.ArgsFields) == 0 {
+		ra.conf.ToolCallFields.ArgsFields = defaults.ArgsFields
+	}
 	return ra, nil
 }
 
+// toolInfos validates tools and returns their infos; names must be unique.
+func toolInfos(tools []tool.Tool) ([]*tool.ToolInfo, error) {
+	var infos []*tool.ToolInfo
+	seen := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		info := t.Info()
+		if err := info.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid tool: %w", err)
+		}
+		if seen[info.Name] {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateTool, info.Name)
+		}
+		seen[info.Name] = true
+		i := info
+		infos = append(infos, &i)
+	}
+	return infos, nil
+}
+
+// SetTools replaces the agent's tools, e.g. when the user's permissions
+// change, validating them like NewReactAgent and binding them to the Model.
+// The conversation is kept; a system prompt rendered from the tools (see
+// FormatText) is updated to list the new ones. SetTools waits for running
+// Generate and Stream calls to finish, so it must not be called from a tool
+// or callback of the same agent. On error the tools are left unchanged.
+func (r *ReactAgent) SetTools(ctx context.Context, tools []tool.Tool) error {
+	infos, err := toolInfos(tools)
+	if err != nil {
+		return err
+	}
+	r.toolsMu.Lock()
+	defer r.toolsMu.Unlock()
+	if r.conf.Model != nil {
+		if err := r.conf.Model.BindTools(ctx, infos); err != nil {
+			return fmt.Errorf("failed to bind tools: %w", err)
+		}
+	}
+	before := r.systemPrompt()
+	r.conf.Tools = tools
+	// 由工具生成的系统提示词随工具更新；复制消息以免修改调用方持有的对象
+	if after := r.systemPrompt(); after != before && len(r.state.messages) > 0 {
+		if first := r.state.messages[0]; first.Role == schema.RoleSystem && first.Content == before {
+			m := *first
+			m.Content = after
+			r.state.messages[0] = &m
+		}
+	}
+	return nil
+}
+
 // Generate delegates to the underlying ChatModel.
 func (r *ReactAgent) Generate(ctx context.Context, history []*schema.Message) (*schema.Message, error, *State) {
 	if r.conf.Model == nil {
 		return &schema.Message{Role: schema.RoleAssistant, Content: "model not initialized"}, nil, nil
 	}
+	if err := checkInputSize(history, r.conf.MaxInputBytes); err != nil {
+		return &schema.Message{Role: schema.RoleAssistant, Content: err.Error()}, err, r.state
+	}
+	r.toolsMu.RLock()
+	defer r.toolsMu.RUnlock()
+	ctx, info := r.startRun(ctx, history)
+	defer r.finishStats(time.Now())
 	// 将用户输入加入 State
-	r.state.messages = append(r.state.messages, history...)
+	r.appendInput(history)
 
 	for step := 0; step < r.conf.MaxStep; step++ {
+		info.Step = step
+		if err := r.pause(ctx, step); err != nil {
+			return &schema.Message{Role: schema.RoleAssistant, Content: err.Error()}, err, r.state
+		}
+		if err := r.compactHistory(ctx, info); err != nil {
+			return &schema.Message{Role: schema.RoleAssistant, Content: err.Error()}, err, r.state
+		}
 		// 交给 chatmodel 生成下一条消息
-		msg, err := r.conf.Model.Generate(ctx, r.state.messages)
+		r.log().Debug("step start", "run_id", info.RunID, "step", step)
+		r.conf.Callbacks.modelStart(ctx, info, r.state.messages)
+		msg, err := r.callModel(r.state.messages, func(history []*schema.Message) (*schema.Message, error) {
+			return r.conf.Model.Generate(ctx, r.modelInput(ctx, history))
+		})
 		if err != nil {
-			return &schema.Message{Role: schema.RoleAssistant, Content: err.Error()}, err, nil
+			r.fail(ctx, info, err)
+			return &schema.Message{Role: schema.RoleAssistant, Content: err.Error()}, err, r.state
 		}
 		if msg == nil {
-			return &schema.Message{Role: schema.RoleAssistant, Content: "empty message returned"}, nil, nil
+			return r.endRun(ctx, info, &schema.Message{Role: schema.RoleAssistant, Content: "empty message returned"}), nil, r.state
+		}
+		r.conf.Callbacks.modelEnd(ctx, info, msg)
+		// 被内容审核拦截的回复不作为答案
+		if err := contentFiltered(msg); err != nil {
+			r.fail(ctx, info, err)
+			return &schema.Message{Role: schema.RoleAssistant, Content: err.Error()}, err, r.state
 		}
 
-		// 如果是工具调用请求（role 为 Tool），执行工具
-		if msg.Role == schema.RoleTool {
-			// 记录模型的工具调用请求
-			r.state.messages = append(r.state.messages, msg)
+		final, done, err := r.handleMessage(ctx, info, msg)
+		if err != nil {
+			r.fail(ctx, info, err)
+			return &schema.Message{Role: schema.RoleAssistant, Content: err.Error()}, err, r.state
+		}
+		if done {
+			return r.endRun(ctx, info, final), nil, r.state
+		}
+	}
 
-			// 从内容解析工具名与参数
-			call, ok := parseToolCall(msg.Content)
-			if !ok || call.Name == "" {
-				return &schema.Message{Role: schema.RoleAssistant, Content: "invalid tool call payload"}, nil, nil
-			}
+	return r.endRun(ctx, info, &schema.Message{Role: schema.RoleAssistant, Content: "max steps reached"}), nil, r.state
+}
+
+// Ask is Generate for a single question: it sends question as a user
+// message, continuing the agent's conversation, and returns the answer.
+func (r *ReactAgent) Ask(ctx context.Context, question string) (*schema.Message, error) {
+	msg, err, _ := r.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: question}})
+	return msg, err
+}
+
+// startRun assigns the run ID (reusing one carried by ctx) and fires
+// OnRunStart. The returned context carries the run ID for downstream calls.
+func (r *ReactAgent) startRun(ctx context.Context, input []*schema.Message) (context.Context, CallbackInfo) {
+	runID := RunIDFromContext(ctx)
+	if runID == "" {
+		runID = newRunID()
+		ctx = WithRunID(ctx, runID)
+	}
+	r.state.RunID = runID
+	r.state.unknownToolCalls = 0
+	r.state.Stats = RunStats{}
+	info := CallbackInfo{RunID: runID}
+	r.log().Info("run start", "run_id", runID, "messages", len(input))
+	r.conf.Callbacks.runStart(ctx, info, input)
+	return ctx, info
+}
+
+// appendInput adds the run's input to the State, starting a new conversation
+// with the configured system prompt.
+func (r *ReactAgent) appendInput(history []*schema.Message) {
+	if len(r.state.messages) == 0 {
+		if system := r.systemMessage(); system.Content != "" {
+			r.state.append(system)
+		}
+	}
+	r.state.append(history...)
+}
+
+func (r *ReactAgent) systemMessage() *schema.Message {
+	return &schema.Message{Role: schema.RoleSystem, Content: r.systemPrompt(), CacheHint: r.conf.CacheSystemPrompt}
+}
+
+// pause waits StepDelay before every step but the first.
+func (r *ReactAgent) pause(ctx context.Context, step int) error {
+	if step == 0 || r.conf.StepDelay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(r.conf.StepDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// compactHistory lets the configured Memory rewrite the history before the
+// next model call.
+func (r *ReactAgent) compactHistory(ctx context.Context, info CallbackInfo) error {
+	if r.conf.Memory == nil {
+		return nil
+	}
+	msgs, err := r.conf.Memory.Compact(ctx, r.state.messages)
+	if err != nil {
+		r.fail(ctx, info, err)
+		return err
+	}
+	r.state.messages = msgs
+	return nil
+}
+
+// modelInput builds the history sent with one model call: system messages
+// are merged when configured, the FewShot examples go after the leading
+// system messages, then the MessageModifier rewrites the result.
+func (r *ReactAgent) modelInput(ctx context.Context, history []*schema.Message) []*schema.Message {
+	if r.conf.MergeSystemMessages {
+		history = mergeSystemMessages(history)
+	}
+	if len(r.conf.FewShot) > 0 {
+		n := 0
+		for n < len(history) && history[n].Role == schema.RoleSystem {
+			n++
+		}
+		input := make([]*schema.Message, 0, len(history)+len(r.conf.FewShot))
+		input = append(input, history[:n]...)
+		input = append(input, r.conf.FewShot...)
+		history = append(input, history[n:]...)
+	}
+	if r.conf.MessageModifier == nil {
+		return history
+	}
+	return r.conf.MessageModifier(ctx, history)
+}
+
+// mergeSystemMessages moves the system messages to a single one at the start
+// of the history, joining distinct contents with blank lines. A history with
+// at most one system message, already first, is returned as it is.
+func mergeSystemMessages(history []*schema.Message) []*schema.Message {
+	var (
+		contents []string
+		seen     = make(map[string]bool)
+		rest     = make([]*schema.Message, 0, len(history))
+		count    int
+		hint     bool
+	)
+	for _, msg := range history {
+		if msg.Role != schema.RoleSystem {
+			rest = append(rest, msg)
+			continue
+		}
+		count++
+		hint = hint || msg.CacheHint
+		if !seen[msg.Content] {
+			seen[msg.Content] = true
+			contents = append(contents, msg.Content)
+		}
+	}
+	if count == 0 || count == 1 && history[0].Role == schema.RoleSystem {
+		return history
+	}
+	merged := &schema.Message{Role: schema.RoleSystem, Content: strings.Join(contents, "\n\n"), CacheHint: hint}
+	return append([]*schema.Message{merged}, rest...)
+}
 
-			// 匹配工具
-			var selected tool.Tool
-			for _, t := range r.conf.Tools {
-				if t.Info().Name == call.Name {
-					selected = t
-					break
+// finishStats records the run's duration; Generate and Stream defer it.
+func (r *ReactAgent) finishStats(start time.Time) {
+	r.state.Stats.Duration = time.Since(start)
+}
+
+// endRun fires OnRunEnd and returns the output unchanged.
+func (r *ReactAgent) endRun(ctx context.Context, info CallbackInfo, output *schema.Message) *schema.Message {
+	r.log().Info("run end", "run_id", info.RunID, "steps", info.Step+1)
+	r.conf.Callbacks.runEnd(ctx, info, output)
+	return output
+}
+
+// handleMessage records a model message in the State and executes any tool
+// call it requests. It reports done together with the message to return when
+// the run should stop; otherwise the loop asks the model for the next step.
+// A message carrying ToolCalls continues, even when it also has content,
+// unless IsFinalAnswer recognizes it; otherwise only an assistant message
+// without tool calls ends the run. A tool returning a tool.FatalError ends it
+// with that error once the results of the turn are recorded.
+func (r *ReactAgent) handleMessage(ctx context.Context, info CallbackInfo, msg *schema.Message) (*schema.Message, bool, error) {
+	// 模型已给出最终答案时不再执行尚未执行的工具调用；去掉调用以免历史中出现没有结果的 tool_calls
+	if len(msg.ToolCalls) > 0 && r.conf.IsFinalAnswer(msg) {
+		msg.ToolCalls = nil
+		r.markNeedsUserInput(msg)
+		r.state.append(msg)
+		return msg, true, nil
+	}
+
+	// 开启 ContentToolCalls 时，JSON 格式下 assistant 的内容本身可能就是工具调用，转为结构化调用执行；最终答案除外
+	if r.conf.Format == FormatJSON && r.conf.ContentToolCalls && msg.Role == schema.RoleAssistant && len(msg.ToolCalls) == 0 && !r.conf.IsFinalAnswer(msg) {
+		if call, ok := r.contentToolCall(msg.Content); ok {
+			msg.ToolCalls = []schema.ToolCall{call}
+		}
+	}
+
+	// 结构化工具调用：即使 content 为空，也要执行工具
+	if len(msg.ToolCalls) > 0 {
+		// 为缺少 ID 的调用补齐 ID，保证调用与结果一一对应
+		for i := range msg.ToolCalls {
+			if msg.ToolCalls[i].ID == "" {
+				msg.ToolCalls[i].ID = tool.NewCallID()
+			}
+		}
+		r.state.append(msg)
+		outcomes := r.runToolCalls(ctx, info, msg.ToolCalls)
+		// 按 tool_calls 的顺序追加结果；额外消息在所有工具结果之后追加，避免打断调用与结果的对应关系
+		var (
+			extras []*schema.Message
+			fatal  error
+			// 放弃时报告的第一个未知工具；在所有调用都有结果后再结束，避免历史中出现没有结果的 tool_calls
+			givenUp string
+		)
+		for i, call := range msg.ToolCalls {
+			outcome := outcomes[i]
+			if fatal == nil {
+				fatal = outcome.fatal
+			}
+			if !outcome.found {
+				if r.giveUpOnUnknownTool(ctx, info, call) && givenUp == "" {
+					givenUp = call.Function.Name
 				}
+				outcome.observation = r.unknownToolObservation(call.Function.Name)
 			}
-			if selected == nil {
-				return &schema.Message{Role: schema.RoleAssistant, Content: fmt.Sprintf("tool '%s' not found", call.Name)}, nil, nil
+			r.state.append(&schema.Message{Role: schema.RoleTool, Content: outcome.observation, ToolCallID: call.ID})
+			extras = append(extras, outcome.extra...)
+		}
+		r.state.append(extras...)
+		if givenUp != "" {
+			return &schema.Message{Role: schema.RoleAssistant, Content: fmt.Sprintf("tool '%s' not found", givenUp)}, true, nil
+		}
+		// 致命错误不再交给模型重试，记录结果后结束运行
+		if fatal != nil {
+			return nil, true, fatal
+		}
+
+		// 继续循环，让 chatmodel 根据工具结果决定下一步
+		return nil, false, nil
+	}
+
+	// 如果是工具调用请求（role 为 Tool），执行工具
+	if msg.Role == schema.RoleTool {
+		// 文本格式的调用没有 ID，生成一个用于关联调用与结果
+		if msg.ToolCallID == "" {
+			msg.ToolCallID = tool.NewCallID()
+		}
+		// 记录模型的工具调用请求
+		r.state.append(msg)
+
+		// 内容过大时同样不解析也不执行
+		if size := len(msg.Content); size > r.conf.MaxToolArgsBytes {
+			r.state.append(&schema.Message{Role: schema.RoleTool, Content: r.argsTooLargeObservation(size), ToolCallID: msg.ToolCallID})
+			return nil, false, nil
+		}
+
+		// 从内容解析工具名与参数
+		parseStart := time.Now()
+		call, ok := parseToolCall(msg.Content, r.conf.ToolCallFields)
+		r.recordStats(func(s *RunStats) { s.ParseTime += time.Since(parseStart) })
+		if !ok || call.Name == "" {
+			return &schema.Message{Role: schema.RoleAssistant, Content: "invalid tool call payload"}, true, nil
+		}
+
+		// 匹配工具
+		argsJSON, _ := json.Marshal(call.Args)
+		toolCall := schema.ToolCall{ID: msg.ToolCallID, Type: "function", Function: schema.FunctionCall{Name: call.Name, Arguments: string(argsJSON)}}
+		// 执行工具
+		outcome := r.runTool(ctx, info, toolCall, call.Args)
+		if !outcome.found {
+			giveUp := r.giveUpOnUnknownTool(ctx, info, toolCall)
+			r.state.append(&schema.Message{Role: schema.RoleTool, Content: r.unknownToolObservation(call.Name), ToolCallID: msg.ToolCallID})
+			if giveUp {
+				return &schema.Message{Role: schema.RoleAssistant, Content: fmt.Sprintf("tool '%s' not found", call.Name)}, true, nil
 			}
+			return nil, false, nil
+		}
+
+		// 将工具结果加入 State（role 仍为 Tool，内容为结果）
+		r.state.append(&schema.Message{Role: schema.RoleTool, Content: outcome.observation, ToolCallID: msg.ToolCallID})
+		r.state.append(outcome.extra...)
+		if outcome.fatal != nil {
+			return nil, true, outcome.fatal
+		}
+
+		// 继续循环，让 chatmodel 根据工具结果决定下一步
+		return nil, false, nil
+	}
+
+	// 文本格式下 assistant 内容中的 Action 即工具调用，已给出最终答案时除外
+	if msg.Role == schema.RoleAssistant && r.conf.Format == FormatText && !r.conf.IsFinalAnswer(msg) {
+		if name, input, ok := parseTextAction(msg.Content); ok {
+			return r.runTextAction(ctx, info, msg, name, input)
+		}
+	}
+
+	// 如果是 assistant，退出循环并返回
+	if msg.Role == schema.RoleAssistant {
+		r.markNeedsUserInput(msg)
+		r.state.append(msg)
+		return msg, true, nil
+	}
+
+	// 其他角色（如 user/system），加入 State 并继续
+	r.state.append(msg)
+	return nil, false, nil
+}
+
+// markNeedsUserInput tags a final message that asks the user for input.
+func (r *ReactAgent) markNeedsUserInput(msg *schema.Message) {
+	if r.conf.NeedsUserInput != nil && r.conf.NeedsUserInput(msg) {
+		msg.NeedsUserInput = true
+	}
+}
+
+// Stream runs the same loop as Generate but consumes the model's streaming
+// API. Every model delta is forwarded as it arrives; the deltas of a step are
+// assembled with schema.MessageAccumulator to detect tool calls, and the
+// resulting tool messages are emitted before the next step starts.
+func (r *ReactAgent) Stream(ctx context.Context, history []*schema.Message) (<-chan *schema.Message, <-chan error) {
+	out := make(chan *schema.Message, 10)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errs)
 
-			// 执行工具
-			result, execErr := selected.Execute(ctx, call.Args)
-			var toolContent string
-			if execErr != nil {
-				toolContent = fmt.Sprintf("{\"error\":\"%s\"}", escapeString(execErr.Error()))
-			} else {
-				if b, mErr := json.Marshal(result); mErr == nil {
-					toolContent = string(b)
-				} else {
-					toolContent = fmt.Sprintf("{\"result\":\"%v\"}", result)
+		emit := func(msg *schema.Message) bool {
+			select {
+			case out <- msg:
+				return true
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return false
+			}
+		}
+
+		if r.conf.Model == nil {
+			emit(&schema.Message{Role: schema.RoleAssistant, Content: "model not initialized"})
+			return
+		}
+		if err := checkInputSize(history, r.conf.MaxInputBytes); err != nil {
+			errs <- err
+			return
+		}
+		r.toolsMu.RLock()
+		defer r.toolsMu.RUnlock()
+		ctx, info := r.startRun(ctx, history)
+		defer r.finishStats(time.Now())
+		r.appendInput(history)
+
+		for step := 0; step < r.conf.MaxStep; step++ {
+			info.Step = step
+			if err := r.pause(ctx, step); err != nil {
+				errs <- err
+				return
+			}
+			if err := r.compactHistory(ctx, info); err != nil {
+				errs <- err
+				return
+			}
+			r.log().Debug("step start", "run_id", info.RunID, "step", step)
+			r.conf.Callbacks.modelStart(ctx, info, r.state.messages)
+			msg, err := r.callModel(r.state.messages, func(history []*schema.Message) (*schema.Message, error) {
+				return r.streamModel(ctx, r.modelInput(ctx, history), emit)
+			})
+			if errors.Is(err, errStreamStopped) {
+				return
+			}
+			if err != nil {
+				r.fail(ctx, info, err)
+				errs <- err
+				return
+			}
+			if msg == nil {
+				emit(r.endRun(ctx, info, &schema.Message{Role: schema.RoleAssistant, Content: "empty message returned"}))
+				return
+			}
+
+			r.conf.Callbacks.modelEnd(ctx, info, msg)
+			if err := contentFiltered(msg); err != nil {
+				r.fail(ctx, info, err)
+				errs <- err
+				return
+			}
+			before := len(r.state.messages)
+			final, done, err := r.handleMessage(ctx, info, msg)
+			if err != nil {
+				r.fail(ctx, info, err)
+				errs <- err
+				return
+			}
+			if done {
+				r.endRun(ctx, info, final)
+				// 模型本身的最终回答已经以增量形式发出；需要用户输入时再发出带标记的完整消息
+				if final != msg {
+					emit(final)
+				} else if final.NeedsUserInput {
+					m := *final
+					m.Final = true
+					emit(&m)
+				}
+				return
+			}
+			// 发出本轮产生的工具结果（跳过已流式发出的模型消息）
+			for _, m := range r.state.messages[before+1:] {
+				if !emit(m) {
+					return
 				}
 			}
+		}
+
+		emit(r.endRun(ctx, info, &schema.Message{Role: schema.RoleAssistant, Content: "max steps reached"}))
+	}()
+
+	return out, errs
+}
+
+// toolOutcome is the result of one structured tool call.
+type toolOutcome struct {
+	observation string
+	extra       []*schema.Message
+	// found is false for calls to unknown tools, which leave the
+	// observation to the caller.
+	found bool
+	// fatal is set when the tool failed with a tool.FatalError.
+	fatal error
+}
+
+// runToolCalls executes the calls of one assistant turn, concurrently when
+// ParallelToolCalls is set, and returns their outcomes in call order.
+func (r *ReactAgent) runToolCalls(ctx context.Context, info CallbackInfo, calls []schema.ToolCall) []toolOutcome {
+	outcomes := make([]toolOutcome, len(calls))
+	run := func(i int) {
+		call := calls[i]
+		var args map[string]interface{}
+		// 参数过大时不解析也不执行，提示模型缩减参数
+		if size := len(call.Function.Arguments); size > r.conf.MaxToolArgsBytes {
+			outcomes[i] = toolOutcome{observation: r.argsTooLargeObservation(size), found: true}
+			return
+		}
+		// 参数可能由流式增量拼接而成，解析失败时附带正确调用示例反馈给模型
+		if call.Function.Arguments != "" {
+			info := tool.ToolInfo{Name: call.Function.Name}
+			if local := LocalExecutor(r.conf.Tools).find(call.Function.Name); local != nil {
+				info = local.Info()
+			}
+			parseStart := time.Now()
+			decoded, err := tool.ParseRawArgs(info, call.Function.Arguments)
+			r.recordStats(func(s *RunStats) { s.ParseTime += time.Since(parseStart) })
+			if err != nil {
+				outcomes[i] = toolOutcome{observation: errorObservation(err.Error()), found: true}
+				return
+			}
+			args = decoded
+		}
+		outcomes[i] = r.runTool(ctx, info, call, args)
+	}
+	if !r.conf.ParallelToolCalls || len(calls) == 1 {
+		for i := range calls {
+			run(i)
+		}
+		return outcomes
+	}
+	// 每个结果写入各自的下标，完成顺序不影响结果顺序
+	var wg sync.WaitGroup
+	for i := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run(i)
+		}()
+	}
+	wg.Wait()
+	return outcomes
+}
 
-			// 将工具结果加入 State（role 仍为 Tool，内容为结果）
-			r.state.messages = append(r.state.messages, &schema.Message{Role: schema.RoleTool, Content: toolContent})
+// errStreamStopped reports that the consumer of Stream went away; the context
+// error has already been sent.
+var errStreamStopped = errors.New("stream stopped")
 
-			// 继续循环，让 chatmodel 根据工具结果决定下一步
+// streamModel streams one model call over history, forwarding every delta
+// through emit, and returns the assembled message, or nil when the model
+// sent nothing.
+func (r *ReactAgent) streamModel(ctx context.Context, history []*schema.Message, emit func(*schema.Message) bool) (*schema.Message, error) {
+	deltas, deltaErrs := r.conf.Model.Stream(ctx, history)
+	var (
+		acc   schema.MessageAccumulator
+		final *schema.Message
+	)
+	received := false
+	for delta := range deltas {
+		received = true
+		// 模型给出的最终消息替代本地拼接结果，不再转发给调用方
+		if delta.Final {
+			final = delta
 			continue
 		}
+		acc.Add(delta)
+		if !emit(delta) {
+			return nil, errStreamStopped
+		}
+	}
+	if err := <-deltaErrs; err != nil {
+		return nil, err
+	}
+	if !received {
+		return nil, nil
+	}
+	if final != nil {
+		m := *final
+		m.Final = false
+		return &m, nil
+	}
+	return acc.Finalize(), nil
+}
 
-		// 如果是 assistant，退出循环并返回
-		if msg.Role == schema.RoleAssistant {
-			r.state.messages = append(r.state.messages, msg)
-			return msg, nil, nil
+// callModel makes one model step through call, recording it in the stats.
+// With AutoContinueOnLength, an answer cut off by the token limit is sent
+// back as a partial assistant message and the continuations are joined.
+// With ErrorOnEmptyResponse, empty messages are retried.
+func (r *ReactAgent) callModel(history []*schema.Message, call func(history []*schema.Message) (*schema.Message, error)) (*schema.Message, error) {
+	timed := func(history []*schema.Message) (*schema.Message, error) {
+		start := time.Now()
+		msg, err := call(history)
+		r.state.Stats.observeModel(time.Since(start), msg)
+		kv := []any{"run_id", r.state.RunID, "duration", time.Since(start)}
+		if err != nil {
+			kv = append(kv, "error", err)
+		}
+		r.log().Debug("model call", kv...)
+		return msg, err
+	}
+	msg, err := timed(history)
+	for retries := 0; err == nil && r.conf.ErrorOnEmptyResponse && emptyResponse(msg); retries++ {
+		if retries >= r.conf.MaxEmptyResponseRetries {
+			return nil, ErrEmptyResponse
+		}
+		// 空回复通常是服务端偶发问题，原样重试
+		r.log().Warn("retrying empty response", "run_id", r.state.RunID, "retry", retries+1)
+		msg, err = timed(history)
+	}
+	if err != nil || msg == nil || !r.conf.AutoContinueOnLength {
+		return msg, err
+	}
+	for i := 0; i < r.conf.MaxContinuations && truncated(msg); i++ {
+		// 截断的回答作为 assistant 消息发回，请求模型接着生成
+		r.log().Info("continuing truncated answer", "run_id", r.state.RunID, "continuation", i+1)
+		next, err := timed(append(history[:len(history):len(history)], msg))
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			break
 		}
+		msg = joinContinuation(msg, next)
+	}
+	return msg, nil
+}
 
-		// 其他角色（如 user/system），加入 State 并继续
-		r.state.messages = append(r.state.messages, msg)
+// emptyResponse reports whether msg carries neither content nor tool calls.
+// Filtered messages are left to contentFiltered.
+func emptyResponse(msg *schema.Message) bool {
+	if msg == nil {
+		return true
 	}
+	return strings.TrimSpace(msg.Content) == "" && len(msg.ToolCalls) == 0 && contentFiltered(msg) == nil
+}
 
-	return &schema.Message{Role: schema.RoleAssistant, Content: "max steps reached"}, nil, r.state
+// truncated reports whether msg is an answer cut off by the token limit.
+func truncated(msg *schema.Message) bool {
+	return msg.ResponseMeta != nil && msg.ResponseMeta.FinishReason == schema.FinishLength && len(msg.ToolCalls) == 0
+}
+
+// joinContinuation appends next to the partial answer msg. The result keeps
+// the metadata of next, with the usage of both calls added up.
+func joinContinuation(msg, next *schema.Message) *schema.Message {
+	joined := *msg
+	joined.Content += next.Content
+	joined.ReasoningContent += next.ReasoningContent
+	joined.ToolCalls = next.ToolCalls
+	joined.ResponseMeta = next.ResponseMeta
+	if next.ResponseMeta != nil {
+		meta := *next.ResponseMeta
+		if a, b := msg.ResponseMeta.Usage, next.ResponseMeta.Usage; a != nil && b != nil {
+			meta.Usage = &schema.TokenUsage{
+				PromptTokens:     a.PromptTokens + b.PromptTokens,
+				CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+				TotalTokens:      a.TotalTokens + b.TotalTokens,
+			}
+		}
+		joined.ResponseMeta = &meta
+	}
+	return &joined
+}
+
+// log returns the configured Logger, or a no-op one.
+func (r *ReactAgent) log() logging.Logger {
+	return logging.OrNoop(r.conf.Logger)
+}
+
+// fail logs a run error and reports it to the OnError callback.
+func (r *ReactAgent) fail(ctx context.Context, info CallbackInfo, err error) {
+	r.log().Error("run failed", "run_id", info.RunID, "step", info.Step, "error", err)
+	r.conf.Callbacks.error(ctx, info, err)
+}
+
+// executor returns the configured ToolExecutor, defaulting to the Tools.
+func (r *ReactAgent) executor() ToolExecutor {
+	if r.conf.ToolExecutor != nil {
+		return r.conf.ToolExecutor
+	}
+	return LocalExecutor(r.conf.Tools)
+}
+
+// giveUpOnUnknownTool reports a call to an unregistered tool and tells whether
+// the run has exhausted its MaxUnknownToolRetries.
+func (r *ReactAgent) giveUpOnUnknownTool(ctx context.Context, info CallbackInfo, call schema.ToolCall) bool {
+	r.log().Warn("unknown tool", "run_id", info.RunID, "tool", call.Function.Name)
+	r.conf.Callbacks.unknownTool(ctx, info, call)
+	metrics.OrNoop(r.conf.Metrics).IncToolCall(call.Function.Name, false)
+	r.state.unknownToolCalls++
+	return r.state.unknownToolCalls > r.conf.MaxUnknownToolRetries
+}
+
+// unknownToolObservation tells the model which tools it can call instead.
+func (r *ReactAgent) unknownToolObservation(name string) string {
+	names := make([]string, len(r.conf.Tools))
+	for i, t := range r.conf.Tools {
+		names[i] = t.Info().Name
+	}
+	return errorObservation(fmt.Sprintf("tool '%s' not found; available tools: %s", name, strings.Join(names, ", ")))
+}
+
+// executorHasTool reports whether the configured ToolExecutor may serve name:
+// false without one, otherwise its ToolLookup answer, or true when it cannot
+// tell before executing.
+func (r *ReactAgent) executorHasTool(name string) bool {
+	if r.conf.ToolExecutor == nil {
+		return false
+	}
+	if lookup, ok := r.conf.ToolExecutor.(ToolLookup); ok {
+		return lookup.HasTool(name)
+	}
+	return true
+}
+
+// runTool validates the arguments, executes the tool and renders its result
+// (or error) as the observation content fed back to the model, together with
+// any extra messages the tool returned through a *tool.Result. The outcome is
+// not found when the tool is unknown, leaving the observation to the caller.
+func (r *ReactAgent) runTool(ctx context.Context, info CallbackInfo, call schema.ToolCall, args map[string]interface{}) toolOutcome {
+	name := call.Function.Name
+	local := LocalExecutor(r.conf.Tools).find(name)
+	// 未注册且执行器也不认识的工具无需进入执行流程，不触发回调和统计
+	if local == nil && !r.executorHasTool(name) {
+		return toolOutcome{}
+	}
+	begin := time.Now()
+	var (
+		timing   toolTiming
+		notFound bool
+	)
+	defer func() {
+		if !notFound {
+			r.recordStats(func(s *RunStats) { s.observeOverhead(timing, time.Since(begin)) })
+		}
+	}()
+	r.conf.Callbacks.toolStart(ctx, info, call)
+	var (
+		observation string
+		extra       []*schema.Message
+		err         error
+	)
+	// 参数不符合工具定义时直接反馈给模型，附带正确调用示例以便自我纠正
+	if local != nil {
+		parseStart := time.Now()
+		err = tool.ValidateArgs(local.Info(), args, tool.WithJSONStringCoercion(r.conf.CoerceJSONStringArgs))
+		timing.parse = time.Since(parseStart)
+	}
+	if err != nil {
+		observation = errorObservation(err.Error())
+	} else {
+		toolCtx := ctx
+		if r.conf.ToolContext != nil {
+			toolCtx = r.conf.ToolContext(ctx)
+		}
+		if st, ok := local.(tool.StreamingTool); ok && r.conf.ToolExecutor == nil {
+			// 流式工具边执行边构建结果，整体计入执行时间
+			start := time.Now()
+			observation, err = r.streamTool(toolCtx, st, args)
+			timing.exec = time.Since(start)
+		} else {
+			observation, extra, err = r.executeTool(toolCtx, name, args, &timing)
+		}
+		if errors.Is(err, ErrToolNotFound) {
+			notFound = true
+			return toolOutcome{}
+		}
+		r.recordStats(func(s *RunStats) { s.observeTool(timing.exec) })
+		if err == nil && r.conf.IncludeReturnSchema && local != nil {
+			observation = withReturnSchema(observation, local.Info())
+		}
+	}
+	metrics.OrNoop(r.conf.Metrics).IncToolCall(name, err == nil)
+	if err != nil {
+		r.log().Warn("tool failed", "run_id", info.RunID, "tool", name, "duration", timing.exec, "error", err)
+	} else {
+		r.log().Info("tool executed", "run_id", info.RunID, "tool", name, "duration", timing.exec)
+	}
+	r.conf.Callbacks.toolEnd(ctx, info, call, observation)
+	outcome := toolOutcome{observation: observation, extra: extra, found: true}
+	if tool.IsFatal(err) {
+		outcome.fatal = fmt.Errorf("tool %q: %w", name, err)
+	}
+	return outcome
+}
+
+// executeTool runs a tool through the executor, or takes its result from the
+// ToolCache, and serializes the result or error. The execution error is
+// returned alongside its observation. timing receives the execution and
+// serialization times.
+func (r *ReactAgent) executeTool(ctx context.Context, name string, args map[string]interface{}, timing *toolTiming) (string, []*schema.Message, error) {
+	cache := r.conf.ToolCache
+	result, hit := interface{}(nil), false
+	if cache != nil {
+		result, hit = cache.Get(name, args)
+	}
+	if !hit {
+		var execErr error
+		start := time.Now()
+		result, execErr = r.executor().Execute(ctx, name, args)
+		timing.exec = time.Since(start)
+		if execErr != nil {
+			return errorObservation(execErr.Error()), nil, execErr
+		}
+		if cache != nil {
+			cache.Set(name, args, result)
+		}
+	}
+	var extra []*schema.Message
+	if res, ok := result.(*tool.Result); ok && res != nil {
+		result, extra = res.Content, res.ExtraMessages
+	}
+	start := time.Now()
+	defer func() { timing.serialize = time.Since(start) }()
+	if r.conf.ResultPostProcessor != nil {
+		result = r.conf.ResultPostProcessor(name, result)
+	}
+	if b, mErr := json.Marshal(result); mErr == nil {
+		return string(b), extra, nil
+	}
+	return fmt.Sprintf("{\"result\":\"%v\"}", result), extra, nil
+}
+
+// withReturnSchema wraps a successful observation with the tool's return
+// schema, if it declares one.
+func withReturnSchema(observation string, info tool.ToolInfo) string {
+	rs := info.ReturnJSONSchema()
+	if rs == nil || !json.Valid([]byte(observation)) {
+		return observation
+	}
+	b, err := json.Marshal(map[string]interface{}{"result": json.RawMessage(observation), "result_schema": rs})
+	if err != nil {
+		return observation
+	}
+	return string(b)
+}
+
+// recordStats updates the State's RunStats; calls from parallel tool runs are
+// serialized.
+func (r *ReactAgent) recordStats(fn func(s *RunStats)) {
+	r.statsMu.Lock()
+	defer r.statsMu.Unlock()
+	fn(&r.state.Stats)
+}
+
+// streamTool runs a StreamingTool and builds the observation from its array
+// element by element, up to MaxStreamedObservationBytes. A truncated array is
+// wrapped as {"result":[...],"truncated":true}.
+func (r *ReactAgent) streamTool(ctx context.Context, t tool.StreamingTool, args map[string]interface{}) (string, error) {
+	body, err := t.ExecuteStream(ctx, args)
+	if err != nil {
+		return errorObservation(err.Error()), err
+	}
+	defer body.Close()
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	elems, errs := tool.DecodeJSONArray(streamCtx, body)
+	deltas, truncated := tool.ObservationDeltas(elems, r.conf.MaxStreamedObservationBytes)
+	var b strings.Builder
+	for delta := range deltas {
+		b.WriteString(delta)
+	}
+	if <-truncated {
+		// 超出上限时提前结束，取消解码协程
+		cancel()
+		<-errs
+		return `{"result":` + b.String() + `,"truncated":true}`, nil
+	}
+	if err := <-errs; err != nil {
+		return errorObservation(err.Error()), err
+	}
+	return b.String(), nil
 }
 
 // parseToolCall attempts to extract a tool invocation from assistant content.
-// Supports JSON format: {"tool":"name","arguments":{...}}
-// and ReAct text format: lines with "Action:" and "Action Input:".
-func parseToolCall(content string) (struct {
+// Supports JSON format: {"tool":"name","arguments":{...}}, where the name and
+// argument keys are looked up in the order given by fields.
+func parseToolCall(content string, fields ToolCallFieldConfig) (struct {
 	Name string
 	Args map[string]interface{}
 }, bool) {
-	// 统一解析 JSON 格式，兼容多种字段命名
+	// 统一解析 JSON 格式，按配置的字段顺序查找
 	var raw map[string]interface{}
 	if err := json.Unmarshal([]byte(content), &raw); err == nil {
-		// 尝试多种字段：tool/name/function.name
 		var name string
-		if v, ok := raw["tool"].(string); ok {
-			name = v
-		}
-		if v, ok := raw["name"].(string); ok && name == "" {
-			name = v
-		}
-		if fn, ok := raw["function"].(map[string]interface{}); ok && name == "" {
-			if v, ok := fn["name"].(string); ok {
+		for _, path := range fields.NameFields {
+			if v, ok := lookupPath(raw, path).(string); ok && v != "" {
 				name = v
+				break
 			}
 		}
 
-		// 参数字段：arguments/args/input
 		var args map[string]interface{}
-		if v, ok := raw["arguments"].(map[string]interface{}); ok {
-			args = v
-		} else if v, ok := raw["args"].(map[string]interface{}); ok {
-			args = v
-		} else if v, ok := raw["input"].(map[string]interface{}); ok {
-			args = v
+		for _, path := range fields.ArgsFields {
+			if v, ok := lookupPath(raw, path).(map[string]interface{}); ok {
+				args = v
+				break
+			}
 		}
 
 		if name != "" {
@@ -185,10 +1203,30 @@ func parseToolCall(content string) (struct {
 	}{}, false
 }
 
-func escapeString(s string) string {
-	// minimal JSON string escape for quotes and newlines
-	s = strings.ReplaceAll(s, "\\", "\\\\")
-	s = strings.ReplaceAll(s, "\"", "\\\"")
-	s = strings.ReplaceAll(s, "\n", "\\n")
-	return s
+// lookupPath walks a dot-separated path such as "function.name" through
+// nested JSON objects and returns the value found, or nil.
+func lookupPath(raw map[string]interface{}, path string) interface{} {
+	var cur interface{} = raw
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[key]
+	}
+	return cur
+}
+
+// argsTooLargeObservation tells the model that size bytes of tool arguments
+// exceed MaxToolArgsBytes.
+func (r *ReactAgent) argsTooLargeObservation(size int) string {
+	return errorObservation(fmt.Sprintf("arguments too large: %d bytes exceed the limit of %d bytes", size, r.conf.MaxToolArgsBytes))
+}
+
+// errorObservation renders an error as a {"error": "..."} JSON observation.
+// json.Marshal escapes quotes, control characters and invalid UTF-8, so the
+// result is always valid JSON whatever the error text contains.
+func errorObservation(msg string) string {
+	b, _ := json.Marshal(map[string]string{"error": msg})
+	return string(b)
 }
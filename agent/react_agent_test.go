@@ -2,25 +2,60 @@ package agent_test
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"reAct-agent/agent"
+	"reAct-agent/agent/agenttest"
 	"reAct-agent/chatmodel"
+	httpclient "reAct-agent/http_client"
+	"reAct-agent/logging"
 	"reAct-agent/schema"
 	"reAct-agent/tool"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
-func TestNewReactAgent(t *testing.T) {
+// TestReactAgentReplaysRecordedGeneration runs a calculator conversation
+// against a recorded cassette, without network access. Tool definitions are
+// left out of matching, so editing a tool description keeps the cassette
+// valid. Set REACT_AGENT_RECORD=1 and QWEN_API_KEY to record it again from
+// the live API.
+func TestReactAgentReplaysRecordedGeneration(t *testing.T) {
 	ctx := context.Background()
-	apiKey := "sk-00e87cc20b4f909f8c60a0635a69e074940ea275196e0615658384a3828f4b62"
-	baseUrl := "https://openai.qiniu.com/v1"
-	qwModel, err := chatmodel.NewQWenModelClient(apiKey, chatmodel.WithBaseUrl(baseUrl))
+	const (
+		baseUrl  = "https://openai.qiniu.com/v1"
+		model    = "qwen3-coder-480b-a35b-instruct"
+		cassette = "testdata/calculator.cassette.json"
+	)
+	mode, apiKey := httpclient.ReplayMode, "test-key"
+	if os.Getenv("REACT_AGENT_RECORD") != "" {
+		mode, apiKey = httpclient.RecordingMode, os.Getenv("QWEN_API_KEY")
+		if apiKey == "" {
+			t.Skip("QWEN_API_KEY is required to record")
+		}
+	}
+	inner := httpclient.NewHTTPClient(baseUrl, "chat/completions", httpclient.WithHeader(httpclient.HTTPHeader{
+		"Content-Type":  "application/json",
+		"Accept":        "application/json",
+		"Authorization": "Bearer " + apiKey,
+	}))
+	recorder, err := httpclient.NewRecordingHTTPClient(inner, cassette, mode, httpclient.WithIgnoredFields("tools"))
+	if err != nil {
+		t.Fatalf("NewRecordingHTTPClient failed: %v", err)
+	}
+	qwModel, err := chatmodel.NewQWenModelClient(apiKey, chatmodel.WithHTTPClient(recorder))
 	if err != nil {
 		t.Fatalf("NewQWenModelClient failed: %v", err)
 	}
 	chatModel, err := chatmodel.NewChatModel(ctx, &chatmodel.ChatModelConfig{
 		Client: qwModel,
 		APIKey: apiKey,
-		Model:  "qwen3-coder-480b-a35b-instruct",
+		Model:  model,
 	})
 	if err != nil {
 		t.Fatalf("NewChatModel failed: %v", err)
@@ -31,13 +66,2018 @@ func TestNewReactAgent(t *testing.T) {
 			&tool.CalculatorTool{},
 		},
 	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
 
 	res, err, state := reactAgent.Generate(ctx, []*schema.Message{
 		{Role: schema.RoleUser, Content: "What is 2 + 2?"},
 	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !strings.Contains(res.Content, "4") {
+		t.Fatalf("unexpected final answer: %q", res.Content)
+	}
+	var observed bool
+	for _, msg := range state.Messages() {
+		if msg.Role == schema.RoleTool && strings.Contains(msg.Content, "4") {
+			observed = true
+		}
+	}
+	if !observed {
+		t.Fatalf("calculator result missing from the history:\n%s", schema.Transcript(state.Messages()))
+	}
+}
+
+// scriptedHTTPClient replays canned HTTP responses in order and records the
+// request bodies it receives.
+type scriptedHTTPClient struct {
+	responses []string
+	// streams holds the SSE bodies served by SendStream, one per call.
+	streams  []string
+	requests []interface{}
+}
+
+func (s *scriptedHTTPClient) Send(ctx context.Context, method httpclient.HTTPMethod, body interface{}) (*httpclient.HTTPResponse, error) {
+	s.requests = append(s.requests, body)
+	if len(s.responses) == 0 {
+		return nil, errors.New("no scripted response left")
+	}
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	return &httpclient.HTTPResponse{Body: []byte(resp), StatusCode: 200}, nil
+}
+
+func (s *scriptedHTTPClient) SendStream(ctx context.Context, method httpclient.HTTPMethod, body interface{}) (httpclient.IOReader, httpclient.IOError) {
+	out := make(chan httpclient.HTTPResponse, 1)
+	errs := make(chan error, 1)
+	s.requests = append(s.requests, body)
+	if len(s.streams) == 0 {
+		errs <- errors.New("streaming not scripted")
+	} else {
+		out <- httpclient.HTTPResponse{Body: []byte(s.streams[0]), StatusCode: 200}
+		s.streams = s.streams[1:]
+	}
+	close(out)
+	close(errs)
+	return out, errs
+}
+
+// recordingTool records the arguments of every invocation.
+type recordingTool struct {
+	name  string
+	calls []map[string]interface{}
+}
+
+func (r *recordingTool) Info() tool.ToolInfo {
+	return tool.ToolInfo{Name: r.name, Desc: "records calls"}
+}
+
+func (r *recordingTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	r.calls = append(r.calls, params)
+	return map[string]interface{}{"ok": true}, nil
+}
+
+func TestGenerateExecutesToolCallWithEmptyContent(t *testing.T) {
+	ctx := context.Background()
+	httpClient := &scriptedHTTPClient{responses: []string{
+		`{"choices":[{"index":0,"message":{"role":"assistant","content":"","tool_calls":[{"id":"call_1","type":"function","function":{"name":"calculator","arguments":"{\"expression\":\"2+2\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[{"index":0,"message":{"role":"assistant","content":"The answer is 4."},"finish_reason":"stop"}]}`,
+	}}
+	qwModel, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithHTTPClient(httpClient))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	chatModel, err := chatmodel.NewChatModel(ctx, &chatmodel.ChatModelConfig{
+		Client: qwModel,
+		APIKey: "test-key",
+		Model:  "qwen-test",
+	})
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model: chatModel,
+		Tools: []tool.Tool{calc},
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+
+	res, err, _ := reactAgent.Generate(ctx, []*schema.Message{
+		{Role: schema.RoleUser, Content: "What is 2 + 2?"},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(calc.calls) != 1 {
+		t.Fatalf("expected tool to run once, ran %d times", len(calc.calls))
+	}
+	if got := calc.calls[0]["expression"]; got != "2+2" {
+		t.Fatalf("unexpected tool arguments: %v", calc.calls[0])
+	}
+	if res.Content != "The answer is 4." {
+		t.Fatalf("unexpected final answer: %q", res.Content)
+	}
+	// QWen 的 finish_reason 经 ChatModel 透传到最终回答
+	if res.FinishReason() != schema.FinishStop {
+		t.Fatalf("unexpected finish reason %q", res.FinishReason())
+	}
+
+	// 第二次请求应携带 assistant 的 tool_calls 与对应的 tool 结果
+	second, ok := httpClient.requests[1].(chatmodel.QWenRequest)
+	if !ok {
+		t.Fatalf("unexpected request type %T", httpClient.requests[1])
+	}
+	msgs := second.Messages
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages in follow-up request, got %d", len(msgs))
+	}
+	if len(msgs[1].ToolCalls) != 1 || msgs[1].ToolCalls[0].ID != "call_1" {
+		t.Fatalf("assistant tool call not forwarded: %+v", msgs[1])
+	}
+	if msgs[2].Role != "tool" || msgs[2].ToolCallID != "call_1" {
+		t.Fatalf("tool result not correlated: %+v", msgs[2])
+	}
+}
+
+// scriptedModel is a ChatModel whose Stream replays one delta sequence per step.
+type scriptedModel struct {
+	streams [][]*schema.Message
+	history [][]*schema.Message
+}
+
+func (m *scriptedModel) Generate(ctx context.Context, history []*schema.Message) (*schema.Message, error) {
+	return nil, errors.New("generate not scripted")
+}
+
+func (m *scriptedModel) Stream(ctx context.Context, history []*schema.Message) (<-chan *schema.Message, <-chan error) {
+	m.history = append(m.history, append([]*schema.Message(nil), history...))
+	out := make(chan *schema.Message, 16)
+	errs := make(chan error, 1)
+	if len(m.streams) == 0 {
+		errs <- errors.New("no scripted stream left")
+	} else {
+		for _, d := range m.streams[0] {
+			out <- d
+		}
+		m.streams = m.streams[1:]
+	}
+	close(out)
+	close(errs)
+	return out, errs
+}
+
+func (m *scriptedModel) BindTools(ctx context.Context, infos []*tool.ToolInfo) error {
+	return nil
+}
+
+func TestStreamAssemblesSplitToolArguments(t *testing.T) {
+	ctx := context.Background()
+	zero := 0
+	model := &scriptedModel{streams: [][]*schema.Message{
+		{
+			{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: &zero, ID: "call_1", Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expr`}}}},
+			{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: &zero, Function: schema.FunctionCall{Arguments: `ession":"2`}}}},
+			{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: &zero, Function: schema.FunctionCall{Arguments: `+2"}`}}}},
+		},
+		{
+			{Role: schema.RoleAssistant, Content: "The answer "},
+			{Role: schema.RoleAssistant, Content: "is 4."},
+		},
+	}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+
+	msgs, errs := reactAgent.Stream(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "What is 2 + 2?"}})
+	var answer string
+	var toolResults []*schema.Message
+	for m := range msgs {
+		switch m.Role {
+		case schema.RoleTool:
+			toolResults = append(toolResults, m)
+		case schema.RoleAssistant:
+			answer += m.Content
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+
+	if len(calc.calls) != 1 || calc.calls[0]["expression"] != "2+2" {
+		t.Fatalf("tool not called with reassembled arguments: %v", calc.calls)
+	}
+	if len(toolResults) != 1 || toolResults[0].ToolCallID != "call_1" {
+		t.Fatalf("unexpected tool results: %+v", toolResults)
+	}
+	if answer != "The answer is 4." {
+		t.Fatalf("unexpected streamed answer: %q", answer)
+	}
+	// 第二步的历史应包含组装后的 assistant 工具调用消息
+	second := model.history[1]
+	call := second[len(second)-2]
+	if len(call.ToolCalls) != 1 || call.ToolCalls[0].Function.Arguments != `{"expression":"2+2"}` {
+		t.Fatalf("assembled assistant message not recorded: %+v", call)
+	}
+}
+
+func TestStreamRecoversFromMalformedStreamedArguments(t *testing.T) {
+	ctx := context.Background()
+	zero := 0
+	model := &scriptedModel{streams: [][]*schema.Message{
+		// 参数在流中途被截断，拼接结果不是合法 JSON
+		{
+			{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: &zero, ID: "call_1", Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expression":`}}}},
+			{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: &zero, Function: schema.FunctionCall{Arguments: `"2+2`}}}},
+		},
+		{
+			{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: &zero, ID: "call_2", Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expression":`}}}},
+			{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: &zero, Function: schema.FunctionCall{Arguments: `"2+2"}`}}}},
+		},
+		{{Role: schema.RoleAssistant, Content: "4"}},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{&tool.CalculatorTool{}}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+
+	msgs, errs := reactAgent.Stream(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}})
+	var toolResults []*schema.Message
+	var answer string
+	for m := range msgs {
+		switch m.Role {
+		case schema.RoleTool:
+			toolResults = append(toolResults, m)
+		case schema.RoleAssistant:
+			answer += m.Content
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+
+	if len(toolResults) != 2 {
+		t.Fatalf("expected a corrective observation and a result, got %+v", toolResults)
+	}
+	var decoded map[string]string
+	if err := json.Unmarshal([]byte(toolResults[0].Content), &decoded); err != nil {
+		t.Fatalf("observation is not valid JSON: %v", err)
+	}
+	for _, want := range []string{"not a valid JSON object", `{"arguments":{"expression":"<expression>"},"name":"calculator"}`} {
+		if !strings.Contains(decoded["error"], want) {
+			t.Fatalf("observation %q should contain %q", decoded["error"], want)
+		}
+	}
+	if strings.Contains(toolResults[1].Content, "error") || answer != "4" {
+		t.Fatalf("agent did not recover: result %q, answer %q", toolResults[1].Content, answer)
+	}
+}
+
+// sequenceModel is a ChatModel whose Generate returns scripted messages in
+// order and records the history of each call.
+type sequenceModel struct {
+	replies []*schema.Message
+	history [][]*schema.Message
+}
+
+func (m *sequenceModel) Generate(ctx context.Context, history []*schema.Message) (*schema.Message, error) {
+	m.history = append(m.history, append([]*schema.Message(nil), history...))
+	if len(m.replies) == 0 {
+		return nil, errors.New("no scripted reply left")
+	}
+	reply := m.replies[0]
+	m.replies = m.replies[1:]
+	return reply, nil
+}
+
+func (m *sequenceModel) Stream(ctx context.Context, history []*schema.Message) (<-chan *schema.Message, <-chan error) {
+	out := make(chan *schema.Message)
+	errs := make(chan error, 1)
+	errs <- errors.New("stream not scripted")
+	close(out)
+	close(errs)
+	return out, errs
+}
+
+func (m *sequenceModel) BindTools(ctx context.Context, infos []*tool.ToolInfo) error {
+	return nil
+}
+
+func TestGenerateAssignsCallIDsToTextAndStructuredCalls(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleTool, Content: `{"tool":"calculator","arguments":{"expression":"2+2"}}`},
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expression":"3*4"}`}}}},
+		{Role: schema.RoleAssistant, Content: "done"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{&recordingTool{name: "calculator"}}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	history := model.history[2]
+	textCall, textResult := history[1], history[2]
+	if !strings.HasPrefix(textCall.ToolCallID, tool.CallIDPrefix) || textResult.ToolCallID != textCall.ToolCallID {
+		t.Fatalf("text call and result not correlated: %q vs %q", textCall.ToolCallID, textResult.ToolCallID)
+	}
+	structCall, structResult := history[3], history[4]
+	id := structCall.ToolCalls[0].ID
+	if !strings.HasPrefix(id, tool.CallIDPrefix) || structResult.ToolCallID != id {
+		t.Fatalf("structured call and result not correlated: %q vs %q", id, structResult.ToolCallID)
+	}
+	if id == textCall.ToolCallID {
+		t.Fatal("call IDs should be unique")
+	}
+}
+
+func TestGenerateWithCustomToolCallFields(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleTool, Content: `{"action":"calculator","action_input":{"expression":"3*4"}}`},
+		{Role: schema.RoleAssistant, Content: "12"},
+	}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model: model,
+		Tools: []tool.Tool{calc},
+		ToolCallFields: agent.ToolCallFieldConfig{
+			NameFields: []string{"action"},
+			ArgsFields: []string{"action_input"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "3*4?"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if res.Content != "12" {
+		t.Fatalf("unexpected answer %q", res.Content)
+	}
+	if len(calc.calls) != 1 || calc.calls[0]["expression"] != "3*4" {
+		t.Fatalf("tool not called with custom fields: %v", calc.calls)
+	}
+}
+
+func TestGenerateWithDefaultToolCallFieldsSupportsNestedName(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleTool, Content: `{"function":{"name":"calculator"},"input":{"expression":"2+2"}}`},
+		{Role: schema.RoleAssistant, Content: "4"},
+	}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(calc.calls) != 1 || calc.calls[0]["expression"] != "2+2" {
+		t.Fatalf("tool not called with default fields: %v", calc.calls)
+	}
+}
+
+// failingTool always fails with the configured error.
+type failingTool struct {
+	name string
+	err  error
+}
+
+func (f *failingTool) Info() tool.ToolInfo {
+	return tool.ToolInfo{Name: f.name, Desc: "always fails"}
+}
+
+func (f *failingTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return nil, f.err
+}
+
+func TestToolErrorObservationIsValidJSON(t *testing.T) {
+	ctx := context.Background()
+	errText := "bad\tinput \"quoted\" \\ path\nnext line \x01 ctrl — 中文 ✓"
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "broken"}}}},
+		{Role: schema.RoleAssistant, Content: "sorry"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model: model,
+		Tools: []tool.Tool{&failingTool{name: "broken", err: errors.New(errText)}},
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	observation := model.history[1][2].Content
+	var decoded map[string]string
+	if err := json.Unmarshal([]byte(observation), &decoded); err != nil {
+		t.Fatalf("observation is not valid JSON: %v\n%s", err, observation)
+	}
+	if decoded["error"] != errText {
+		t.Fatalf("error text not preserved: %q", decoded["error"])
+	}
+}
+
+func TestFatalToolErrorAbortsRun(t *testing.T) {
+	ctx := context.Background()
+	denied := errors.New("permission denied")
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "locked"}}}},
+		{Role: schema.RoleAssistant, Content: "should not be reached"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model: model,
+		Tools: []tool.Tool{&failingTool{name: "locked", err: tool.Fatal(denied)}},
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	_, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}})
+	if !errors.Is(err, denied) || !tool.IsFatal(err) {
+		t.Fatalf("expected the fatal tool error, got %v", err)
+	}
+	if len(model.history) != 1 {
+		t.Fatalf("model should not be asked again after a fatal error, got %d calls", len(model.history))
+	}
+	// 工具结果仍记录在历史中，保证调用与结果成对
+	msgs := state.Messages()
+	if last := msgs[len(msgs)-1]; last.Role != schema.RoleTool || last.ToolCallID != "call_1" {
+		t.Fatalf("fatal observation should be recorded, got %+v", last)
+	}
+}
+
+// recordRunIDs returns callbacks that append the run ID seen by every hook.
+func recordRunIDs(ids *[]string, events *[]string) *agent.Callbacks {
+	rec := func(event string, info agent.CallbackInfo) {
+		*ids = append(*ids, info.RunID)
+		*events = append(*events, event)
+	}
+	return &agent.Callbacks{
+		OnRunStart:   func(ctx context.Context, info agent.CallbackInfo, _ []*schema.Message) { rec("run_start", info) },
+		OnModelStart: func(ctx context.Context, info agent.CallbackInfo, _ []*schema.Message) { rec("model_start", info) },
+		OnModelEnd:   func(ctx context.Context, info agent.CallbackInfo, _ *schema.Message) { rec("model_end", info) },
+		OnToolStart:  func(ctx context.Context, info agent.CallbackInfo, _ schema.ToolCall) { rec("tool_start", info) },
+		OnToolEnd:    func(ctx context.Context, info agent.CallbackInfo, _ schema.ToolCall, _ string) { rec("tool_end", info) },
+		OnError:      func(ctx context.Context, info agent.CallbackInfo, _ error) { rec("error", info) },
+		OnRunEnd:     func(ctx context.Context, info agent.CallbackInfo, _ *schema.Message) { rec("run_end", info) },
+	}
+}
+
+func TestRunIDIsSharedAcrossCallbacks(t *testing.T) {
+	ctx := context.Background()
+	var ids, events []string
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "calculator", Arguments: `{}`}}}},
+		{Role: schema.RoleAssistant, Content: "done"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:     model,
+		Tools:     []tool.Tool{&recordingTool{name: "calculator"}},
+		Callbacks: recordRunIDs(&ids, &events),
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	_, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	want := []string{"run_start", "model_start", "model_end", "tool_start", "tool_end", "model_start", "model_end", "run_end"}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected callback sequence %v", events)
+	}
+	if !strings.HasPrefix(state.RunID, "run_") {
+		t.Fatalf("unexpected run ID %q", state.RunID)
+	}
+	for i, id := range ids {
+		if id != state.RunID {
+			t.Fatalf("callback %s saw run ID %q, want %q", events[i], id, state.RunID)
+		}
+	}
+
+	// 新的一次运行使用新的 RunID
+	model.replies = []*schema.Message{{Role: schema.RoleAssistant, Content: "again"}}
+	firstRun := state.RunID
+	_, _, state = reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "again"}})
+	if state.RunID == firstRun {
+		t.Fatal("expected a fresh run ID for a new run")
+	}
+}
+
+func TestRunIDFromContextIsReused(t *testing.T) {
+	var ids, events []string
+	model := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "done"}}}
+	reactAgent, err := agent.NewReactAgent(context.Background(), &agent.ReactAgentConfig{Model: model, Callbacks: recordRunIDs(&ids, &events)})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	ctx := agent.WithRunID(context.Background(), "trace-123")
+	_, _, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}})
+	if state.RunID != "trace-123" {
+		t.Fatalf("run ID from context not used: %q", state.RunID)
+	}
+	for _, id := range ids {
+		if id != "trace-123" {
+			t.Fatalf("callback saw run ID %q", id)
+		}
+	}
+}
+
+// recordingMetrics counts every metric it receives.
+type recordingMetrics struct {
+	mu         sync.Mutex
+	requests   map[string]int
+	latencies  int
+	toolCalls  map[string]int
+	prompt     int
+	completion int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{requests: map[string]int{}, toolCalls: map[string]int{}}
+}
+
+func (m *recordingMetrics) IncRequest(provider, model string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[provider+"/"+model]++
+}
+
+func (m *recordingMetrics) ObserveLatency(provider, model string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencies++
+}
+
+func (m *recordingMetrics) IncToolCall(name string, success bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.toolCalls[fmt.Sprintf("%s:%t", name, success)]++
+}
+
+func (m *recordingMetrics) ObserveTokens(prompt, completion int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prompt += prompt
+	m.completion += completion
+}
+
+func TestMetricsCountRequestsToolsAndTokens(t *testing.T) {
+	ctx := context.Background()
+	httpClient := &scriptedHTTPClient{responses: []string{
+		`{"choices":[{"index":0,"message":{"role":"assistant","content":"","tool_calls":[` +
+			`{"id":"call_1","type":"function","function":{"name":"calculator","arguments":"{}"}},` +
+			`{"id":"call_2","type":"function","function":{"name":"broken","arguments":"{}"}}]}}],` +
+			`"usage":{"prompt_tokens":10,"completion_tokens":4,"total_tokens":14}}`,
+		`{"choices":[{"index":0,"message":{"role":"assistant","content":"done"}}],` +
+			`"usage":{"prompt_tokens":20,"completion_tokens":1,"total_tokens":21}}`,
+	}}
+	m := newRecordingMetrics()
+	qwModel, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithHTTPClient(httpClient), chatmodel.WithMetrics(m))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	chatModel, err := chatmodel.NewChatModel(ctx, &chatmodel.ChatModelConfig{Client: qwModel, APIKey: "test-key", Model: "qwen-test"})
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:   chatModel,
+		Tools:   []tool.Tool{&recordingTool{name: "calculator"}, &failingTool{name: "broken", err: errors.New("boom")}},
+		Metrics: m,
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if m.requests["qwen/qwen-test"] != 2 || m.latencies != 2 {
+		t.Fatalf("unexpected request metrics: %v, %d latencies", m.requests, m.latencies)
+	}
+	if m.toolCalls["calculator:true"] != 1 || m.toolCalls["broken:false"] != 1 {
+		t.Fatalf("unexpected tool metrics: %v", m.toolCalls)
+	}
+	if m.prompt != 30 || m.completion != 5 {
+		t.Fatalf("unexpected token metrics: prompt %d, completion %d", m.prompt, m.completion)
+	}
+
+	// 流式请求同样记录用量
+	httpClient.streams = []string{`data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}` + "\n\n" +
+		`data: {"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":2,"total_tokens":9}}` + "\n\n" +
+		"data: [DONE]\n\n"}
+	msgs, errs := reactAgent.Stream(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "again"}})
+	for range msgs {
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if m.requests["qwen/qwen-test"] != 3 || m.prompt != 37 || m.completion != 7 {
+		t.Fatalf("unexpected streaming metrics: %v, prompt %d, completion %d", m.requests, m.prompt, m.completion)
+	}
+}
+
+// contextTool returns its data together with extra guidance messages.
+type contextTool struct{}
+
+func (contextTool) Info() tool.ToolInfo {
+	return tool.ToolInfo{Name: "lookup", Desc: "returns data and guidance"}
+}
+
+func (contextTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return &tool.Result{
+		Content: map[string]interface{}{"rows": 3},
+		ExtraMessages: []*schema.Message{
+			{Role: schema.RoleSystem, Content: "focus on the first row"},
+			{Role: schema.RoleUser, Content: "raw: a,b,c"},
+		},
+	}, nil
+}
+
+func TestToolResultExtraMessagesAreAppended(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{
+			{ID: "call_1", Function: schema.FunctionCall{Name: "lookup"}},
+			{ID: "call_2", Function: schema.FunctionCall{Name: "calculator"}},
+		}},
+		{Role: schema.RoleAssistant, Content: "done"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model: model,
+		Tools: []tool.Tool{contextTool{}, &recordingTool{name: "calculator"}},
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	// user, assistant 调用, 两条工具结果, 两条额外消息
+	history := model.history[1]
+	if len(history) != 6 {
+		t.Fatalf("expected 6 messages, got %d", len(history))
+	}
+	if history[2].ToolCallID != "call_1" || history[2].Content != `{"rows":3}` {
+		t.Fatalf("unexpected lookup observation: %+v", history[2])
+	}
+	if history[3].ToolCallID != "call_2" {
+		t.Fatalf("tool results should stay contiguous: %+v", history[3])
+	}
+	if history[4].Role != schema.RoleSystem || history[4].Content != "focus on the first row" ||
+		history[5].Role != schema.RoleUser || history[5].Content != "raw: a,b,c" {
+		t.Fatalf("extra messages not appended in order: %+v, %+v", history[4], history[5])
+	}
+}
+
+func TestInvalidArgumentsTeachTheModel(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expression":7}`}}}},
+		{Role: schema.RoleAssistant, Content: "sorry"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{&tool.CalculatorTool{}}})
 	if err != nil {
 		t.Fatalf("NewReactAgent failed: %v", err)
 	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
 
-	t.Log(res, state)
+	var decoded map[string]string
+	if err := json.Unmarshal([]byte(model.history[1][2].Content), &decoded); err != nil {
+		t.Fatalf("observation is not valid JSON: %v", err)
+	}
+	msg := decoded["error"]
+	for _, want := range []string{`"expression"`, "String", `{"arguments":{"expression":"<expression>"},"name":"calculator"}`} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("observation %q should contain %q", msg, want)
+		}
+	}
+}
+
+func TestDuplicateToolNamesAreRejected(t *testing.T) {
+	ctx := context.Background()
+	first, second := &recordingTool{name: "search"}, &recordingTool{name: "search"}
+	_, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model: &sequenceModel{},
+		Tools: []tool.Tool{first, &recordingTool{name: "calculator"}, second},
+	})
+	if !errors.Is(err, agent.ErrDuplicateTool) {
+		t.Fatalf("expected ErrDuplicateTool, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"search"`) {
+		t.Fatalf("error should name the tool: %v", err)
+	}
+
+	// LocalExecutor 直接使用时按注册顺序匹配，先注册者优先
+	exec := agent.LocalExecutor{first, second}
+	if _, err := exec.Execute(ctx, "search", nil); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(first.calls) != 1 || len(second.calls) != 0 {
+		t.Fatalf("first registered tool should win, got %d and %d calls", len(first.calls), len(second.calls))
+	}
+}
+
+func TestSetToolsSwapsToolsetMidSession(t *testing.T) {
+	ctx := context.Background()
+	model := agenttest.NewChatModel(
+		agenttest.ToolCall("search", `{}`), agenttest.Answer("found"),
+		agenttest.ToolCall("search", `{}`), agenttest.ToolCall("calculator", `{}`), agenttest.Answer("4"),
+	)
+	search, calc := &recordingTool{name: "search"}, &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{search}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "look it up"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if err := reactAgent.SetTools(ctx, []tool.Tool{calc, calc}); !errors.Is(err, agent.ErrDuplicateTool) {
+		t.Fatalf("expected ErrDuplicateTool, got %v", err)
+	}
+	if err := reactAgent.SetTools(ctx, []tool.Tool{calc}); err != nil {
+		t.Fatalf("SetTools failed: %v", err)
+	}
+	if bound := model.Tools(); len(bound) != 1 || bound[0].Name != "calculator" {
+		t.Fatalf("model should be rebound to the new tools, got %v", bound)
+	}
+
+	// 同一会话中旧工具不再可用，新工具可以调用
+	res, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2"}})
+	if err != nil || res.Content != "4" {
+		t.Fatalf("Generate = %v, %v", res, err)
+	}
+	if len(search.calls) != 1 || len(calc.calls) != 1 {
+		t.Fatalf("expected one call to each tool, got search=%d calculator=%d", len(search.calls), len(calc.calls))
+	}
+	if msgs := state.Messages(); !strings.Contains(msgs[len(msgs)-4].Content, "available tools: calculator") {
+		t.Fatalf("old tool should be reported unknown, got %q", msgs[len(msgs)-4].Content)
+	}
+	if n := len(state.Messages()); n != 10 {
+		t.Fatalf("the conversation should be kept across SetTools, got %d messages", n)
+	}
+}
+
+func TestOversizedToolArgumentsAreRejected(t *testing.T) {
+	ctx := context.Background()
+	huge := `{"expression":"` + strings.Repeat("1+", 600) + `1"}`
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "calculator", Arguments: huge}}}},
+		{Role: schema.RoleAssistant, Content: "sorry"},
+	}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}, MaxToolArgsBytes: 1024})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if len(calc.calls) != 0 {
+		t.Fatalf("tool should not run with oversized arguments, got %d calls", len(calc.calls))
+	}
+	var decoded map[string]string
+	if err := json.Unmarshal([]byte(model.history[1][2].Content), &decoded); err != nil {
+		t.Fatalf("observation is not valid JSON: %v", err)
+	}
+	if !strings.Contains(decoded["error"], "arguments too large") {
+		t.Fatalf("observation should report the size limit, got %q", decoded["error"])
+	}
+}
+
+func TestOversizedToolPayloadIsRejected(t *testing.T) {
+	ctx := context.Background()
+	huge := `{"tool":"calculator","arguments":{"expression":"` + strings.Repeat("1+", 600) + `1"}}`
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleTool, Content: huge, ToolCallID: "call_1"},
+		{Role: schema.RoleAssistant, Content: "sorry"},
+	}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}, MaxToolArgsBytes: 1024})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if len(calc.calls) != 0 {
+		t.Fatalf("tool should not run with an oversized payload, got %d calls", len(calc.calls))
+	}
+	obs := model.history[1][2]
+	if obs.Role != schema.RoleTool || obs.ToolCallID != "call_1" || !strings.Contains(obs.Content, "arguments too large") {
+		t.Fatalf("observation should report the size limit, got %+v", obs)
+	}
+}
+
+func TestUnknownToolIsFedBackUntilRetriesRunOut(t *testing.T) {
+	ctx := context.Background()
+	bogus := func(id string) *schema.Message {
+		return &schema.Message{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: id, Function: schema.FunctionCall{Name: "calculater"}}}}
+	}
+	model := &sequenceModel{replies: []*schema.Message{
+		bogus("call_1"),
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_2", Function: schema.FunctionCall{Name: "calculator"}}}},
+		{Role: schema.RoleAssistant, Content: "4"},
+	}}
+	calc := &recordingTool{name: "calculator"}
+	var unknown []string
+	m := newRecordingMetrics()
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:   model,
+		Tools:   []tool.Tool{calc, &recordingTool{name: "search"}},
+		Metrics: m,
+		Callbacks: &agent.Callbacks{OnUnknownTool: func(ctx context.Context, info agent.CallbackInfo, call schema.ToolCall) {
+			unknown = append(unknown, call.Function.Name)
+		}},
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if res.Content != "4" || len(calc.calls) != 1 {
+		t.Fatalf("model should recover and call the real tool: %q, %d calls", res.Content, len(calc.calls))
+	}
+	observation := model.history[1][2]
+	if observation.ToolCallID != "call_1" || !strings.Contains(observation.Content, "available tools: calculator, search") {
+		t.Fatalf("observation should list available tools: %+v", observation)
+	}
+	if len(unknown) != 1 || unknown[0] != "calculater" || m.toolCalls["calculater:false"] != 1 {
+		t.Fatalf("unknown tool not reported: %v, %v", unknown, m.toolCalls)
+	}
+
+	// 超过重试次数后放弃
+	model = &sequenceModel{replies: []*schema.Message{bogus("call_1"), bogus("call_2"), bogus("call_3"), {Role: schema.RoleAssistant, Content: "never"}}}
+	reactAgent, err = agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, _ = reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if res.Content != "tool 'calculater' not found" || len(model.history) != 3 {
+		t.Fatalf("expected to give up after 2 retries, got %q after %d model calls", res.Content, len(model.history))
+	}
+}
+
+func TestGivingUpOnUnknownToolAnswersEveryCall(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{
+		{ID: "call_1", Function: schema.FunctionCall{Name: "calculater"}},
+		{ID: "call_2", Function: schema.FunctionCall{Name: "calculator", Arguments: "{}"}},
+	}}}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}, MaxUnknownToolRetries: -1})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if res.Content != "tool 'calculater' not found" {
+		t.Fatalf("expected to give up on the unknown tool, got %q", res.Content)
+	}
+
+	// 从保存的 State 恢复后，历史中的每个 tool_call 都有对应结果
+	data, err := state.Dump(agent.DumpOptions{})
+	if err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	model = &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "4"}}}
+	resumed, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if err := resumed.LoadState(data); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if _, err, _ := resumed.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "try again"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	answered := map[string]bool{}
+	var calls []string
+	for _, msg := range model.history[0] {
+		for _, call := range msg.ToolCalls {
+			calls = append(calls, call.ID)
+		}
+		if msg.Role == schema.RoleTool {
+			answered[msg.ToolCallID] = true
+		}
+	}
+	if len(calls) != 2 || !answered["call_1"] || !answered["call_2"] {
+		t.Fatalf("every tool call should have a result in the resumed history, calls %v, answered %v", calls, answered)
+	}
+	if len(calc.calls) != 1 {
+		t.Fatalf("the known call should still run, got %d calls", len(calc.calls))
+	}
+}
+
+type traceKey struct{}
+
+// contextProbeTool records the run ID and trace value it sees.
+type contextProbeTool struct {
+	runID, trace string
+}
+
+func (p *contextProbeTool) Info() tool.ToolInfo {
+	return tool.ToolInfo{Name: "probe", Desc: "records its context"}
+}
+
+func (p *contextProbeTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	p.runID = tool.RunIDFromContext(ctx)
+	p.trace, _ = ctx.Value(traceKey{}).(string)
+	return "ok", nil
+}
+
+func TestToolContextCarriesRunIDAndTrace(t *testing.T) {
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "probe"}}}},
+		{Role: schema.RoleAssistant, Content: "done"},
+	}}
+	probe := &contextProbeTool{}
+	reactAgent, err := agent.NewReactAgent(context.Background(), &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{probe}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), traceKey{}, "trace-123")
+	_, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if probe.runID == "" || probe.runID != state.RunID {
+		t.Fatalf("tool saw run ID %q, want %q", probe.runID, state.RunID)
+	}
+	if probe.trace != "trace-123" {
+		t.Fatalf("tracing value not propagated: %q", probe.trace)
+	}
+}
+
+// malformedTool declares an array parameter without element info.
+type malformedTool struct{ recordingTool }
+
+func (m *malformedTool) Info() tool.ToolInfo {
+	return tool.ToolInfo{Name: "broken", Parameters: map[string]*tool.ParameterInfo{
+		"ids": {Name: "ids", Type: tool.Array},
+	}}
+}
+
+func TestNewReactAgentRejectsMalformedToolInfo(t *testing.T) {
+	_, err := agent.NewReactAgent(context.Background(), &agent.ReactAgentConfig{
+		Model: &sequenceModel{},
+		Tools: []tool.Tool{&malformedTool{}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "array requires ElemInfo") {
+		t.Fatalf("expected malformed tool to be rejected, got %v", err)
+	}
+}
+
+func TestStreamUsesModelFinalMessage(t *testing.T) {
+	ctx := context.Background()
+	model := &scriptedModel{streams: [][]*schema.Message{{
+		{Role: schema.RoleAssistant, Content: "Hel"},
+		{Role: schema.RoleAssistant, Content: "lo"},
+		{Role: schema.RoleAssistant, Content: "Hello", Final: true, ResponseMeta: &schema.ResponseMeta{FinishReason: "stop"}},
+	}}}
+	var ended *schema.Message
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Callbacks: &agent.Callbacks{
+		OnModelEnd: func(ctx context.Context, info agent.CallbackInfo, msg *schema.Message) { ended = msg },
+	}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+
+	msgs, errs := reactAgent.Stream(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "hi"}})
+	var content string
+	for m := range msgs {
+		if m.Final {
+			t.Fatalf("model final message should not be forwarded: %+v", m)
+		}
+		content += m.Content
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if content != "Hello" {
+		t.Fatalf("unexpected streamed content %q", content)
+	}
+	if ended == nil || ended.Final || ended.ResponseMeta == nil || ended.ResponseMeta.FinishReason != "stop" {
+		t.Fatalf("assembled message should come from the model's final message: %+v", ended)
+	}
+}
+
+func TestClarifyingQuestionNeedsUserInput(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, Content: "Question: which city do you mean?"},
+		{Role: schema.RoleAssistant, Content: "It is sunny in Paris."},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:          model,
+		NeedsUserInput: agent.ClarificationMarker("Question:"),
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	msg, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "weather?"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !msg.NeedsUserInput {
+		t.Fatalf("clarifying question should need user input: %+v", msg)
+	}
+	msg, err, _ = reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "Paris"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if msg.NeedsUserInput {
+		t.Fatalf("answer should not need user input: %+v", msg)
+	}
+
+	// 流式调用在增量之后补发带标记的完整消息
+	streamed := &scriptedModel{streams: [][]*schema.Message{{
+		{Role: schema.RoleAssistant, Content: "Question: "},
+		{Role: schema.RoleAssistant, Content: "which city?"},
+	}}}
+	reactAgent, err = agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:          streamed,
+		NeedsUserInput: agent.ClarificationMarker("Question:"),
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	msgs, errs := reactAgent.Stream(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "weather?"}})
+	var last *schema.Message
+	for m := range msgs {
+		last = m
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if last == nil || !last.Final || !last.NeedsUserInput || last.Content != "Question: which city?" {
+		t.Fatalf("stream should end with the tagged question, got %+v", last)
+	}
+}
+
+func TestToolCacheServesIdenticalCalls(t *testing.T) {
+	ctx := context.Background()
+	call := func(id, expr string) *schema.Message {
+		return &schema.Message{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: id, Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expression":"` + expr + `"}`}}}}
+	}
+	model := &sequenceModel{replies: []*schema.Message{
+		call("call_1", "2+2"),
+		call("call_2", "2+2"),
+		call("call_3", "3+3"),
+		{Role: schema.RoleAssistant, Content: "done"},
+		call("call_4", "2+2"),
+		{Role: schema.RoleAssistant, Content: "done again"},
+	}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:     model,
+		Tools:     []tool.Tool{calc},
+		ToolCache: tool.NewMemoryCache(time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	for _, q := range []string{"first run", "second run"} {
+		if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: q}}); err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+	}
+	if len(calc.calls) != 2 {
+		t.Fatalf("expected 2 executions (2+2 and 3+3), got %d: %v", len(calc.calls), calc.calls)
+	}
+	// 命中缓存的调用仍有对应的工具结果
+	history := model.history[2]
+	if history[4].ToolCallID != "call_2" || history[4].Content != `{"ok":true}` {
+		t.Fatalf("cached observation missing: %+v", history[4])
+	}
+}
+
+type mockExecutor struct {
+	names []string
+}
+
+func (e *mockExecutor) Execute(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	if name != "remote_search" {
+		return nil, agent.ErrToolNotFound
+	}
+	e.names = append(e.names, name)
+	return map[string]interface{}{"hits": args["q"]}, nil
+}
+
+// lookupExecutor is a mockExecutor that also implements agent.ToolLookup.
+type lookupExecutor struct {
+	mockExecutor
+}
+
+func (e *lookupExecutor) HasTool(name string) bool {
+	return name == "remote_search"
+}
+
+func TestToolExecutorRoutesCalls(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{
+			{ID: "call_1", Function: schema.FunctionCall{Name: "remote_search", Arguments: `{"q":"go"}`}},
+			{ID: "call_2", Function: schema.FunctionCall{Name: "missing"}},
+		}},
+		{Role: schema.RoleAssistant, Content: "done"},
+	}}
+	local := &recordingTool{name: "calculator"}
+	executor := &mockExecutor{}
+	var unknown, ended []string
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:        model,
+		Tools:        []tool.Tool{local},
+		ToolExecutor: executor,
+		Callbacks: &agent.Callbacks{
+			OnUnknownTool: func(ctx context.Context, info agent.CallbackInfo, call schema.ToolCall) {
+				unknown = append(unknown, call.Function.Name)
+			},
+			OnToolEnd: func(ctx context.Context, info agent.CallbackInfo, call schema.ToolCall, observation string) {
+				ended = append(ended, call.Function.Name)
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "search go"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if res.Content != "done" || len(executor.names) != 1 || len(local.calls) != 0 {
+		t.Fatalf("call should go through the executor: %q, %v, %d local calls", res.Content, executor.names, len(local.calls))
+	}
+	history := model.history[1]
+	if history[2].ToolCallID != "call_1" || history[2].Content != `{"hits":"go"}` {
+		t.Fatalf("unexpected executor observation: %+v", history[2])
+	}
+	// 执行器不认识的工具按未注册工具处理
+	if history[3].ToolCallID != "call_2" || !strings.Contains(history[3].Content, "not found") || len(unknown) != 1 {
+		t.Fatalf("ErrToolNotFound should mark the call unknown: %+v, %v", history[3], unknown)
+	}
+	// 未知工具不触发 OnToolEnd，也不计入工具统计
+	if len(ended) != 1 || ended[0] != "remote_search" || state.Stats.ToolCalls != 1 {
+		t.Fatalf("unknown call reached tool end or stats: ended %v, %d tool calls", ended, state.Stats.ToolCalls)
+	}
+}
+
+func TestToolLookupSkipsCallbacksForUnknownTools(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{
+			{ID: "call_1", Function: schema.FunctionCall{Name: "remote_search", Arguments: `{"q":"go"}`}},
+			{ID: "call_2", Function: schema.FunctionCall{Name: "missing"}},
+		}},
+		{Role: schema.RoleAssistant, Content: "done"},
+	}}
+	executor := &lookupExecutor{}
+	var started, unknown []string
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:        model,
+		ToolExecutor: executor,
+		Callbacks: &agent.Callbacks{
+			OnToolStart: func(ctx context.Context, info agent.CallbackInfo, call schema.ToolCall) {
+				started = append(started, call.Function.Name)
+			},
+			OnUnknownTool: func(ctx context.Context, info agent.CallbackInfo, call schema.ToolCall) {
+				unknown = append(unknown, call.Function.Name)
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "search go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	// HasTool 提前识别未知工具，执行器不会被调用
+	if len(started) != 1 || started[0] != "remote_search" || len(unknown) != 1 || len(executor.names) != 1 {
+		t.Fatalf("started %v, unknown %v, executed %v", started, unknown, executor.names)
+	}
+}
+
+func TestResultPostProcessorShapesObservation(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "remote_search", Arguments: `{"q":"go"}`}}}},
+		{Role: schema.RoleAssistant, Content: "done"},
+	}}
+	var names []string
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:        model,
+		ToolExecutor: &mockExecutor{},
+		ResultPostProcessor: func(toolName string, result interface{}) interface{} {
+			names = append(names, toolName)
+			m := result.(map[string]interface{})
+			return map[string]interface{}{"count": len(m["hits"].(string))}
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "search"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	// 后处理去掉了 hits 字段，模型只看到处理后的结果
+	if obs := model.history[1][2]; obs.Content != `{"count":2}` {
+		t.Fatalf("observation = %q, want the post-processed result", obs.Content)
+	}
+	if len(names) != 1 || names[0] != "remote_search" {
+		t.Fatalf("post-processor called with %v", names)
+	}
+}
+
+// captureLogger records log lines as "LEVEL msg key=value ...".
+type captureLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *captureLogger) log(level, msg string, kv []any) {
+	line := level + " " + msg
+	for i := 0; i+1 < len(kv); i += 2 {
+		line += fmt.Sprintf(" %v=%v", kv[i], kv[i+1])
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, line)
+}
+
+func (l *captureLogger) Debug(msg string, kv ...any) { l.log("DEBUG", msg, kv) }
+func (l *captureLogger) Info(msg string, kv ...any)  { l.log("INFO", msg, kv) }
+func (l *captureLogger) Warn(msg string, kv ...any)  { l.log("WARN", msg, kv) }
+func (l *captureLogger) Error(msg string, kv ...any) { l.log("ERROR", msg, kv) }
+
+// has reports whether a line starts with prefix.
+func (l *captureLogger) has(prefix string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLoggerRecordsRunEvents(t *testing.T) {
+	ctx := agent.WithRunID(context.Background(), "run_log")
+	model := agenttest.NewChatModel(
+		agenttest.ToolCall("calculator", `{}`),
+		agenttest.ToolCall("broken", `{}`),
+		agenttest.Answer("done"),
+	)
+	logs := &captureLogger{}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:  model,
+		Tools:  []tool.Tool{&recordingTool{name: "calculator"}, &failingTool{name: "broken", err: errors.New("boom")}},
+		Logger: logs,
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	// 模型无回复可用时运行失败，记录为 ERROR
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "again"}}); err == nil {
+		t.Fatal("expected the second run to fail")
+	}
+
+	for _, want := range []string{
+		"INFO run start run_id=run_log messages=1",
+		"DEBUG step start run_id=run_log step=0",
+		"DEBUG model call run_id=run_log",
+		"INFO tool executed run_id=run_log tool=calculator",
+		"WARN tool failed run_id=run_log tool=broken",
+		"INFO run end run_id=run_log steps=3",
+		"ERROR run failed run_id=run_log step=0 error=" + agenttest.ErrNoMoreReplies.Error(),
+	} {
+		if !logs.has(want) {
+			t.Fatalf("missing log line %q in:\n%s", want, strings.Join(logs.lines, "\n"))
+		}
+	}
+
+	// 设置最低级别后不再输出 debug 日志
+	filtered := &captureLogger{}
+	logger := logging.WithMinLevel(filtered, logging.LevelInfo)
+	logger.Debug("step start")
+	logger.Warn("retrying")
+	if filtered.has("DEBUG") || !filtered.has("WARN retrying") {
+		t.Fatalf("unexpected filtered lines: %v", filtered.lines)
+	}
+}
+
+func TestGeneratePopulatesRunStats(t *testing.T) {
+	ctx := context.Background()
+	usage := func(total int) *schema.ResponseMeta {
+		return &schema.ResponseMeta{Usage: &schema.TokenUsage{TotalTokens: total}}
+	}
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ResponseMeta: usage(10), ToolCalls: []schema.ToolCall{
+			{ID: "call_1", Function: schema.FunctionCall{Name: "calculator"}},
+			{ID: "call_2", Function: schema.FunctionCall{Name: "calculator"}},
+		}},
+		{Role: schema.RoleAssistant, ResponseMeta: usage(15), ToolCalls: []schema.ToolCall{{ID: "call_3", Function: schema.FunctionCall{Name: "calculator"}}}},
+		{Role: schema.RoleAssistant, ResponseMeta: usage(20), Content: "done"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{&recordingTool{name: "calculator"}}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	_, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	stats := state.Stats
+	if stats.Steps != 3 || stats.ToolCalls != 3 || stats.TotalTokens != 45 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.Duration <= 0 || stats.ModelTime+stats.ToolTime > stats.Duration {
+		t.Fatalf("inconsistent timings: %+v", stats)
+	}
+	overhead := stats.ParseTime + stats.DispatchTime + stats.SerializeTime
+	if stats.ParseTime < 0 || stats.DispatchTime < 0 || stats.SerializeTime <= 0 || stats.ModelTime+stats.ToolTime+overhead > stats.Duration {
+		t.Fatalf("inconsistent stage timings: %+v", stats)
+	}
+}
+
+// loopModel answers every user message with toolCalls calculator calls, one
+// per step, then a final answer, so a run exercises the agent loop without
+// a network.
+type loopModel struct {
+	toolCalls int
+}
+
+func (m *loopModel) Generate(ctx context.Context, history []*schema.Message) (*schema.Message, error) {
+	done := 0
+	for i := len(history) - 1; i >= 0 && history[i].Role != schema.RoleUser; i-- {
+		if history[i].Role == schema.RoleTool {
+			done++
+		}
+	}
+	if done >= m.toolCalls {
+		return &schema.Message{Role: schema.RoleAssistant, Content: "Final Answer: 4"}, nil
+	}
+	return &schema.Message{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{
+		ID:       fmt.Sprintf("call_%d", done),
+		Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expression":"2+2","precision":2}`},
+	}}}, nil
+}
+
+func (m *loopModel) Stream(ctx context.Context, history []*schema.Message) (<-chan *schema.Message, <-chan error) {
+	panic("not used")
+}
+
+func (m *loopModel) BindTools(ctx context.Context, infos []*tool.ToolInfo) error {
+	return nil
+}
+
+// BenchmarkGenerateToolLoop measures the loop overhead of a run with five
+// tool calls against loopModel; the stage timings are reported per run.
+func BenchmarkGenerateToolLoop(b *testing.B) {
+	ctx := context.Background()
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model: &loopModel{toolCalls: 5},
+		Tools: []tool.Tool{calc},
+	})
+	if err != nil {
+		b.Fatalf("NewReactAgent failed: %v", err)
+	}
+	input := []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}}
+	var total agent.RunStats
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// 每次从空状态开始，避免历史增长影响测量
+		reactAgent.SetState(&agent.State{})
+		calc.calls = nil
+		_, err, state := reactAgent.Generate(ctx, input)
+		if err != nil {
+			b.Fatalf("Generate failed: %v", err)
+		}
+		total.ParseTime += state.Stats.ParseTime
+		total.DispatchTime += state.Stats.DispatchTime
+		total.SerializeTime += state.Stats.SerializeTime
+	}
+	b.ReportMetric(float64(total.ParseTime.Nanoseconds())/float64(b.N), "parse-ns/run")
+	b.ReportMetric(float64(total.DispatchTime.Nanoseconds())/float64(b.N), "dispatch-ns/run")
+	b.ReportMetric(float64(total.SerializeTime.Nanoseconds())/float64(b.N), "serialize-ns/run")
+}
+
+func TestAutoContinueOnLength(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, Content: "The answer is fo", ResponseMeta: &schema.ResponseMeta{FinishReason: "length", Usage: &schema.TokenUsage{TotalTokens: 10}}},
+		{Role: schema.RoleAssistant, Content: "rty-two.", ResponseMeta: &schema.ResponseMeta{FinishReason: "stop", Usage: &schema.TokenUsage{TotalTokens: 14}}},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, AutoContinueOnLength: true})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "answer"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if res.Content != "The answer is forty-two." || res.ResponseMeta.FinishReason != "stop" || res.ResponseMeta.Usage.TotalTokens != 24 {
+		t.Fatalf("continuation not joined: %q, %+v", res.Content, res.ResponseMeta)
+	}
+	// 第二次调用应带上截断的 assistant 消息
+	second := model.history[1]
+	if last := second[len(second)-1]; last.Role != schema.RoleAssistant || last.Content != "The answer is fo" {
+		t.Fatalf("partial answer not sent back: %+v", last)
+	}
+	msgs := state.Messages()
+	if len(msgs) != 2 || msgs[1].Content != res.Content {
+		t.Fatalf("state should hold the joined answer only: %+v", msgs)
+	}
+
+	// 关闭时保留截断结果
+	model = &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, Content: "The answer is fo", ResponseMeta: &schema.ResponseMeta{FinishReason: "length"}},
+	}}
+	reactAgent, err = agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if res, _, _ = reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "answer"}}); res.Content != "The answer is fo" || len(model.history) != 1 {
+		t.Fatalf("should not continue when disabled: %q after %d calls", res.Content, len(model.history))
+	}
+}
+
+func TestAssistantMessageWithContentAndToolCallsContinues(t *testing.T) {
+	ctx := context.Background()
+	mixed := func() *schema.Message {
+		return &schema.Message{Role: schema.RoleAssistant, Content: "Let me calculate that first.", ToolCalls: []schema.ToolCall{
+			{ID: "call_1", Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expression":"2+2"}`}},
+		}}
+	}
+	model := &sequenceModel{replies: []*schema.Message{mixed(), {Role: schema.RoleAssistant, Content: "The answer is 4."}}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "What is 2 + 2?"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if res.Content != "The answer is 4." || len(calc.calls) != 1 {
+		t.Fatalf("mixed message should run its tool and continue: %q, %d calls", res.Content, len(calc.calls))
+	}
+	// 说明文字与工具调用一起保留在历史中
+	recorded := model.history[1][1]
+	if recorded.Content != "Let me calculate that first." || len(recorded.ToolCalls) != 1 {
+		t.Fatalf("mixed message not recorded as is: %+v", recorded)
+	}
+
+	streaming := &scriptedModel{streams: [][]*schema.Message{
+		{
+			{Role: schema.RoleAssistant, Content: "Let me calculate that first."},
+			{Role: schema.RoleAssistant, ToolCalls: mixed().ToolCalls},
+		},
+		{{Role: schema.RoleAssistant, Content: "The answer is 4."}},
+	}}
+	calc = &recordingTool{name: "calculator"}
+	reactAgent, err = agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: streaming, Tools: []tool.Tool{calc}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	msgs, errs := reactAgent.Stream(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "What is 2 + 2?"}})
+	var last *schema.Message
+	for m := range msgs {
+		last = m
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(calc.calls) != 1 || last == nil || last.Content != "The answer is 4." {
+		t.Fatalf("streamed mixed message should run its tool and continue: %d calls, last %+v", len(calc.calls), last)
+	}
+}
+
+// delayTool answers with its name after a delay and records when it finished.
+type delayTool struct {
+	name     string
+	delay    time.Duration
+	mu       *sync.Mutex
+	finished *[]string
+}
+
+func (d *delayTool) Info() tool.ToolInfo {
+	return tool.ToolInfo{Name: d.name, Desc: "answers after a delay"}
+}
+
+func (d *delayTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	time.Sleep(d.delay)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	*d.finished = append(*d.finished, d.name)
+	return d.name, nil
+}
+
+func TestParallelToolResultsKeepCallOrder(t *testing.T) {
+	ctx := context.Background()
+	var (
+		mu       sync.Mutex
+		finished []string
+	)
+	tools := []tool.Tool{
+		&delayTool{name: "slow", delay: 80 * time.Millisecond, mu: &mu, finished: &finished},
+		&delayTool{name: "medium", delay: 40 * time.Millisecond, mu: &mu, finished: &finished},
+		&delayTool{name: "fast", mu: &mu, finished: &finished},
+	}
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{
+			{ID: "call_a", Function: schema.FunctionCall{Name: "slow"}},
+			{ID: "call_b", Function: schema.FunctionCall{Name: "medium"}},
+			{ID: "call_c", Function: schema.FunctionCall{Name: "fast"}},
+		}},
+		{Role: schema.RoleAssistant, Content: "done"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: tools, ParallelToolCalls: true})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	start := time.Now()
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 120*time.Millisecond {
+		t.Fatalf("tools should run concurrently, took %s", elapsed)
+	}
+	if strings.Join(finished, ",") != "fast,medium,slow" {
+		t.Fatalf("tools should complete out of order, got %v", finished)
+	}
+
+	history := model.history[1]
+	want := []struct{ id, content string }{{"call_a", `"slow"`}, {"call_b", `"medium"`}, {"call_c", `"fast"`}}
+	for i, w := range want {
+		m := history[2+i]
+		if m.Role != schema.RoleTool || m.ToolCallID != w.id || m.Content != w.content {
+			t.Fatalf("result %d = %+v, want %s with %s", i, m, w.id, w.content)
+		}
+	}
+}
+
+type tenantConfig struct{ Name string }
+
+// dependencyTool answers with the tenant injected through the tool context.
+type dependencyTool struct{}
+
+func (dependencyTool) Info() tool.ToolInfo {
+	return tool.ToolInfo{Name: "whoami", Desc: "reports the tenant"}
+}
+
+func (dependencyTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	tenant, ok := tool.Dependency[*tenantConfig](ctx)
+	if !ok {
+		return nil, errors.New("tenant not injected")
+	}
+	return tenant.Name, nil
+}
+
+func TestToolContextInjectsDependencies(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "whoami"}}}},
+		{Role: schema.RoleAssistant, Content: "done"},
+	}}
+	tenant := &tenantConfig{Name: "acme"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{dependencyTool{}}},
+		agent.WithToolContext(func(ctx context.Context) context.Context {
+			return tool.WithDependency(ctx, tenant)
+		}))
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "who am I?"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if got := model.history[1][2].Content; got != `"acme"` {
+		t.Fatalf("tool should read the injected tenant, got %s", got)
+	}
+	if _, ok := tool.Dependency[*tenantConfig](ctx); ok {
+		t.Fatal("the caller's context must not be changed")
+	}
+}
+
+func TestFinalAnswerTakesPrecedenceOverToolCalls(t *testing.T) {
+	ctx := context.Background()
+	withCalls := func(content string) *schema.Message {
+		return &schema.Message{Role: schema.RoleAssistant, Content: content, ToolCalls: []schema.ToolCall{
+			{ID: "call_1", Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expression":"2+2"}`}},
+		}}
+	}
+	model := &sequenceModel{replies: []*schema.Message{withCalls("Thought: I know this.\nFinal Answer: 4")}}
+	calc := &recordingTool{name: "calculator"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, Tools: []tool.Tool{calc}})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	res, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if !strings.Contains(res.Content, "Final Answer: 4") || len(calc.calls) != 0 || len(model.history) != 1 {
+		t.Fatalf("final answer should stop the run: %q, %d tool calls, %d model calls", res.Content, len(calc.calls), len(model.history))
+	}
+	if last := state.Messages()[1]; len(last.ToolCalls) != 0 {
+		t.Fatalf("dropped tool calls should not stay in the history: %+v", last)
+	}
+
+	// 自定义判定
+	model = &sequenceModel{replies: []*schema.Message{withCalls("DONE: 4")}}
+	reactAgent, err = agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:         model,
+		Tools:         []tool.Tool{calc},
+		IsFinalAnswer: func(msg *schema.Message) bool { return strings.HasPrefix(msg.Content, "DONE:") },
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if res, _, _ = reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}}); res.Content != "DONE: 4" || len(calc.calls) != 0 {
+		t.Fatalf("custom hook should stop the run: %q, %d tool calls", res.Content, len(calc.calls))
+	}
+}
+
+// arrayTool streams a JSON array of n numbered elements.
+type arrayTool struct{ n int }
+
+func (a arrayTool) Info() tool.ToolInfo {
+	return tool.ToolInfo{Name: "list", Desc: "lists items"}
+}
+
+func (a arrayTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return nil, errors.New("Execute should not be called on a streaming tool")
+}
+
+func (a arrayTool) ExecuteStream(ctx context.Context, params map[string]interface{}) (io.ReadCloser, error) {
+	items := make([]string, a.n)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"id":%d}`, i)
+	}
+	return io.NopCloser(strings.NewReader("[" + strings.Join(items, ",") + "]")), nil
+}
+
+func TestStreamingToolObservationIsCapped(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		n    int
+		want string
+	}{
+		{name: "fits", n: 2, want: `[{"id":0},{"id":1}]`},
+		{name: "truncated", n: 1000, want: `{"result":[{"id":0},{"id":1},{"id":2}],"truncated":true}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			model := &sequenceModel{replies: []*schema.Message{
+				{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "list"}}}},
+				{Role: schema.RoleAssistant, Content: "done"},
+			}}
+			reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+				Model:                       model,
+				Tools:                       []tool.Tool{arrayTool{n: tc.n}},
+				MaxStreamedObservationBytes: 32,
+			})
+			if err != nil {
+				t.Fatalf("NewReactAgent failed: %v", err)
+			}
+			if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "list"}}); err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if got := model.history[1][2].Content; got != tc.want {
+				t.Fatalf("observation = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestContentFilteredResponseIsAnError(t *testing.T) {
+	ctx := context.Background()
+	filtered := func() *schema.Message {
+		return &schema.Message{Role: schema.RoleAssistant, Content: "", ResponseMeta: &schema.ResponseMeta{
+			FinishReason:       schema.FinishContentFilter,
+			FilteredCategories: []string{"violence"},
+		}}
+	}
+	model := &sequenceModel{replies: []*schema.Message{filtered()}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	_, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "something bad"}})
+	var cfErr *agent.ContentFilterError
+	if !errors.Is(err, agent.ErrContentFiltered) || !errors.As(err, &cfErr) || len(cfErr.Categories) != 1 || cfErr.Categories[0] != "violence" {
+		t.Fatalf("expected a content filter error with categories, got %v", err)
+	}
+	if msgs := state.Messages(); len(msgs) != 1 {
+		t.Fatalf("filtered reply should not be recorded as an answer: %+v", msgs)
+	}
+
+	streaming := &scriptedModel{streams: [][]*schema.Message{{{Role: schema.RoleAssistant, Final: true, ResponseMeta: filtered().ResponseMeta}}}}
+	reactAgent, err = agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: streaming})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	msgs, errs := reactAgent.Stream(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "something bad"}})
+	for m := range msgs {
+		t.Fatalf("no message expected, got %+v", m)
+	}
+	if err := <-errs; !errors.Is(err, agent.ErrContentFiltered) {
+		t.Fatalf("expected ErrContentFiltered from Stream, got %v", err)
+	}
+}
+
+func TestEmptyResponseIsRetried(t *testing.T) {
+	ctx := context.Background()
+	empty := func() *schema.Message { return &schema.Message{Role: schema.RoleAssistant} }
+	model := &sequenceModel{replies: []*schema.Message{
+		empty(),
+		{Role: schema.RoleAssistant, Content: "Final Answer: 4"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, ErrorOnEmptyResponse: true})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	msg, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}})
+	if err != nil || msg.Content != "Final Answer: 4" {
+		t.Fatalf("expected the real answer after a retry, got %+v, %v", msg, err)
+	}
+	if len(model.history) != 2 {
+		t.Fatalf("expected 2 model calls, got %d", len(model.history))
+	}
+	// 空回复不记入历史
+	if msgs := state.Messages(); len(msgs) != 2 {
+		t.Fatalf("empty reply should not be recorded: %+v", msgs)
+	}
+
+	model = &sequenceModel{replies: []*schema.Message{empty(), empty(), empty()}}
+	reactAgent, err = agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, ErrorOnEmptyResponse: true})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "2+2?"}}); !errors.Is(err, agent.ErrEmptyResponse) {
+		t.Fatalf("expected ErrEmptyResponse, got %v", err)
+	}
+	if len(model.history) != 3 {
+		t.Fatalf("expected the first call and 2 retries, got %d calls", len(model.history))
+	}
+}
+
+func TestFewShotExamplesReachModelOnly(t *testing.T) {
+	ctx := context.Background()
+	examples := []*schema.Message{
+		{Role: schema.RoleUser, Content: "example: record hi"},
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "ex_1", Function: schema.FunctionCall{Name: "recorder", Arguments: `{"text":"hi"}`}}}},
+		{Role: schema.RoleTool, ToolCallID: "ex_1", Content: `{"ok":true}`},
+		{Role: schema.RoleAssistant, Content: "Final Answer: recorded"},
+	}
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "recorder", Arguments: `{"text":"bye"}`}}}},
+		{Role: schema.RoleAssistant, Content: "Final Answer: recorded"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:        model,
+		Tools:        []tool.Tool{&recordingTool{name: "recorder"}},
+		SystemPrompt: "use tools",
+		FewShot:      examples,
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	_, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "record bye"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	// 每次调用都在系统提示之后、对话之前带上示例
+	for i, sent := range model.history {
+		if len(sent) < 2+len(examples) || sent[0].Content != "use tools" {
+			t.Fatalf("call %d: unexpected history %+v", i, sent)
+		}
+		for j, ex := range examples {
+			if sent[1+j] != ex {
+				t.Fatalf("call %d: example %d missing, got %+v", i, j, sent[1+j])
+			}
+		}
+		if sent[1+len(examples)].Content != "record bye" {
+			t.Fatalf("call %d: conversation should follow the examples, got %+v", i, sent[1+len(examples)])
+		}
+	}
+	for _, msg := range state.Messages() {
+		for _, ex := range examples {
+			if msg == ex {
+				t.Fatalf("examples should not be recorded in the State: %+v", msg)
+			}
+		}
+	}
+	if msgs := state.Messages(); len(msgs) != 5 {
+		t.Fatalf("expected system, user, call, result and answer, got %d messages", len(msgs))
+	}
+}
+
+func TestMergeSystemMessagesSendsOne(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "done"}}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:               model,
+		SystemPrompt:        "be brief",
+		MergeSystemMessages: true,
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	_, err, state := reactAgent.Generate(ctx, []*schema.Message{
+		{Role: schema.RoleSystem, Content: "answer in French"},
+		{Role: schema.RoleSystem, Content: "be brief"},
+		{Role: schema.RoleUser, Content: "hi"},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	sent := model.history[0]
+	if len(sent) != 2 || sent[0].Role != schema.RoleSystem || sent[1].Content != "hi" {
+		t.Fatalf("want one system message then the user message, got %+v", sent)
+	}
+	if want := "be brief\n\nanswer in French"; sent[0].Content != want {
+		t.Fatalf("merged system content = %q, want %q", sent[0].Content, want)
+	}
+	// State 保留原始的系统消息
+	if n := len(state.Messages()); n != 5 {
+		t.Fatalf("state should keep every message, got %d", n)
+	}
+}
+
+func TestStepDelayPacesTheLoop(t *testing.T) {
+	ctx := context.Background()
+	call := func(id string) *schema.Message {
+		return &schema.Message{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: id, Function: schema.FunctionCall{Name: "calculator"}}}}
+	}
+	model := &sequenceModel{replies: []*schema.Message{call("call_1"), call("call_2"), {Role: schema.RoleAssistant, Content: "done"}}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:     model,
+		Tools:     []tool.Tool{&recordingTool{name: "calculator"}},
+		StepDelay: 30 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	start := time.Now()
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	// 三次模型调用之间暂停两次
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Fatalf("run took %v, want at least two delays", elapsed)
+	}
+
+	model = &sequenceModel{replies: []*schema.Message{call("call_1"), {Role: schema.RoleAssistant, Content: "done"}}}
+	reactAgent, err = agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:     model,
+		Tools:     []tool.Tool{&recordingTool{name: "calculator"}},
+		StepDelay: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err, _ = reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the delay to end with the context, got %v", err)
+	}
+	if len(model.history) != 1 {
+		t.Fatalf("model should not be called after the cancelled delay, got %d calls", len(model.history))
+	}
+}
+
+// typedTool declares the shape of its result.
+type typedTool struct{ recordingTool }
+
+func (t *typedTool) Info() tool.ToolInfo {
+	info := t.recordingTool.Info()
+	info.ReturnSchema = &tool.ParameterInfo{Name: "result", Type: tool.Object, SubInfo: map[string]*tool.ParameterInfo{
+		"ok": {Name: "ok", Type: tool.Boolean, Desc: "whether the call succeeded", Required: true},
+	}}
+	return info
+}
+
+func TestReturnSchemaIsIncludedInObservation(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{
+			{ID: "call_1", Function: schema.FunctionCall{Name: "typed"}},
+			{ID: "call_2", Function: schema.FunctionCall{Name: "plain"}},
+		}},
+		{Role: schema.RoleAssistant, Content: "done"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:               model,
+		Tools:               []tool.Tool{&typedTool{recordingTool{name: "typed"}}, &recordingTool{name: "plain"}},
+		IncludeReturnSchema: true,
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	if _, err, _ := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "go"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	sent := model.history[1]
+	want := `{"result":{"ok":true},"result_schema":{"properties":{"ok":{"description":"whether the call succeeded","type":"boolean"}},"required":["ok"],"type":"object"}}`
+	if sent[2].Content != want {
+		t.Fatalf("typed observation = %s, want %s", sent[2].Content, want)
+	}
+	// 未声明返回结构的工具结果保持不变
+	if sent[3].Content != `{"ok":true}` {
+		t.Fatalf("plain observation = %s", sent[3].Content)
+	}
+}
+
+func TestMaxInputBytesRejectsOversizedInput(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "done"}}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model, MaxInputBytes: 1024})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	input := []*schema.Message{
+		{Role: schema.RoleSystem, Content: "be brief"},
+		{Role: schema.RoleUser, Content: strings.Repeat("x", 2048)},
+	}
+	_, err, state := reactAgent.Generate(ctx, input)
+	if !errors.Is(err, agent.ErrInputTooLarge) {
+		t.Fatalf("expected ErrInputTooLarge, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "2056 bytes exceed MaxInputBytes 1024") || !strings.Contains(err.Error(), "message 1 (user, 2048 bytes)") {
+		t.Fatalf("error should describe the oversized input: %v", err)
+	}
+	if len(model.history) != 0 || len(state.Messages()) != 0 {
+		t.Fatal("oversized input should be rejected before the model call")
+	}
+
+	msgs, errs := reactAgent.Stream(ctx, input)
+	for range msgs {
+	}
+	if err := <-errs; !errors.Is(err, agent.ErrInputTooLarge) {
+		t.Fatalf("Stream: expected ErrInputTooLarge, got %v", err)
+	}
+
+	if _, err, _ := reactAgent.Generate(ctx, input[:1]); err != nil {
+		t.Fatalf("input within the limit should pass: %v", err)
+	}
+}
+
+func TestAskSendsQuestionAsUserMessage(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, Content: "4"},
+		{Role: schema.RoleAssistant, Content: "8"},
+	}}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{Model: model})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	msg, err := reactAgent.Ask(ctx, "2+2?")
+	if err != nil || msg.Content != "4" {
+		t.Fatalf("Ask = %v, %v", msg, err)
+	}
+	if _, err := reactAgent.Ask(ctx, "times two?"); err != nil {
+		t.Fatalf("Ask failed: %v", err)
+	}
+	// 第二次提问延续同一会话
+	sent := model.history[1]
+	if len(sent) != 3 || sent[0].Content != "2+2?" || sent[2].Role != schema.RoleUser || sent[2].Content != "times two?" {
+		t.Fatalf("unexpected history %+v", sent)
+	}
 }
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reAct-agent/schema"
+	"regexp"
+	"strings"
+)
+
+// RedactionRule replaces every match of Pattern with Placeholder.
+type RedactionRule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Placeholder string
+}
+
+// DefaultRedactionRules returns rules for credit-card-like numbers, email
+// addresses and phone numbers, in that order so card numbers are not taken
+// for phone numbers. The patterns favor recall over precision: any run of
+// 13-19 digits counts as a card number.
+func DefaultRedactionRules() []RedactionRule {
+	return []RedactionRule{
+		{
+			Name:        "credit_card",
+			Pattern:     regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+			Placeholder: "[CREDIT_CARD]",
+		},
+		{
+			Name:        "email",
+			Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+			Placeholder: "[EMAIL]",
+		},
+		{
+			// 带分隔符、区号或国家码的号码，以及 11 位手机号
+			Name:        "phone",
+			Pattern:     regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?|\b\d{2,4}[ .-])\d{3,4}[ .-]?\d{4}\b|\b1[3-9]\d{9}\b`),
+			Placeholder: "[PHONE]",
+		},
+	}
+}
+
+// NewRedactor returns a MessageModifer that applies rules, in order, to the
+// content and tool call arguments of every message. Arguments that are valid
+// JSON have only their string values redacted, so numbers stay numbers and
+// the result is still valid JSON. Without rules it uses
+// DefaultRedactionRules. Messages are copied before they are changed, so the
+// agent's State keeps the originals while the model only sees the redacted
+// history.
+func NewRedactor(rules ...RedactionRule) MessageModifer {
+	if len(rules) == 0 {
+		rules = DefaultRedactionRules()
+	}
+	redact := func(s string) string {
+		for _, rule := range rules {
+			s = rule.Pattern.ReplaceAllLiteralString(s, rule.Placeholder)
+		}
+		return s
+	}
+	return func(ctx context.Context, msgs []*schema.Message) []*schema.Message {
+		out := make([]*schema.Message, len(msgs))
+		for i, msg := range msgs {
+			if msg == nil {
+				continue
+			}
+			c := cloneMessage(msg)
+			c.Content = redact(c.Content)
+			for j := range c.ToolCalls {
+				c.ToolCalls[j].Function.Arguments = redactArgs(c.ToolCalls[j].Function.Arguments, redact)
+			}
+			out[i] = c
+		}
+		return out
+	}
+}
+
+// redactArgs applies redact to the string values of JSON arguments and
+// encodes them again; arguments that are not valid JSON are redacted as text.
+func redactArgs(args string, redact func(string) string) string {
+	dec := json.NewDecoder(strings.NewReader(args))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return redact(args)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// 保留参数中的 <、>、& 原样，不转义为 \u003c 等
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(redactValue(v, redact)); err != nil {
+		return redact(args)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func redactValue(v interface{}, redact func(string) string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return redact(v)
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = redactValue(item, redact)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item, redact)
+		}
+	}
+	return v
+}
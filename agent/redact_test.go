@@ -0,0 +1,90 @@
+package agent_test
+
+import (
+	"context"
+	"reAct-agent/agent"
+	"reAct-agent/schema"
+	"reAct-agent/tool"
+	"regexp"
+	"testing"
+)
+
+func redactContent(redactor agent.MessageModifer, content string) string {
+	out := redactor(context.Background(), []*schema.Message{{Role: schema.RoleUser, Content: content}})
+	return out[0].Content
+}
+
+func TestRedactorDefaultRules(t *testing.T) {
+	redactor := agent.NewRedactor()
+	cases := []struct{ in, want string }{
+		{"mail me at jane.doe+work@example.co.uk today", "mail me at [EMAIL] today"},
+		{"card 4111 1111 1111 1111 expires soon", "card [CREDIT_CARD] expires soon"},
+		{"card 5500-0000-0000-0004", "card [CREDIT_CARD]"},
+		{"call 555-123-4567 or (555) 123-4567", "call [PHONE] or [PHONE]"},
+		{"call +1 555 123 4567", "call [PHONE]"},
+		{"手机 13812345678 联系", "手机 [PHONE] 联系"},
+		// 普通数字与日期保持不变
+		{"the answer is 12345678 on 2024-10-14", "the answer is 12345678 on 2024-10-14"},
+	}
+	for _, tc := range cases {
+		if got := redactContent(redactor, tc.in); got != tc.want {
+			t.Errorf("redact(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRedactorKeepsNumericArgumentsValid(t *testing.T) {
+	redactor := agent.NewRedactor()
+	msg := &schema.Message{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{
+		Name:      "lookup",
+		Arguments: `{"order_id":4111111111111111,"note":"card 4111 1111 1111 1111"}`,
+	}}}}
+	args := redactor(context.Background(), []*schema.Message{msg})[0].ToolCalls[0].Function.Arguments
+	if args != `{"note":"card [CREDIT_CARD]","order_id":4111111111111111}` {
+		t.Fatalf("only string values should be redacted, got %s", args)
+	}
+}
+
+func TestRedactorCustomRules(t *testing.T) {
+	redactor := agent.NewRedactor(agent.RedactionRule{
+		Name:        "employee_id",
+		Pattern:     regexp.MustCompile(`EMP-\d+`),
+		Placeholder: "[EMPLOYEE]",
+	})
+	if got := redactContent(redactor, "EMP-1234 wrote to a@b.io"); got != "[EMPLOYEE] wrote to a@b.io" {
+		t.Fatalf("custom rules should replace the defaults, got %q", got)
+	}
+}
+
+func TestRedactorKeepsOriginalsInState(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "recorder", Arguments: `{"to":"bob@example.com"}`}}}},
+		{Role: schema.RoleAssistant, Content: "Final Answer: sent"},
+	}}
+	rec := &recordingTool{name: "recorder"}
+	reactAgent, err := agent.NewReactAgent(ctx, &agent.ReactAgentConfig{
+		Model:           model,
+		Tools:           []tool.Tool{rec},
+		MessageModifier: agent.NewRedactor(),
+	})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	_, err, state := reactAgent.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "email bob@example.com"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	sent := model.history[1]
+	if sent[0].Content != "email [EMAIL]" || sent[1].ToolCalls[0].Function.Arguments != `{"to":"[EMAIL]"}` {
+		t.Fatalf("model should see redacted messages: %+v, %+v", sent[0], sent[1].ToolCalls)
+	}
+	msgs := state.Messages()
+	if msgs[0].Content != "email bob@example.com" || msgs[1].ToolCalls[0].Function.Arguments != `{"to":"bob@example.com"}` {
+		t.Fatalf("state should keep the originals: %+v, %+v", msgs[0], msgs[1].ToolCalls)
+	}
+	if len(rec.calls) != 1 || rec.calls[0]["to"] != "bob@example.com" {
+		t.Fatalf("tools should get the original arguments: %+v", rec.calls)
+	}
+}
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"reAct-agent/schema"
+	"time"
+)
+
+// DumpOptions controls what State.Dump writes.
+type DumpOptions struct {
+	// IncludeSystem keeps system messages in the dump. Dropping them saves
+	// space when the system prompt is large; LoadState re-injects the
+	// configured SystemPrompt. Summaries written by SummarizingMemory are
+	// kept either way, as they cannot be restored from the configuration.
+	IncludeSystem bool
+}
+
+// stateDump is the JSON layout written by State.Dump.
+type stateDump struct {
+	RunID          string            `json:"run_id,omitempty"`
+	Messages       []*schema.Message `json:"messages"`
+	SystemExcluded bool              `json:"system_excluded,omitempty"`
+}
+
+// NewState returns a State pre-seeded with messages, e.g. to resume from a
+// known history with ReactAgent.SetState. Messages are recorded as the
+// agent records its own, so they get CreatedAt and Seq when missing.
+func NewState(messages ...*schema.Message) *State {
+	s := &State{messages: make([]*schema.Message, 0, len(messages))}
+	s.append(messages...)
+	return s
+}
+
+// Messages returns a copy of the conversation history.
+func (s *State) Messages() []*schema.Message {
+	return append([]*schema.Message(nil), s.messages...)
+}
+
+// append records messages in the history, stamping CreatedAt and Seq on the
+// ones that lack them.
+func (s *State) append(msgs ...*schema.Message) {
+	for _, msg := range msgs {
+		if msg == nil {
+			continue
+		}
+		if msg.CreatedAt.IsZero() {
+			msg.CreatedAt = time.Now().Round(0)
+		}
+		if msg.Seq == 0 {
+			msg.Seq = s.seq + 1
+		}
+		s.seq = max(s.seq, msg.Seq)
+	}
+	s.messages = append(s.messages, msgs...)
+}
+
+// Fork returns a deep copy of the State: messages, tool calls and metadata
+// are copied, so continuing one fork (see ReactAgent.SetState) never changes
+// the other. It supports exploring alternative trajectories from one point.
+func (s *State) Fork() *State {
+	fork := &State{RunID: s.RunID, Stats: s.Stats, seq: s.seq, messages: make([]*schema.Message, len(s.messages))}
+	for i, msg := range s.messages {
+		fork.messages[i] = cloneMessage(msg)
+	}
+	return fork
+}
+
+func cloneMessage(msg *schema.Message) *schema.Message {
+	if msg == nil {
+		return nil
+	}
+	c := *msg
+	if msg.ToolCalls != nil {
+		c.ToolCalls = make([]schema.ToolCall, len(msg.ToolCalls))
+		for i, tc := range msg.ToolCalls {
+			if tc.Index != nil {
+				idx := *tc.Index
+				tc.Index = &idx
+			}
+			c.ToolCalls[i] = tc
+		}
+	}
+	if msg.ResponseMeta != nil {
+		meta := *msg.ResponseMeta
+		if meta.Usage != nil {
+			u := *meta.Usage
+			meta.Usage = &u
+		}
+		if meta.FilteredCategories != nil {
+			meta.FilteredCategories = append([]string(nil), meta.FilteredCategories...)
+		}
+		if meta.LogProbs != nil {
+			lp := schema.LogProbs{Content: make([]schema.TokenLogProb, len(meta.LogProbs.Content))}
+			for i, tok := range meta.LogProbs.Content {
+				tok.Bytes = append([]int64(nil), tok.Bytes...)
+				top := make([]schema.TopLogProb, len(tok.TopLogProbs))
+				for j, alt := range tok.TopLogProbs {
+					alt.Bytes = append([]int64(nil), alt.Bytes...)
+					top[j] = alt
+				}
+				if tok.TopLogProbs == nil {
+					top = nil
+				}
+				tok.TopLogProbs = top
+				lp.Content[i] = tok
+			}
+			meta.LogProbs = &lp
+		}
+		c.ResponseMeta = &meta
+	}
+	return &c
+}
+
+// SetState makes the agent continue from s, e.g. a State returned by Fork.
+func (r *ReactAgent) SetState(s *State) {
+	r.state = s
+}
+
+// Dump serializes the State as JSON so a conversation can be persisted and
+// resumed with ReactAgent.LoadState.
+func (s *State) Dump(opts DumpOptions) ([]byte, error) {
+	d := stateDump{RunID: s.RunID, Messages: make([]*schema.Message, 0, len(s.messages))}
+	for _, msg := range s.messages {
+		if msg.Role == schema.RoleSystem && !opts.IncludeSystem && !isSummary(msg) {
+			d.SystemExcluded = true
+			continue
+		}
+		d.Messages = append(d.Messages, msg)
+	}
+	return json.Marshal(d)
+}
+
+// LoadState replaces the agent's State with one produced by State.Dump.
+// When the dump was made without system messages, the configured
+// SystemPrompt is put back at the start of the history.
+func (r *ReactAgent) LoadState(data []byte) error {
+	var d stateDump
+	if err := json.Unmarshal(data, &d); err != nil {
+		return fmt.Errorf("failed to decode state: %w", err)
+	}
+	messages := make([]*schema.Message, 0, len(d.Messages)+1)
+	if d.SystemExcluded && r.systemPrompt() != "" {
+		messages = append(messages, r.systemMessage())
+	}
+	for _, msg := range d.Messages {
+		if msg == nil {
+			return fmt.Errorf("failed to decode state: null message")
+		}
+		messages = append(messages, msg)
+	}
+	r.state = &State{RunID: d.RunID, messages: messages}
+	for _, msg := range messages {
+		r.state.seq = max(r.state.seq, msg.Seq)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package agent_test
+
+import (
+	"context"
+	"reAct-agent/agent"
+	"reAct-agent/schema"
+	"reAct-agent/tool"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStateAgent(t *testing.T, model agent.ChatModel, prompt string, tools ...tool.Tool) *agent.ReactAgent {
+	t.Helper()
+	a, err := agent.NewReactAgent(context.Background(), &agent.ReactAgentConfig{Model: model, SystemPrompt: prompt, Tools: tools})
+	if err != nil {
+		t.Fatalf("NewReactAgent failed: %v", err)
+	}
+	return a
+}
+
+func TestStateDumpRoundTrip(t *testing.T) {
+	const prompt = "You are a very long system prompt."
+	for _, include := range []bool{true, false} {
+		name := map[bool]string{true: "include system", false: "exclude system"}[include]
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			model := &sequenceModel{replies: []*schema.Message{
+				{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Type: "function", Function: schema.FunctionCall{Name: "noop", Arguments: `{}`}}}},
+				{Role: schema.RoleAssistant, Content: "done"},
+			}}
+			a := newStateAgent(t, model, prompt, &recordingTool{name: "noop"})
+			_, err, state := a.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "hello"}})
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+
+			data, err := state.Dump(agent.DumpOptions{IncludeSystem: include})
+			if err != nil {
+				t.Fatalf("Dump failed: %v", err)
+			}
+			if strings.Contains(string(data), prompt) != include {
+				t.Fatalf("system prompt presence in dump should be %v: %s", include, data)
+			}
+
+			if len(state.Messages()) != 5 {
+				t.Fatalf("expected system, user, call, result and answer, got %d messages", len(state.Messages()))
+			}
+			restored := newStateAgent(t, &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "again"}}}, prompt)
+			if err := restored.LoadState(data); err != nil {
+				t.Fatalf("LoadState failed: %v", err)
+			}
+			_, err, loaded := restored.Generate(ctx, nil)
+			if err != nil {
+				t.Fatalf("Generate after load failed: %v", err)
+			}
+			got := withoutStamps(loaded.Messages())
+			want := withoutStamps(append(state.Messages(), &schema.Message{Role: schema.RoleAssistant, Content: "again"}))
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("history not restored:\ngot  %+v\nwant %+v", got, want)
+			}
+			if got[0].Role != schema.RoleSystem || got[0].Content != prompt {
+				t.Fatalf("system prompt missing after load: %+v", got[0])
+			}
+		})
+	}
+}
+
+func TestStateDumpKeepsSummaries(t *testing.T) {
+	const prompt = "You are a very long system prompt."
+	summary := &schema.Message{Role: schema.RoleSystem, Content: agent.SummaryPrefix + "The user asked about the weather."}
+	state := agent.NewState(
+		&schema.Message{Role: schema.RoleSystem, Content: prompt},
+		summary,
+		&schema.Message{Role: schema.RoleUser, Content: "and tomorrow?"},
+	)
+
+	data, err := state.Dump(agent.DumpOptions{})
+	if err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	if strings.Contains(string(data), prompt) {
+		t.Fatalf("system prompt should be dropped: %s", data)
+	}
+	restored := newStateAgent(t, &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "sunny"}}}, prompt)
+	if err := restored.LoadState(data); err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	_, err, loaded := restored.Generate(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Generate after load failed: %v", err)
+	}
+	got := withoutStamps(loaded.Messages())
+	want := withoutStamps(append(state.Messages(), &schema.Message{Role: schema.RoleAssistant, Content: "sunny"}))
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("summary not restored:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+// withoutStamps copies msgs with CreatedAt and Seq cleared, which differ for
+// messages recorded afresh.
+func withoutStamps(msgs []*schema.Message) []*schema.Message {
+	out := make([]*schema.Message, len(msgs))
+	for i, msg := range msgs {
+		m := *msg
+		m.CreatedAt, m.Seq = time.Time{}, 0
+		out[i] = &m
+	}
+	return out
+}
+
+func TestStateForkIsIndependent(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "noop", Arguments: `{}`}}}},
+		{Role: schema.RoleAssistant, Content: "done"},
+		{Role: schema.RoleAssistant, Content: "branch b"},
+	}}
+	a := newStateAgent(t, model, "", &recordingTool{name: "noop"})
+	_, err, state := a.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "hello"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	before := state.Messages()
+	fork := state.Fork()
+
+	// 修改一个分支的消息内容，并在其上继续对话
+	fork.Messages()[1].ToolCalls[0].Function.Name = "changed"
+	fork.Messages()[0].Content = "changed"
+	a.SetState(fork)
+	if _, err, _ := a.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "try b"}}); err != nil {
+		t.Fatalf("Generate on fork failed: %v", err)
+	}
+
+	if got := state.Messages(); len(got) != len(before) || !reflect.DeepEqual(got, before) {
+		t.Fatalf("original state changed by fork")
+	}
+	if state.Messages()[0].Content != "hello" || state.Messages()[1].ToolCalls[0].Function.Name != "noop" {
+		t.Fatalf("original messages mutated: %+v", state.Messages()[:2])
+	}
+	if n := len(fork.Messages()); n != len(before)+2 {
+		t.Fatalf("fork should have continued, has %d messages", n)
+	}
+}
+
+func TestStateForkCopiesResponseMeta(t *testing.T) {
+	state := agent.NewState(&schema.Message{Role: schema.RoleAssistant, Content: "hi", ResponseMeta: &schema.ResponseMeta{
+		FinishReason:       schema.FinishContentFilter,
+		FilteredCategories: []string{"violence"},
+		Usage:              &schema.TokenUsage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4},
+	}})
+	fork := state.Fork()
+
+	meta := fork.Messages()[0].ResponseMeta
+	meta.Usage.TotalTokens = 100
+	meta.FilteredCategories[0] = "changed"
+
+	orig := state.Messages()[0].ResponseMeta
+	if orig.Usage.TotalTokens != 4 || orig.FilteredCategories[0] != "violence" {
+		t.Fatalf("original metadata mutated through the fork: usage %+v, categories %v", orig.Usage, orig.FilteredCategories)
+	}
+}
+
+func TestMessagesAreStampedInOrder(t *testing.T) {
+	ctx := context.Background()
+	model := &sequenceModel{replies: []*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "call_1", Function: schema.FunctionCall{Name: "noop", Arguments: `{}`}}}},
+		{Role: schema.RoleAssistant, Content: "done"},
+		{Role: schema.RoleAssistant, Content: "again"},
+	}}
+	a := newStateAgent(t, model, "prompt", &recordingTool{name: "noop"})
+	if _, err, _ := a.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "hello"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	_, err, state := a.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "more"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	msgs := state.Messages()
+	if len(msgs) != 7 {
+		t.Fatalf("expected 7 messages, got %d", len(msgs))
+	}
+	for i, msg := range msgs {
+		if msg.Seq != int64(i+1) || msg.CreatedAt.IsZero() {
+			t.Fatalf("message %d not stamped: seq %d, created %v", i, msg.Seq, msg.CreatedAt)
+		}
+		if i > 0 && msg.CreatedAt.Before(msgs[i-1].CreatedAt) {
+			t.Fatalf("message %d created before its predecessor", i)
+		}
+	}
+
+	// 分叉后继续编号
+	fork := state.Fork()
+	a.SetState(fork)
+	model.replies = append(model.replies, &schema.Message{Role: schema.RoleAssistant, Content: "branch"})
+	_, _, forked := a.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "branch"}})
+	if last := forked.Messages()[8]; last.Seq != 9 {
+		t.Fatalf("fork should continue the sequence, got %d", last.Seq)
+	}
+}
+
+func TestNewStateSeedsHistory(t *testing.T) {
+	ctx := context.Background()
+	seed := []*schema.Message{
+		{Role: schema.RoleUser, Content: "My name is Ada."},
+		{Role: schema.RoleAssistant, Content: "Nice to meet you, Ada."},
+	}
+	state := agent.NewState(seed...)
+	if got := state.Messages(); len(got) != 2 || got[1].Seq != 2 {
+		t.Fatalf("unexpected seeded messages: %+v", got)
+	}
+
+	model := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "Your name is Ada."}}}
+	a := newStateAgent(t, model, "")
+	a.SetState(state)
+	res, err, after := a.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "What is my name?"}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if res.Content != "Your name is Ada." || len(model.history) != 1 {
+		t.Fatalf("unexpected answer %q after %d calls", res.Content, len(model.history))
+	}
+	sent := model.history[0]
+	if len(sent) != 3 || sent[0] != seed[0] || sent[1] != seed[1] {
+		t.Fatalf("model should see the seeded history first: %+v", sent)
+	}
+	if msgs := after.Messages(); len(msgs) != 4 || msgs[3].Seq != 4 {
+		t.Fatalf("run should continue the seeded state: %+v", msgs)
+	}
+
+	// Messages 返回副本，修改不影响 State
+	msgs := after.Messages()
+	msgs[0] = nil
+	if after.Messages()[0] == nil {
+		t.Fatal("Messages should return a copy")
+	}
+}
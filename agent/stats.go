@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"reAct-agent/schema"
+	"time"
+)
+
+// RunStats summarizes the performance of the most recent run, for logging
+// and dashboards. Generate and Stream populate it on the State as the loop
+// progresses.
+type RunStats struct {
+	// Duration is the wall time of the whole run.
+	Duration time.Duration
+	// Steps counts model calls.
+	Steps int
+	// ToolCalls counts executed tool calls, including those returning an
+	// error, but not calls rejected as unknown or with invalid arguments.
+	ToolCalls int
+	// TotalTokens sums the usage reported by the model across steps.
+	TotalTokens int
+	// ModelTime and ToolTime split the time spent waiting on the model and
+	// executing tools.
+	ModelTime time.Duration
+	ToolTime  time.Duration
+	// ParseTime, DispatchTime and SerializeTime measure the loop's own
+	// overhead around tool calls: decoding and validating arguments, routing
+	// a call to its tool (lookup, cache and callbacks), and encoding results
+	// as observations. None of them overlaps ModelTime or ToolTime.
+	ParseTime     time.Duration
+	DispatchTime  time.Duration
+	SerializeTime time.Duration
+}
+
+// toolTiming splits the time spent on one tool call.
+type toolTiming struct {
+	parse, exec, serialize time.Duration
+}
+
+// observeModel records one model step that took d and produced msg.
+func (s *RunStats) observeModel(d time.Duration, msg *schema.Message) {
+	s.Steps++
+	s.ModelTime += d
+	if msg != nil && msg.ResponseMeta != nil && msg.ResponseMeta.Usage != nil {
+		s.TotalTokens += msg.ResponseMeta.Usage.TotalTokens
+	}
+}
+
+// observeTool records one tool execution that took d.
+func (s *RunStats) observeTool(d time.Duration) {
+	s.ToolCalls++
+	s.ToolTime += d
+}
+
+// observeOverhead records the stages of one tool call that took total,
+// counting what is neither parsing, execution nor serialization as dispatch.
+func (s *RunStats) observeOverhead(t toolTiming, total time.Duration) {
+	s.ParseTime += t.parse
+	s.SerializeTime += t.serialize
+	if d := total - t.parse - t.exec - t.serialize; d > 0 {
+		s.DispatchTime += d
+	}
+}
@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"reAct-agent/schema"
+	"unicode/utf8"
+)
+
+// TokenCounter measures the size of a history in tokens, for budgeting and
+// history-trimming decisions such as SummarizingMemory. Plug in the model's
+// tokenizer for exact counts; HeuristicTokenCounter is the cheap default.
+type TokenCounter interface {
+	Count(messages []*schema.Message) (int, error)
+}
+
+// TokenCounterFunc adapts a function that cannot fail to a TokenCounter.
+type TokenCounterFunc func(messages []*schema.Message) int
+
+func (f TokenCounterFunc) Count(messages []*schema.Message) (int, error) {
+	return f(messages), nil
+}
+
+// HeuristicTokenCounter counts tokens with EstimateTokens. It needs no
+// tokenizer or network access and never fails.
+type HeuristicTokenCounter struct{}
+
+var _ TokenCounter = HeuristicTokenCounter{}
+
+func (HeuristicTokenCounter) Count(messages []*schema.Message) (int, error) {
+	return EstimateTokens(messages), nil
+}
+
+// EstimateTokens approximates a history's token count as one token per four
+// characters of content and tool-call arguments. It is cheap and offline.
+func EstimateTokens(messages []*schema.Message) int {
+	chars := 0
+	for _, msg := range messages {
+		chars += utf8.RuneCountInString(msg.Content)
+		for _, tc := range msg.ToolCalls {
+			chars += utf8.RuneCountInString(tc.Function.Name) + utf8.RuneCountInString(tc.Function.Arguments)
+		}
+	}
+	return (chars + 3) / 4
+}
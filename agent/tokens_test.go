@@ -0,0 +1,73 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"reAct-agent/agent"
+	"reAct-agent/schema"
+	"testing"
+)
+
+func TestHeuristicTokenCounter(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []*schema.Message
+		want     int
+	}{
+		{"empty", nil, 0},
+		{"four chars", []*schema.Message{{Role: schema.RoleUser, Content: "abcd"}}, 1},
+		{"rounds up", []*schema.Message{{Role: schema.RoleUser, Content: "abcde"}}, 2},
+		{"counts runes", []*schema.Message{{Role: schema.RoleUser, Content: "你好世界"}}, 1},
+		{"sums messages and tool calls", []*schema.Message{
+			{Role: schema.RoleUser, Content: "2+2?"},
+			{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Function: schema.FunctionCall{Name: "calc", Arguments: `{"e":"2+2"}`}}}},
+		}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := agent.HeuristicTokenCounter{}.Count(tt.messages)
+			if err != nil || got != tt.want {
+				t.Fatalf("Count = %d, %v; want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// countingCounter counts one token per message and records its calls.
+type countingCounter struct {
+	calls int
+	err   error
+}
+
+func (c *countingCounter) Count(messages []*schema.Message) (int, error) {
+	c.calls++
+	return len(messages), c.err
+}
+
+func TestSummarizingMemoryUsesTokenCounter(t *testing.T) {
+	summarizer := &sequenceModel{replies: []*schema.Message{{Role: schema.RoleAssistant, Content: "earlier turns"}}}
+	counter := &countingCounter{}
+	mem, err := agent.NewSummarizingMemory(&agent.SummarizingMemoryConfig{Model: summarizer, Threshold: 3, Counter: counter})
+	if err != nil {
+		t.Fatalf("NewSummarizingMemory failed: %v", err)
+	}
+	history := []*schema.Message{
+		{Role: schema.RoleUser, Content: "q1"},
+		{Role: schema.RoleAssistant, Content: "a1"},
+		{Role: schema.RoleUser, Content: "q2"},
+		{Role: schema.RoleAssistant, Content: "a2"},
+	}
+	got, err := mem.Compact(context.Background(), history)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	// 按消息条数计数时 4 条超过阈值，合并后为 3 条
+	if counter.calls == 0 || len(got) != 3 {
+		t.Fatalf("expected the counter to drive compaction, got %d calls and %d messages", counter.calls, len(got))
+	}
+
+	counter.err = errors.New("tokenizer unavailable")
+	if _, err := mem.Compact(context.Background(), history); !errors.Is(err, counter.err) {
+		t.Fatalf("expected the counter error, got %v", err)
+	}
+}
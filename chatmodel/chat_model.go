@@ -2,8 +2,12 @@ package chatmodel
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"reAct-agent/agent"
+	httpclient "reAct-agent/http_client"
 	"reAct-agent/schema"
 	"reAct-agent/tool"
 	"strings"
@@ -15,15 +19,48 @@ type ChatModelClient interface {
 	Stream(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo) (<-chan *schema.Message, <-chan error)
 }
 
+// Configurable is implemented by clients that accept connection settings
+// from a ChatModelConfig.
+type Configurable interface {
+	Configure(baseUrl, apiKey string, timeout time.Duration) error
+}
+
 type ChatModelConfig struct {
 	Client ChatModelClient
 
+	// Model names the model sent with every request unless a call overrides
+	// it with WithModel or GenerateOptions.Model. Required.
+	Model string
+	// APIKey, BaseUrl and Timeout are connection settings owned by the
+	// client. NewChatModel applies the ones that are set to clients that
+	// implement Configurable, overriding what the client was built with;
+	// for other clients APIKey is only checked to be present.
 	APIKey  string
-	Model   string
 	BaseUrl string
 	Timeout time.Duration
+
+	// ToolSelector, when set, narrows the bound tools per call, e.g. to the
+	// ones relevant to the latest user message.
+	ToolSelector ToolSelector
+	// MaxTools and MaxToolsBytes cap the number of tools and the size of
+	// the "tools" array, as sent on the wire, of one request; calls over
+	// either limit fail early with ErrTooManyTools instead of a provider 400.
+	// Zero means no limit.
+	MaxTools      int
+	MaxToolsBytes int
+
+	// ExtraParams holds vendor-specific request parameters, e.g.
+	// {"enable_thinking": false}, merged into every request of clients that
+	// support them, such as QWenModelClient. They override the client's
+	// own extras (QWenModelClient.Extra) and are overridden by parameters
+	// set for one call with WithExtraParams. They never replace a field the
+	// client sets itself, such as "model" or "messages".
+	ExtraParams map[string]interface{}
 }
 
+// ToolSelector picks the tools to send with a request from the bound ones.
+type ToolSelector func(history []*schema.Message, tools []*tool.ToolInfo) []*tool.ToolInfo
+
 var _ agent.ChatModel = (*ChatModel)(nil)
 
 // ChatModel represents a simple chat model that can generate responses
@@ -50,14 +87,16 @@ func NewChatModel(ctx context.Context, config *ChatModelConfig, opts ...ChatMode
 	if len(config.APIKey) == 0 {
 		return nil, errors.New("api key is required")
 	}
-	if config.Timeout == 0 {
-		config.Timeout = time.Minute
-	}
 	if len(config.BaseUrl) > 0 {
 		if !strings.HasSuffix(config.BaseUrl, "/") {
 			config.BaseUrl += "/"
 		}
 	}
+	if c, ok := config.Client.(Configurable); ok {
+		if err := c.Configure(config.BaseUrl, config.APIKey, config.Timeout); err != nil {
+			return nil, fmt.Errorf("failed to configure client: %w", err)
+		}
+	}
 
 	mdl := &ChatModel{conf: config, client: config.Client}
 	return mdl, nil
@@ -72,7 +111,12 @@ func (c *ChatModel) BindTools(ctx context.Context, infos []*tool.ToolInfo) error
 // Generate produces a basic assistant message. In real usage, this would
 // consult model logic and tool metadata.
 func (c *ChatModel) Generate(ctx context.Context, history []*schema.Message) (*schema.Message, error) {
-	msg, err := c.client.Generate(ctx, c.conf.Model, history, c.tools)
+	tools, err := c.selectTools(history)
+	if err != nil {
+		return nil, err
+	}
+	ctx = c.withExtraParams(ctx)
+	msg, err := c.client.Generate(ctx, c.model(ctx), history, tools)
 	if err != nil {
 		return nil, err
 	}
@@ -80,6 +124,217 @@ func (c *ChatModel) Generate(ctx context.Context, history []*schema.Message) (*s
 	return msg, nil
 }
 
+// GenerateOptions holds per-call settings for GenerateWithOptions and
+// StreamWithOptions.
+type GenerateOptions struct {
+	// Model, when set, replaces the model of this call. It takes precedence
+	// over a model carried by ctx (see WithModel), which takes precedence
+	// over ChatModelConfig.Model.
+	Model string
+	// Headers are added to the HTTP request of this call only, over the
+	// client's own headers.
+	Headers map[string]string
+	// User, when set, is sent as the end-user identifier of this call (see
+	// WithRequestUser).
+	User string
+}
+
+// withOptions attaches the options to ctx, where the HTTP client reads them.
+func (o GenerateOptions) withOptions(ctx context.Context) context.Context {
+	if len(o.Headers) > 0 {
+		ctx = httpclient.WithRequestHeaders(ctx, o.Headers)
+	}
+	if o.Model != "" {
+		ctx = WithModel(ctx, o.Model)
+	}
+	if o.User != "" {
+		ctx = WithRequestUser(ctx, o.User)
+	}
+	return ctx
+}
+
+type modelKey struct{}
+
+// WithModel returns a context whose ChatModel calls use model instead of
+// ChatModelConfig.Model, e.g. for gateways routing per request. Calls made
+// through an agent pick it up as well; GenerateOptions.Model still wins.
+func WithModel(ctx context.Context, model string) context.Context {
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+// ModelFromContext returns the model set with WithModel, or "".
+func ModelFromContext(ctx context.Context) string {
+	model, _ := ctx.Value(modelKey{}).(string)
+	return model
+}
+
+type requestUserKey struct{}
+
+// WithRequestUser returns a context whose model calls send user as the
+// end-user identifier ("user" field) instead of QWenModelClient.User, e.g.
+// a stable hash of the tenant's user ID. Calls made through an agent pick
+// it up as well.
+func WithRequestUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, requestUserKey{}, user)
+}
+
+// RequestUserFromContext returns the user set with WithRequestUser, or "".
+func RequestUserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(requestUserKey{}).(string)
+	return user
+}
+
+type extraParamsKey struct{}
+
+// WithExtraParams returns a context whose model calls merge params into the
+// request, over ChatModelConfig.ExtraParams and extras set by an outer
+// WithExtraParams.
+func WithExtraParams(ctx context.Context, params map[string]interface{}) context.Context {
+	return context.WithValue(ctx, extraParamsKey{}, mergeParams(ExtraParamsFromContext(ctx), params))
+}
+
+// ExtraParamsFromContext returns the parameters set with WithExtraParams, or
+// nil.
+func ExtraParamsFromContext(ctx context.Context) map[string]interface{} {
+	params, _ := ctx.Value(extraParamsKey{}).(map[string]interface{})
+	return params
+}
+
+// withExtraParams puts ChatModelConfig.ExtraParams under the per-call ones.
+func (c *ChatModel) withExtraParams(ctx context.Context) context.Context {
+	if len(c.conf.ExtraParams) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, extraParamsKey{}, mergeParams(c.conf.ExtraParams, ExtraParamsFromContext(ctx)))
+}
+
+// mergeParams returns a new map with the entries of base, then over.
+func mergeParams(base, over map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(over))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range over {
+		merged[k] = v
+	}
+	return merged
+}
+
+// model returns the model for one call.
+func (c *ChatModel) model(ctx context.Context) string {
+	if model := ModelFromContext(ctx); model != "" {
+		return model
+	}
+	return c.conf.Model
+}
+
+// GenerateWithOptions is Generate with per-call options. Calls made through
+// an agent can get the same headers by passing it a context built with
+// httpclient.WithRequestHeaders.
+func (c *ChatModel) GenerateWithOptions(ctx context.Context, history []*schema.Message, opts GenerateOptions) (*schema.Message, error) {
+	return c.Generate(opts.withOptions(ctx), history)
+}
+
+// StreamWithOptions is Stream with per-call options.
+func (c *ChatModel) StreamWithOptions(ctx context.Context, history []*schema.Message, opts GenerateOptions) (<-chan *schema.Message, <-chan error) {
+	return c.Stream(opts.withOptions(ctx), history)
+}
+
 func (c *ChatModel) Stream(ctx context.Context, history []*schema.Message) (<-chan *schema.Message, <-chan error) {
-	return c.client.Stream(ctx, c.conf.Model, history, c.tools)
+	tools, err := c.selectTools(history)
+	if err != nil {
+		msgs := make(chan *schema.Message)
+		errs := make(chan error, 1)
+		errs <- err
+		close(msgs)
+		close(errs)
+		return msgs, errs
+	}
+	ctx = c.withExtraParams(ctx)
+	return c.client.Stream(ctx, c.model(ctx), history, tools)
+}
+
+// selectTools applies the ToolSelector and enforces the tool limits.
+func (c *ChatModel) selectTools(history []*schema.Message) ([]*tool.ToolInfo, error) {
+	tools := c.tools
+	if c.conf.ToolSelector != nil {
+		tools = c.conf.ToolSelector(history, tools)
+	}
+	if c.conf.MaxTools > 0 && len(tools) > c.conf.MaxTools {
+		return nil, fmt.Errorf("%w: %d tools exceed the limit of %d: %s", ErrTooManyTools, len(tools), c.conf.MaxTools, toolNames(tools))
+	}
+	if c.conf.MaxToolsBytes > 0 {
+		// 按实际发送的 tools 数组计算大小
+		b, err := json.Marshal(toolDefinitions(tools))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode tools: %w", err)
+		}
+		if len(b) > c.conf.MaxToolsBytes {
+			return nil, fmt.Errorf("%w: %d bytes of tools exceed the limit of %d: %s", ErrTooManyTools, len(b), c.conf.MaxToolsBytes, toolNames(tools))
+		}
+	}
+	return tools, nil
+}
+
+func toolNames(tools []*tool.ToolInfo) string {
+	names := make([]string, len(tools))
+	for i, t := range tools {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// pinger is implemented by clients that support a cheap connectivity check.
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that the underlying client is reachable and authorized.
+func (c *ChatModel) Ping(ctx context.Context) error {
+	p, ok := c.client.(pinger)
+	if !ok {
+		return errors.New("client does not support ping")
+	}
+	return p.Ping(ctx)
+}
+
+// modelLister is implemented by clients that can list the available models.
+type modelLister interface {
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+}
+
+// ListModels returns the models offered by the underlying client.
+func (c *ChatModel) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	l, ok := c.client.(modelLister)
+	if !ok {
+		return nil, errors.New("client does not support listing models")
+	}
+	return l.ListModels(ctx)
+}
+
+// Close releases resources held by the underlying client when it implements
+// io.Closer. It is safe to call on clients that hold nothing.
+func (c *ChatModel) Close() error {
+	if closer, ok := c.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// splitSystem extracts the system messages for providers that take the
+// system prompt as a dedicated field. Several system messages are joined with
+// blank lines; the other messages keep their order.
+func splitSystem(messages []*schema.Message) (string, []*schema.Message) {
+	var (
+		system []string
+		rest   = make([]*schema.Message, 0, len(messages))
+	)
+	for _, msg := range messages {
+		if msg.Role == schema.RoleSystem {
+			system = append(system, msg.Content)
+			continue
+		}
+		rest = append(rest, msg)
+	}
+	return strings.Join(system, "\n\n"), rest
 }
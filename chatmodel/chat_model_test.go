@@ -0,0 +1,311 @@
+package chatmodel_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reAct-agent/chatmodel"
+	"reAct-agent/schema"
+	"reAct-agent/tool"
+	"strings"
+	"testing"
+	"time"
+)
+
+// toolRecordingClient records the tools sent with every call.
+type toolRecordingClient struct {
+	tools [][]*tool.ToolInfo
+}
+
+func (c *toolRecordingClient) Generate(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo) (*schema.Message, error) {
+	c.tools = append(c.tools, tools)
+	return &schema.Message{Role: schema.RoleAssistant, Content: "ok"}, nil
+}
+
+func (c *toolRecordingClient) Stream(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo) (<-chan *schema.Message, <-chan error) {
+	c.tools = append(c.tools, tools)
+	msgs := make(chan *schema.Message)
+	errs := make(chan error)
+	close(msgs)
+	close(errs)
+	return msgs, errs
+}
+
+func manyTools(n int) []*tool.ToolInfo {
+	infos := make([]*tool.ToolInfo, n)
+	for i := range infos {
+		infos[i] = &tool.ToolInfo{Name: fmt.Sprintf("tool_%02d", i), Desc: fmt.Sprintf("topic%d helper", i%10)}
+	}
+	return infos
+}
+
+func newToolChatModel(t *testing.T, client chatmodel.ChatModelClient, conf chatmodel.ChatModelConfig) *chatmodel.ChatModel {
+	t.Helper()
+	conf.Client, conf.APIKey, conf.Model = client, "test-key", "test-model"
+	m, err := chatmodel.NewChatModel(context.Background(), &conf)
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	return m
+}
+
+func TestToolSelectorNarrowsBoundTools(t *testing.T) {
+	client := &toolRecordingClient{}
+	m := newToolChatModel(t, client, chatmodel.ChatModelConfig{
+		MaxTools: 10,
+		// 只保留描述与最后一条消息主题相同的工具
+		ToolSelector: func(history []*schema.Message, tools []*tool.ToolInfo) []*tool.ToolInfo {
+			topic := history[len(history)-1].Content
+			var out []*tool.ToolInfo
+			for _, info := range tools {
+				if strings.HasPrefix(info.Desc, topic+" ") {
+					out = append(out, info)
+				}
+			}
+			return out
+		},
+	})
+	ctx := context.Background()
+	m.BindTools(ctx, manyTools(50))
+
+	if _, err := m.Generate(ctx, []*schema.Message{{Role: schema.RoleUser, Content: "topic3"}}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	sent := client.tools[0]
+	if len(sent) != 5 {
+		t.Fatalf("expected 5 selected tools, got %d", len(sent))
+	}
+	for _, info := range sent {
+		if info.Desc != "topic3 helper" {
+			t.Fatalf("unexpected tool selected: %+v", info)
+		}
+	}
+}
+
+func TestMaxToolsFailsEarly(t *testing.T) {
+	client := &toolRecordingClient{}
+	ctx := context.Background()
+
+	m := newToolChatModel(t, client, chatmodel.ChatModelConfig{MaxTools: 10})
+	m.BindTools(ctx, manyTools(50))
+	_, err := m.Generate(ctx, userHello)
+	if !errors.Is(err, chatmodel.ErrTooManyTools) {
+		t.Fatalf("expected ErrTooManyTools, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "tool_49") {
+		t.Fatalf("error should list the tools: %v", err)
+	}
+	_, errs := m.Stream(ctx, userHello)
+	if err := <-errs; !errors.Is(err, chatmodel.ErrTooManyTools) {
+		t.Fatalf("expected ErrTooManyTools from Stream, got %v", err)
+	}
+
+	m = newToolChatModel(t, client, chatmodel.ChatModelConfig{MaxToolsBytes: 100})
+	m.BindTools(ctx, manyTools(50))
+	if _, err := m.Generate(ctx, userHello); !errors.Is(err, chatmodel.ErrTooManyTools) {
+		t.Fatalf("expected ErrTooManyTools for bytes limit, got %v", err)
+	}
+	if len(client.tools) != 0 {
+		t.Fatalf("no request should reach the client, got %d", len(client.tools))
+	}
+}
+
+func TestMaxToolsBytesMeasuresWireTools(t *testing.T) {
+	ctx := context.Background()
+	tools := []*tool.ToolInfo{{Name: "search", Desc: "web search", Parameters: map[string]*tool.ParameterInfo{
+		"query": {Type: tool.String, Desc: "search terms", Required: true},
+	}}}
+
+	// 以客户端实际发送的 tools 数组为基准
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`}
+	client := newTestClient(t, mock)
+	if _, err := client.Generate(ctx, "test-model", userHello, tools); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	wire, err := json.Marshal(mock.lastRequestJSON(t)["tools"])
+	if err != nil {
+		t.Fatalf("marshal tools: %v", err)
+	}
+
+	m := newToolChatModel(t, client, chatmodel.ChatModelConfig{MaxToolsBytes: len(wire)})
+	m.BindTools(ctx, tools)
+	if _, err := m.Generate(ctx, userHello); err != nil {
+		t.Fatalf("tools of exactly MaxToolsBytes should be sent, got %v", err)
+	}
+	m = newToolChatModel(t, client, chatmodel.ChatModelConfig{MaxToolsBytes: len(wire) - 1})
+	m.BindTools(ctx, tools)
+	if _, err := m.Generate(ctx, userHello); !errors.Is(err, chatmodel.ErrTooManyTools) {
+		t.Fatalf("expected ErrTooManyTools one byte over the limit, got %v", err)
+	}
+}
+
+func TestNewChatModelAppliesConnectionSettings(t *testing.T) {
+	var auth, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, path = r.Header.Get("Authorization"), r.URL.Path
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := chatmodel.NewQWenModelClient("client-key")
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	m, err := chatmodel.NewChatModel(context.Background(), &chatmodel.ChatModelConfig{
+		Client:  client,
+		APIKey:  "config-key",
+		Model:   "qwen-test",
+		BaseUrl: srv.URL + "/v1",
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	defer m.Close()
+	if _, err := m.Generate(context.Background(), userHello); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if auth != "Bearer config-key" || path != "/v1/chat/completions" {
+		t.Fatalf("config not applied: auth %q, path %q", auth, path)
+	}
+	if client.Timeout != 5*time.Second {
+		t.Fatalf("timeout not applied: %s", client.Timeout)
+	}
+}
+
+func TestNewChatModelKeepsProvidedHTTPClient(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`}
+	client := newTestClient(t, mock)
+	m, err := chatmodel.NewChatModel(context.Background(), &chatmodel.ChatModelConfig{
+		Client:  client,
+		APIKey:  "config-key",
+		Model:   "qwen-test",
+		BaseUrl: "http://unused.invalid",
+	})
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	if _, err := m.Generate(context.Background(), userHello); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if client.HTTPClient != mock || len(mock.requests) != 1 {
+		t.Fatal("provided HTTP client should be kept")
+	}
+}
+
+func TestExtraParamsReachTheRequest(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`}
+	client := newTestClient(t, mock, chatmodel.WithExtra(map[string]interface{}{"enable_thinking": true, "top_k": 5}))
+	m, err := chatmodel.NewChatModel(context.Background(), &chatmodel.ChatModelConfig{
+		Client: client,
+		APIKey: "config-key",
+		Model:  "qwen-test",
+		ExtraParams: map[string]interface{}{
+			"enable_thinking": false,
+			"enable_search":   true,
+			"model":           "overwritten",
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	if _, err := m.Generate(context.Background(), userHello); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	req := mock.lastRequestJSON(t)
+	// 配置的参数覆盖客户端 Extra，但不覆盖请求自身的字段
+	if req["enable_thinking"] != false || req["enable_search"] != true || req["top_k"] != float64(5) {
+		t.Fatalf("extra params not merged: %v", req)
+	}
+	if req["model"] != "qwen-test" {
+		t.Fatalf("extra params must not replace first-class fields, model = %v", req["model"])
+	}
+
+	// 单次调用的参数优先
+	ctx := chatmodel.WithExtraParams(context.Background(), map[string]interface{}{"enable_search": false})
+	mock.body = sseBody("ok")
+	msgs, errs := m.Stream(ctx, userHello)
+	for range msgs {
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if req := mock.lastRequestJSON(t); req["enable_search"] != false || req["enable_thinking"] != false {
+		t.Fatalf("per-call params should win: %v", req)
+	}
+}
+
+func TestGenerateWithOptionsSendsHeaders(t *testing.T) {
+	var traces, auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traces = append(traces, r.Header.Get("X-Trace-Id"))
+		auths = append(auths, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := chatmodel.NewQWenModelClient("client-key")
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	m, err := chatmodel.NewChatModel(context.Background(), &chatmodel.ChatModelConfig{
+		Client:  client,
+		APIKey:  "config-key",
+		Model:   "qwen-test",
+		BaseUrl: srv.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	defer m.Close()
+
+	opts := chatmodel.GenerateOptions{Headers: map[string]string{"X-Trace-Id": "t-1", "Authorization": "Bearer per-call"}}
+	if _, err := m.GenerateWithOptions(context.Background(), userHello, opts); err != nil {
+		t.Fatalf("GenerateWithOptions failed: %v", err)
+	}
+	if _, err := m.Generate(context.Background(), userHello); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if traces[0] != "t-1" || auths[0] != "Bearer per-call" {
+		t.Fatalf("per-call headers not sent: X-Trace-Id %q, Authorization %q", traces[0], auths[0])
+	}
+	if traces[1] != "" || auths[1] != "Bearer config-key" {
+		t.Fatalf("per-call headers leaked: X-Trace-Id %q, Authorization %q", traces[1], auths[1])
+	}
+}
+
+// modelRecordingClient records the model of every call.
+type modelRecordingClient struct {
+	toolRecordingClient
+	models []string
+}
+
+func (c *modelRecordingClient) Generate(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo) (*schema.Message, error) {
+	c.models = append(c.models, model)
+	return c.toolRecordingClient.Generate(ctx, model, messages, tools)
+}
+
+func (c *modelRecordingClient) Stream(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo) (<-chan *schema.Message, <-chan error) {
+	c.models = append(c.models, model)
+	return c.toolRecordingClient.Stream(ctx, model, messages, tools)
+}
+
+func TestContextModelOverridesConfig(t *testing.T) {
+	client := &modelRecordingClient{}
+	m := newToolChatModel(t, client, chatmodel.ChatModelConfig{})
+	ctx := chatmodel.WithModel(context.Background(), "qwen-max")
+
+	m.Generate(context.Background(), userHello)
+	m.Generate(ctx, userHello)
+	_, errs := m.Stream(ctx, userHello)
+	<-errs
+	m.GenerateWithOptions(ctx, userHello, chatmodel.GenerateOptions{Model: "qwen-turbo"})
+
+	want := []string{"test-model", "qwen-max", "qwen-max", "qwen-turbo"}
+	if strings.Join(client.models, ",") != strings.Join(want, ",") {
+		t.Fatalf("models = %v, want %v", client.models, want)
+	}
+}
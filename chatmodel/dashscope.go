@@ -0,0 +1,176 @@
+package chatmodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Native DashScope endpoint path, used when NativeFormat is enabled. The base
+// URL comes from DefaultBaseURL(ProviderDashScope).
+const defaultDashScopePath = "services/aigc/text-generation/generation"
+
+// DashScopeRequest represents the request structure of DashScope's native
+// text-generation API
+type DashScopeRequest struct {
+	Model      string              `json:"model"`
+	Input      DashScopeInput      `json:"input"`
+	Parameters DashScopeParameters `json:"parameters"`
+}
+
+// DashScopeInput represents the input part of a native request
+type DashScopeInput struct {
+	Messages []QWenMessage `json:"messages"`
+}
+
+// DashScopeParameters represents the parameters part of a native request
+type DashScopeParameters struct {
+	// ResultFormat is always "message", so that responses carry choices
+	// with messages and tool calls rather than plain text.
+	ResultFormat string                   `json:"result_format"`
+	Tools        []map[string]interface{} `json:"tools,omitempty"`
+	// IncrementalOutput makes each stream chunk a delta instead of the
+	// whole output so far.
+	IncrementalOutput bool `json:"incremental_output,omitempty"`
+
+	LogProbs    *bool `json:"logprobs,omitempty"`
+	TopLogProbs *int  `json:"top_logprobs,omitempty"`
+	N           *int  `json:"n,omitempty"`
+
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+	Seed              *int  `json:"seed,omitempty"`
+
+	// Extra holds provider-specific parameters merged into the parameters
+	// object. Keys naming a field of DashScopeParameters are ignored.
+	Extra map[string]interface{} `json:"-"`
+}
+
+var dashScopeParameterKeys = jsonKeys(reflect.TypeOf(DashScopeParameters{}))
+
+// MarshalJSON encodes the parameters and merges Extra into them.
+func (p DashScopeParameters) MarshalJSON() ([]byte, error) {
+	type plain DashScopeParameters
+	b, err := json.Marshal(plain(p))
+	if err != nil {
+		return nil, err
+	}
+	return mergeExtra(b, p.Extra, dashScopeParameterKeys)
+}
+
+// DashScopeResponse represents the response structure of the native API
+type DashScopeResponse struct {
+	RequestID string          `json:"request_id"`
+	Output    DashScopeOutput `json:"output"`
+	Usage     DashScopeUsage  `json:"usage"`
+}
+
+// DashScopeOutput holds choices for result_format "message", or text and
+// finish_reason for result_format "text"
+type DashScopeOutput struct {
+	Choices      []QWenChoice `json:"choices,omitempty"`
+	Text         string       `json:"text,omitempty"`
+	FinishReason string       `json:"finish_reason,omitempty"`
+}
+
+// DashScopeUsage represents token usage in the native API
+type DashScopeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// toNative converts a compatible-mode request to the native structure. The
+// native API has no system field, so System becomes the first message.
+func (r QWenRequest) toNative() DashScopeRequest {
+	messages := r.Messages
+	if r.System != "" {
+		messages = append([]QWenMessage{{Role: "system", Content: r.System}}, messages...)
+	}
+	return DashScopeRequest{
+		Model: r.Model,
+		Input: DashScopeInput{Messages: messages},
+		Parameters: DashScopeParameters{
+			ResultFormat:      "message",
+			Tools:             r.Tools,
+			IncrementalOutput: r.Stream,
+			LogProbs:          r.LogProbs,
+			TopLogProbs:       r.TopLogProbs,
+			N:                 r.N,
+			ParallelToolCalls: r.ParallelToolCalls,
+			Seed:              r.Seed,
+			Extra:             r.Extra,
+		},
+	}
+}
+
+// toCompatible converts a native response to the compatible-mode structure.
+// Text output becomes a single choice.
+func (r DashScopeResponse) toCompatible() QWenResponse {
+	resp := QWenResponse{
+		ID:      r.RequestID,
+		Choices: r.Output.Choices,
+		Usage: QWenUsage{
+			PromptTokens:     r.Usage.InputTokens,
+			CompletionTokens: r.Usage.OutputTokens,
+			TotalTokens:      r.Usage.TotalTokens,
+		},
+	}
+	if len(resp.Choices) == 0 && (r.Output.Text != "" || r.Output.FinishReason != "") {
+		resp.Choices = []QWenChoice{{
+			Message:      QWenMessage{Role: "assistant", Content: r.Output.Text},
+			FinishReason: r.Output.FinishReason,
+		}}
+	}
+	return resp
+}
+
+// toStreamChunk converts a native stream chunk, whose choices carry the
+// delta in message, to a compatible-mode chunk.
+func (r DashScopeResponse) toStreamChunk() QWenStreamResponse {
+	resp := r.toCompatible()
+	choices := make([]QWenChoice, len(resp.Choices))
+	for i, choice := range resp.Choices {
+		choice.Delta, choice.Message = choice.Message, QWenMessage{}
+		// native 模式下 finish_reason 在流中途为 "null"
+		if choice.FinishReason == "null" {
+			choice.FinishReason = ""
+		}
+		choices[i] = choice
+	}
+	return QWenStreamResponse{ID: resp.ID, Choices: choices, Usage: &resp.Usage}
+}
+
+// jsonKeys lists the JSON keys of a struct type's own fields.
+func jsonKeys(t reflect.Type) map[string]bool {
+	keys := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+// mergeExtra adds the extra keys to the JSON object b, skipping reserved ones.
+func mergeExtra(b []byte, extra map[string]interface{}, reserved map[string]bool) ([]byte, error) {
+	if len(extra) == 0 {
+		return b, nil
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, err
+	}
+	for key, value := range extra {
+		if reserved[key] {
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("extra field %q: %w", key, err)
+		}
+		obj[key] = raw
+	}
+	return json.Marshal(obj)
+}
@@ -0,0 +1,122 @@
+package chatmodel
+
+import (
+	"errors"
+	"fmt"
+	httpclient "reAct-agent/http_client"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrUnauthorized is matched (via errors.Is) by API errors caused by missing
+// or rejected credentials.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrStreamIdleTimeout is reported when a stream stalls for longer than the
+// configured StreamIdleTimeout.
+var ErrStreamIdleTimeout = errors.New("stream idle timeout")
+
+// ErrStreamErrorEvent is reported when a stream sends an "event: error"
+// server-sent event; the error text includes the event's data.
+var ErrStreamErrorEvent = errors.New("stream error event")
+
+// ErrTooManyTools is reported when the tools sent with a request exceed the
+// configured MaxTools or MaxToolsBytes.
+var ErrTooManyTools = errors.New("too many tools")
+
+// ErrNoModelsURL is reported by Ping and ListModels when the models endpoint
+// of a caller-supplied HTTPClient cannot be determined and no
+// ModelsHTTPClient was provided.
+var ErrNoModelsURL = errors.New("no models URL")
+
+// APIError is returned when the provider answers with a non-200 status.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Unwrap exposes ErrUnauthorized for 401 and 403 responses.
+func (e *APIError) Unwrap() error {
+	if e.StatusCode == 401 || e.StatusCode == 403 {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// RateLimitError is returned for 429 responses. RetryAfter is the wait the
+// provider asked for, from the Retry-After header or the body, and zero when
+// it gave none. It unwraps to the underlying *APIError.
+type RateLimitError struct {
+	*APIError
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s (retry after %s)", e.APIError.Error(), e.RetryAfter)
+	}
+	return e.APIError.Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.APIError
+}
+
+// newAPIError builds the error for a non-200 response.
+func newAPIError(resp *httpclient.HTTPResponse) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode, Body: string(resp.Body)}
+	if resp.StatusCode == 429 {
+		retryAfter, _ := httpclient.ParseRetryAfter(resp.Header, resp.Body)
+		return &RateLimitError{APIError: apiErr, RetryAfter: retryAfter}
+	}
+	return apiErr
+}
+
+// maxDecodeSnippet is how many bytes of an undecodable body DecodeError keeps.
+const maxDecodeSnippet = 256
+
+// secretPattern matches credentials a gateway may echo back in a body.
+var secretPattern = regexp.MustCompile(`(?i)(bearer\s+)[^\s"',]+|\bsk-[A-Za-z0-9_-]{8,}`)
+
+// DecodeError is returned when a response body is not the JSON the client
+// expects, e.g. an HTML error page from a proxy. Snippet is the start of the
+// body, truncated and with credentials redacted, so the error can be logged
+// as it is.
+type DecodeError struct {
+	// What names the decoded payload, e.g. "response" or "models".
+	What       string
+	StatusCode int
+	Snippet    string
+	Err        error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode %s (status %d): %v; body: %q", e.What, e.StatusCode, e.Err, e.Snippet)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// newDecodeError builds the error for a body that failed to decode with err.
+func newDecodeError(what string, resp *httpclient.HTTPResponse, err error) error {
+	body := resp.Body
+	truncated := len(body) > maxDecodeSnippet
+	if truncated {
+		body = body[:maxDecodeSnippet]
+		// 避免截断在多字节字符中间
+		for len(body) > 0 && !utf8.Valid(body) {
+			body = body[:len(body)-1]
+		}
+	}
+	snippet := secretPattern.ReplaceAllString(string(body), "${1}[REDACTED]")
+	if truncated {
+		snippet += "..."
+	}
+	return &DecodeError{What: what, StatusCode: resp.StatusCode, Snippet: snippet, Err: err}
+}
@@ -0,0 +1,45 @@
+package chatmodel
+
+import (
+	"strings"
+	"sync"
+)
+
+// Provider names known to DefaultBaseURL.
+const (
+	// ProviderQWen is QWen's OpenAI-compatible endpoint.
+	ProviderQWen = qwenProvider
+	// ProviderDashScope is DashScope's native text-generation endpoint, used
+	// by QWenModelClient with NativeFormat.
+	ProviderDashScope = "dashscope"
+)
+
+var (
+	baseURLsMu sync.RWMutex
+	baseURLs   = map[string]string{
+		ProviderQWen:      "https://dashscope.aliyuncs.com/compatible-mode/v1",
+		ProviderDashScope: "https://dashscope.aliyuncs.com/api/v1",
+	}
+)
+
+// DefaultBaseURL returns the base URL a client of provider uses when none is
+// configured, or "" for an unknown provider. Names are case-insensitive.
+func DefaultBaseURL(provider string) string {
+	baseURLsMu.RLock()
+	defer baseURLsMu.RUnlock()
+	return baseURLs[strings.ToLower(provider)]
+}
+
+// SetDefaultBaseURL registers or replaces the default base URL of provider,
+// e.g. to point every client at a regional endpoint or a proxy. An empty url
+// removes the entry. It affects clients built afterwards.
+func SetDefaultBaseURL(provider, url string) {
+	baseURLsMu.Lock()
+	defer baseURLsMu.Unlock()
+	provider = strings.ToLower(provider)
+	if url == "" {
+		delete(baseURLs, provider)
+		return
+	}
+	baseURLs[provider] = url
+}
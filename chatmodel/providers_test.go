@@ -0,0 +1,50 @@
+package chatmodel_test
+
+import (
+	"reAct-agent/chatmodel"
+	httpclient "reAct-agent/http_client"
+	"strings"
+	"testing"
+)
+
+func TestDefaultBaseURL(t *testing.T) {
+	for provider, want := range map[string]string{
+		chatmodel.ProviderQWen:      "https://dashscope.aliyuncs.com/compatible-mode/v1",
+		chatmodel.ProviderDashScope: "https://dashscope.aliyuncs.com/api/v1",
+	} {
+		t.Run(provider, func(t *testing.T) {
+			if got := chatmodel.DefaultBaseURL(provider); got != want {
+				t.Fatalf("DefaultBaseURL(%q) = %q, want %q", provider, got, want)
+			}
+		})
+	}
+	if got := chatmodel.DefaultBaseURL("QWen"); got == "" {
+		t.Fatal("provider names should be case-insensitive")
+	}
+	if got := chatmodel.DefaultBaseURL("unknown"); got != "" {
+		t.Fatalf("unknown provider = %q, want empty", got)
+	}
+}
+
+func TestSetDefaultBaseURLAppliesToNewClients(t *testing.T) {
+	orig := chatmodel.DefaultBaseURL(chatmodel.ProviderQWen)
+	defer chatmodel.SetDefaultBaseURL(chatmodel.ProviderQWen, orig)
+
+	chatmodel.SetDefaultBaseURL(chatmodel.ProviderQWen, "https://proxy.example.com/v1")
+	c, err := chatmodel.NewQWenModelClient("test-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := c.HTTPClient.(*httpclient.HTTPClient).URL()
+	if !strings.HasPrefix(url, "https://proxy.example.com/v1/") {
+		t.Fatalf("client URL = %q, want the overridden base", url)
+	}
+
+	c, err = chatmodel.NewQWenModelClient("test-key", chatmodel.WithBaseUrl("https://explicit.example.com/v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url := c.HTTPClient.(*httpclient.HTTPClient).URL(); !strings.HasPrefix(url, "https://explicit.example.com/v1") {
+		t.Fatalf("client URL = %q, want the explicit base", url)
+	}
+}
@@ -7,34 +7,230 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	httpclient "reAct-agent/http_client"
+	"reAct-agent/logging"
+	"reAct-agent/metrics"
 	"reAct-agent/schema"
 	"reAct-agent/tool"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// QWenModelClient talks to QWen's OpenAI-compatible API, or to DashScope's
+// native API when NativeFormat is set. Once constructed it
+// is safe for concurrent use: Generate and Stream only read its fields and
+// the default HTTP clients share one connection pool, so a single client
+// should be shared across goroutines rather than created per call.
 type QWenModelClient struct {
 	BaseUrl   string
 	AuthToken string
 	Timeout   time.Duration
 	Path      string // default: chat/completions
 
+	// LogProbs requests token log-probabilities; TopLogProbs additionally asks
+	// for that many alternatives per position when greater than zero.
+	LogProbs    bool
+	TopLogProbs int
+
+	// ParallelToolCalls, when set, is sent as "parallel_tool_calls" with
+	// requests that carry tools; false limits the model to one tool call per
+	// turn. Nil leaves the provider default.
+	ParallelToolCalls *bool
+
+	// RoleMapping overrides the wire label sent for a schema.Role. Roles not
+	// present use schema.Role.String(). Response roles are mapped back
+	// through it, so e.g. {RoleAssistant: "model"} also decodes "model".
+	RoleMapping map[schema.Role]string
+
+	// StreamIdleTimeout aborts a stream when no chunk arrives for this long.
+	// Unlike Timeout, which bounds the whole request, it detects stalls
+	// between tokens. Zero disables the check.
+	StreamIdleTimeout time.Duration
+
+	// StreamBuffer is the capacity of the message channel returned by
+	// Stream. A full channel blocks the reader until the consumer catches
+	// up or the context ends. Defaults to 10.
+	StreamBuffer int
+
+	// ResponsePath is the chain of object keys leading to the node that holds
+	// "choices". Empty means the top level of the response body.
+	ResponsePath []string
+
+	// Extra is copied into QWenRequest.Extra for every request. Parameters
+	// from ChatModelConfig.ExtraParams or WithExtraParams override it.
+	Extra map[string]interface{}
+
+	// NativeFormat switches requests and responses to DashScope's native
+	// structure ({"input":{"messages":...},"parameters":{...}}) instead of
+	// the OpenAI-compatible one.
+	NativeFormat bool
+
+	// SystemAsField sends system messages as the top-level "system" field
+	// instead of role "system" entries, for gateways that require it.
+	SystemAsField bool
+
+	// AssistantPrefill sends a trailing assistant message with content as a
+	// prefill ("partial": true) that the model continues, e.g. "{" to force
+	// JSON. The returned content starts with the prefill. Don't combine it
+	// with the agent's AutoContinueOnLength, which joins the parts itself.
+	AssistantPrefill bool
+
+	// PromptCaching sends messages with schema.Message.CacheHint as content
+	// blocks marked "cache_control": {"type": "ephemeral"}, DashScope's
+	// explicit context cache. Off, hints are ignored. Hints on system
+	// messages sent with SystemAsField are dropped.
+	PromptCaching bool
+
+	// Seed, when set, is sent with every request for reproducible sampling.
+	// OnFingerprintChange is then called whenever the system_fingerprint
+	// reported for a model differs from the previous response's, a sign the
+	// backend changed and results may no longer be reproducible.
+	Seed                *int
+	OnFingerprintChange func(model, previous, current string)
+
+	// User is sent as the "user" field, an end-user identifier the provider
+	// uses for abuse monitoring. Multi-tenant apps should pass a stable hash
+	// per user rather than a name or email; WithRequestUser overrides it for
+	// one call. Empty sends nothing.
+	User string
+
+	// Metrics receives request counts, latencies and token usage. Nil
+	// reports nothing.
+	Metrics metrics.Metrics
+	// Logger receives a line per request and failure; default HTTP clients
+	// log their retries to it too. Nil logs nothing.
+	Logger logging.Logger
+
 	HTTPClient httpclient.IHTTPClient
+	// StreamHTTPClient sends streaming requests. It defaults to a client
+	// accepting text/event-stream, or to HTTPClient when that was provided.
+	StreamHTTPClient httpclient.IHTTPClient
+	// ModelsHTTPClient targets the models endpoint used by Ping and
+	// ListModels. When only HTTPClient was provided it defaults to that
+	// client, sent to the models URL derived from its own URL, so a mock or
+	// recording client sees these calls too.
+	ModelsHTTPClient httpclient.IHTTPClient
+
+	// owned records which HTTP clients were built by the constructor.
+	owned struct{ chat, stream, models bool }
+	// modelsURL, when set, redirects ModelsHTTPClient requests to the models
+	// endpoint because it is the HTTPClient targeting chat completions.
+	// modelsErr is set instead when that client's URL is unknown.
+	modelsURL string
+	modelsErr error
+	// fingerprints holds the last system_fingerprint seen per model.
+	fingerprints *sync.Map
 }
 
 // QWenRequest represents the request structure for QWen API
 type QWenRequest struct {
-	Model    string                   `json:"model"`
+	Model string `json:"model"`
+	// System carries the system prompt when SystemAsField is enabled;
+	// otherwise it stays a message in Messages.
+	System   string                   `json:"system,omitempty"`
 	Messages []QWenMessage            `json:"messages"`
 	Tools    []map[string]interface{} `json:"tools,omitempty"`
 	Stream   bool                     `json:"stream,omitempty"`
+
+	LogProbs    *bool `json:"logprobs,omitempty"`
+	TopLogProbs *int  `json:"top_logprobs,omitempty"`
+
+	// ParallelToolCalls allows or forbids several tool calls in one turn.
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+
+	Seed *int `json:"seed,omitempty"`
+
+	// User identifies the end user for abuse monitoring.
+	User string `json:"user,omitempty"`
+
+	// StreamOptions asks streaming responses to end with a usage chunk.
+	StreamOptions *QWenStreamOptions `json:"stream_options,omitempty"`
+
+	// N asks for that many completions of the same prompt.
+	N *int `json:"n,omitempty"`
+
+	// Extra holds provider-specific parameters, e.g. "enable_thinking",
+	// merged into the top level of the JSON body. Keys naming a field of
+	// QWenRequest are ignored so they can't overwrite it.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// qwenRequestKeys lists the JSON keys of QWenRequest's own fields.
+var qwenRequestKeys = jsonKeys(reflect.TypeOf(QWenRequest{}))
+
+// MarshalJSON encodes the request and merges Extra into the top level.
+func (r QWenRequest) MarshalJSON() ([]byte, error) {
+	type plain QWenRequest
+	b, err := json.Marshal(plain(r))
+	if err != nil {
+		return nil, err
+	}
+	return mergeExtra(b, r.Extra, qwenRequestKeys)
+}
+
+// QWenStreamOptions represents the stream_options of a streaming request
+type QWenStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // QWenMessage represents a message in QWen API format
 type QWenMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string         `json:"role"`
+	Content    string         `json:"content"`
+	ToolCalls  []QWenToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+	// Partial marks an assistant prefill the model continues.
+	Partial bool `json:"partial,omitempty"`
+
+	// ReasoningContent is only read from responses; it is never sent back.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+
+	// CacheControl, when set, sends Content as a single text block carrying
+	// this cache marker instead of a plain string.
+	CacheControl *QWenCacheControl `json:"-"`
+}
+
+// QWenCacheControl marks the end of a cached prompt prefix.
+type QWenCacheControl struct {
+	Type string `json:"type"`
+}
+
+// QWenContentBlock is one part of a message content sent as an array.
+type QWenContentBlock struct {
+	Type         string            `json:"type"`
+	Text         string            `json:"text"`
+	CacheControl *QWenCacheControl `json:"cache_control,omitempty"`
+}
+
+// MarshalJSON encodes Content as a cache-marked text block when CacheControl
+// is set.
+func (m QWenMessage) MarshalJSON() ([]byte, error) {
+	type plain QWenMessage
+	if m.CacheControl == nil {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		plain
+		Content []QWenContentBlock `json:"content"`
+	}{plain(m), []QWenContentBlock{{Type: "text", Text: m.Content, CacheControl: m.CacheControl}}})
+}
+
+// QWenToolCall represents a structured tool call in QWen API format
+type QWenToolCall struct {
+	Index    *int             `json:"index,omitempty"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function QWenFunctionCall `json:"function"`
+}
+
+// QWenFunctionCall represents the function part of a tool call
+type QWenFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
 }
 
 // QWenResponse represents the response structure for QWen API
@@ -45,14 +241,47 @@ type QWenResponse struct {
 	Model   string       `json:"model"`
 	Choices []QWenChoice `json:"choices"`
 	Usage   QWenUsage    `json:"usage"`
+
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
 }
 
 // QWenChoice represents a choice in the response
 type QWenChoice struct {
-	Index        int         `json:"index"`
-	Message      QWenMessage `json:"message"`
-	Delta        QWenMessage `json:"delta,omitempty"`
-	FinishReason string      `json:"finish_reason,omitempty"`
+	Index        int           `json:"index"`
+	Message      QWenMessage   `json:"message"`
+	Delta        QWenMessage   `json:"delta,omitempty"`
+	FinishReason string        `json:"finish_reason,omitempty"`
+	LogProbs     *QWenLogProbs `json:"logprobs,omitempty"`
+
+	// ContentFilterResults reports moderation per category, as sent by
+	// gateways that filter content.
+	ContentFilterResults map[string]QWenFilterResult `json:"content_filter_results,omitempty"`
+}
+
+// QWenFilterResult represents the moderation result of one category
+type QWenFilterResult struct {
+	Filtered bool   `json:"filtered"`
+	Severity string `json:"severity,omitempty"`
+}
+
+// QWenLogProbs represents the logprobs structure of a choice
+type QWenLogProbs struct {
+	Content []QWenTokenLogProb `json:"content"`
+}
+
+// QWenTokenLogProb represents the log-probability of a single token
+type QWenTokenLogProb struct {
+	Token       string           `json:"token"`
+	LogProb     float64          `json:"logprob"`
+	Bytes       []int64          `json:"bytes,omitempty"`
+	TopLogProbs []QWenTopLogProb `json:"top_logprobs,omitempty"`
+}
+
+// QWenTopLogProb represents one alternative token at a position
+type QWenTopLogProb struct {
+	Token   string  `json:"token"`
+	LogProb float64 `json:"logprob"`
+	Bytes   []int64 `json:"bytes,omitempty"`
 }
 
 // QWenUsage represents token usage information
@@ -69,8 +298,14 @@ type QWenStreamResponse struct {
 	Created int64        `json:"created"`
 	Model   string       `json:"model"`
 	Choices []QWenChoice `json:"choices"`
+	Usage   *QWenUsage   `json:"usage,omitempty"`
+
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
 }
 
+// qwenProvider is the provider label reported to Metrics.
+const qwenProvider = "qwen"
+
 type Option func(*QWenModelClient) error
 
 func WithBaseUrl(baseUrl string) Option {
@@ -87,6 +322,171 @@ func WithTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithStreamIdleTimeout sets the maximum gap allowed between stream chunks.
+func WithStreamIdleTimeout(d time.Duration) Option {
+	return func(c *QWenModelClient) error {
+		if d < 0 {
+			return errors.New("stream idle timeout must not be negative")
+		}
+		c.StreamIdleTimeout = d
+		return nil
+	}
+}
+
+// WithStreamChannelBuffer sets the capacity of the channel returned by
+// Stream; 0 makes it unbuffered.
+func WithStreamChannelBuffer(n int) Option {
+	return func(c *QWenModelClient) error {
+		if n < 0 {
+			return errors.New("stream channel buffer must not be negative")
+		}
+		c.StreamBuffer = n
+		return nil
+	}
+}
+
+// WithLogProbs requests token log-probabilities with up to topLogProbs
+// alternatives per token (0 returns only the sampled tokens).
+func WithLogProbs(topLogProbs int) Option {
+	return func(c *QWenModelClient) error {
+		if topLogProbs < 0 {
+			return errors.New("topLogProbs must not be negative")
+		}
+		c.LogProbs = true
+		c.TopLogProbs = topLogProbs
+		return nil
+	}
+}
+
+// WithParallelToolCalls sets ParallelToolCalls.
+func WithParallelToolCalls(enabled bool) Option {
+	return func(c *QWenModelClient) error {
+		c.ParallelToolCalls = &enabled
+		return nil
+	}
+}
+
+// WithRoleMapping overrides the role labels sent to the provider, e.g.
+// {schema.RoleUser: "human", schema.RoleAssistant: "ai"}. Unmapped roles keep
+// their default label. Labels must be distinct so responses decode to a
+// single role.
+func WithRoleMapping(mapping map[schema.Role]string) Option {
+	return func(c *QWenModelClient) error {
+		if c.RoleMapping == nil {
+			c.RoleMapping = make(map[schema.Role]string, len(mapping))
+		}
+		for role, label := range mapping {
+			if label == "" {
+				return fmt.Errorf("empty label for role %s", role)
+			}
+			c.RoleMapping[role] = label
+		}
+		// 标签重复时反向解析结果不确定
+		byLabel := make(map[string]schema.Role, len(c.RoleMapping))
+		for role, label := range c.RoleMapping {
+			if other, ok := byLabel[label]; ok {
+				return fmt.Errorf("roles %s and %s share the label %q", min(role, other), max(role, other), label)
+			}
+			byLabel[label] = role
+		}
+		return nil
+	}
+}
+
+// WithResponsePath sets the keys to descend through before decoding the
+// response, for gateways that wrap it, e.g. []string{"data"} for
+// {"data":{"choices":[...]}}.
+func WithResponsePath(path []string) Option {
+	return func(c *QWenModelClient) error {
+		c.ResponsePath = append([]string(nil), path...)
+		return nil
+	}
+}
+
+// WithExtra adds provider-specific request parameters, e.g.
+// {"enable_thinking": false}. Later calls add to earlier ones.
+func WithExtra(extra map[string]interface{}) Option {
+	return func(c *QWenModelClient) error {
+		if c.Extra == nil {
+			c.Extra = make(map[string]interface{}, len(extra))
+		}
+		for k, v := range extra {
+			c.Extra[k] = v
+		}
+		return nil
+	}
+}
+
+// WithNativeDashScopeFormat switches to DashScope's native API format. When
+// enabled, the base URL and path default to the native text-generation
+// endpoint unless set explicitly.
+func WithNativeDashScopeFormat(enabled bool) Option {
+	return func(c *QWenModelClient) error {
+		c.NativeFormat = enabled
+		if enabled && c.Path == "chat/completions" {
+			c.Path = defaultDashScopePath
+		}
+		return nil
+	}
+}
+
+// WithSystemField moves system messages into the request's "system" field.
+func WithSystemField(enabled bool) Option {
+	return func(c *QWenModelClient) error {
+		c.SystemAsField = enabled
+		return nil
+	}
+}
+
+// WithAssistantPrefill enables AssistantPrefill.
+func WithAssistantPrefill(enabled bool) Option {
+	return func(c *QWenModelClient) error {
+		c.AssistantPrefill = enabled
+		return nil
+	}
+}
+
+// WithPromptCaching enables PromptCaching.
+func WithPromptCaching(enabled bool) Option {
+	return func(c *QWenModelClient) error {
+		c.PromptCaching = enabled
+		return nil
+	}
+}
+
+// WithSeed sets Seed; onChange, when not nil, becomes OnFingerprintChange.
+func WithSeed(seed int, onChange func(model, previous, current string)) Option {
+	return func(c *QWenModelClient) error {
+		c.Seed = &seed
+		c.OnFingerprintChange = onChange
+		return nil
+	}
+}
+
+// WithUser sets User.
+func WithUser(user string) Option {
+	return func(c *QWenModelClient) error {
+		c.User = user
+		return nil
+	}
+}
+
+// WithLogger sets Logger.
+func WithLogger(l logging.Logger) Option {
+	return func(c *QWenModelClient) error {
+		c.Logger = l
+		return nil
+	}
+}
+
+// WithMetrics reports request metrics to m.
+func WithMetrics(m metrics.Metrics) Option {
+	return func(c *QWenModelClient) error {
+		c.Metrics = m
+		return nil
+	}
+}
+
 func WithHTTPClient(httpClient httpclient.IHTTPClient) Option {
 	return func(c *QWenModelClient) error {
 		c.HTTPClient = httpClient
@@ -94,15 +494,33 @@ func WithHTTPClient(httpClient httpclient.IHTTPClient) Option {
 	}
 }
 
+// WithModelsHTTPClient sets the client used by Ping and ListModels.
+func WithModelsHTTPClient(httpClient httpclient.IHTTPClient) Option {
+	return func(c *QWenModelClient) error {
+		c.ModelsHTTPClient = httpClient
+		return nil
+	}
+}
+
+// WithStreamHTTPClient sets the client used by Stream.
+func WithStreamHTTPClient(httpClient httpclient.IHTTPClient) Option {
+	return func(c *QWenModelClient) error {
+		c.StreamHTTPClient = httpClient
+		return nil
+	}
+}
+
 func NewQWenModelClient(authToken string, opts ...Option) (*QWenModelClient, error) {
 	if authToken == "" {
 		return nil, errors.New("authToken is required")
 	}
 
 	client := &QWenModelClient{
-		AuthToken: authToken,
-		Timeout:   5 * time.Minute,
-		Path:      "chat/completions",
+		AuthToken:    authToken,
+		Timeout:      5 * time.Minute,
+		Path:         "chat/completions",
+		StreamBuffer: 10,
+		fingerprints: &sync.Map{},
 	}
 
 	for _, opt := range opts {
@@ -111,153 +529,729 @@ func NewQWenModelClient(authToken string, opts ...Option) (*QWenModelClient, err
 		}
 	}
 
-	// Initialize default HTTP client if not provided
-	if client.HTTPClient == nil {
-		base := client.BaseUrl
-		if base == "" {
-			base = "https://dashscope.aliyuncs.com/compatible-mode/v1"
+	client.initHTTPClients()
+	return client, nil
+}
+
+// initHTTPClients builds default HTTP clients for the ones not provided.
+func (c *QWenModelClient) initHTTPClients() {
+	base := c.BaseUrl
+	if base == "" {
+		base = DefaultBaseURL(ProviderQWen)
+		if c.NativeFormat {
+			base = DefaultBaseURL(ProviderDashScope)
 		}
+	}
+	// 默认客户端共享同一个 transport 与连接池
+	transport := httpclient.NewTransport()
+	newClient := func(path, accept string) *httpclient.HTTPClient {
 		header := httpclient.HTTPHeader{
 			"Content-Type":  "application/json",
-			"Accept":        "application/json",
-			"Authorization": "Bearer " + client.AuthToken,
+			"Accept":        accept,
+			"Authorization": "Bearer " + c.AuthToken,
+		}
+		// native 接口需要显式开启 SSE
+		if c.NativeFormat && accept == "text/event-stream" {
+			header["X-DashScope-SSE"] = "enable"
 		}
-		client.HTTPClient = httpclient.NewHTTPClient(base, client.Path,
+		return httpclient.NewHTTPClient(base, path,
 			httpclient.WithHeader(header),
-			httpclient.WithTimeout(client.Timeout),
+			httpclient.WithTimeout(c.Timeout),
+			httpclient.WithTransport(transport),
+			httpclient.WithLogger(c.Logger),
 		)
 	}
+	// 调用方提供的 HTTPClient 同样用于 models 接口，地址由该客户端自身的 URL 推出，
+	// 不回退到默认地址，以免其凭据被发往其他服务商
+	if c.ModelsHTTPClient == nil && c.HTTPClient != nil {
+		c.ModelsHTTPClient = c.HTTPClient
+		c.modelsURL, c.modelsErr = modelsURLOf(c.HTTPClient, c.Path)
+	}
+	if c.StreamHTTPClient == nil {
+		if c.HTTPClient != nil {
+			c.StreamHTTPClient = c.HTTPClient
+		} else {
+			c.StreamHTTPClient = newClient(c.Path, "text/event-stream")
+			c.owned.stream = true
+		}
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = newClient(c.Path, "application/json")
+		c.owned.chat = true
+	}
+	if c.ModelsHTTPClient == nil {
+		c.ModelsHTTPClient = newClient("models", "application/json")
+		c.owned.models = true
+	}
+}
 
-	return client, nil
+// Configure applies the connection settings of a ChatModelConfig. Empty
+// values keep the current setting. Default HTTP clients are rebuilt with the
+// new settings; clients supplied through options keep their own.
+func (c *QWenModelClient) Configure(baseUrl, apiKey string, timeout time.Duration) error {
+	if baseUrl != "" {
+		c.BaseUrl = baseUrl
+	}
+	if apiKey != "" {
+		c.AuthToken = apiKey
+	}
+	if timeout > 0 {
+		c.Timeout = timeout
+	}
+	var errs []error
+	for _, hc := range []struct {
+		owned  bool
+		client *httpclient.IHTTPClient
+	}{{c.owned.chat, &c.HTTPClient}, {c.owned.stream, &c.StreamHTTPClient}, {c.owned.models, &c.ModelsHTTPClient}} {
+		if !hc.owned {
+			continue
+		}
+		if closer, ok := (*hc.client).(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+		*hc.client = nil
+	}
+	c.owned.chat, c.owned.stream, c.owned.models = false, false, false
+	// 由 HTTPClient 派生的 models 客户端随新的 baseUrl 重新派生
+	if c.modelsURL != "" || c.modelsErr != nil {
+		c.ModelsHTTPClient, c.modelsURL, c.modelsErr = nil, "", nil
+	}
+	c.initHTTPClients()
+	return errors.Join(errs...)
 }
 
-// GenerateMessage 调用 QWen API 获取完整响应
-func (c *QWenModelClient) Generate(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo) (*schema.Message, error) {
-	// 构建请求
+// Close releases the resources held by the underlying HTTP clients, if they
+// support closing.
+func (c *QWenModelClient) Close() error {
+	var errs []error
+	for _, hc := range []httpclient.IHTTPClient{c.HTTPClient, c.StreamHTTPClient, c.ModelsHTTPClient} {
+		if closer, ok := hc.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping verifies connectivity and credentials by listing models, which costs
+// no tokens. It returns nil on success, an *APIError on a non-200 answer
+// (matching ErrUnauthorized for 401/403) or the transport error otherwise.
+func (c *QWenModelClient) Ping(ctx context.Context) error {
+	httpResp, err := c.sendModels(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	if httpResp.StatusCode != 200 {
+		return newAPIError(httpResp)
+	}
+	return nil
+}
+
+// modelsURL derives the models endpoint from the URL of a client targeting
+// chat completions, replacing its trailing chat path with "models". It fails
+// when the client does not report its URL or the URL does not end with path.
+func modelsURLOf(client httpclient.IHTTPClient, path string) (string, error) {
+	u, ok := client.(interface{ URL() string })
+	if !ok {
+		return "", fmt.Errorf("%w: the HTTP client does not report its URL, use WithModelsHTTPClient", ErrNoModelsURL)
+	}
+	chatURL := u.URL()
+	base, ok := strings.CutSuffix(chatURL, strings.TrimLeft(path, "/"))
+	if !ok || path == "" || !strings.Contains(base, "://") {
+		return "", fmt.Errorf("%w: cannot derive it from %q, use WithModelsHTTPClient", ErrNoModelsURL, chatURL)
+	}
+	return strings.TrimRight(base, "/") + "/models", nil
+}
+
+// sendModels sends a GET to the models endpoint.
+func (c *QWenModelClient) sendModels(ctx context.Context) (*httpclient.HTTPResponse, error) {
+	if c.modelsErr != nil {
+		return nil, c.modelsErr
+	}
+	if c.modelsURL != "" {
+		ctx = httpclient.WithRequestURL(ctx, c.modelsURL)
+	}
+	return c.ModelsHTTPClient.Send(ctx, httpclient.HTTPMethodGET, nil)
+}
+
+// ModelInfo describes one model returned by ListModels.
+type ModelInfo struct {
+	ID string `json:"id"`
+	// Created is the Unix time in seconds the model was published, when the
+	// provider reports it.
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// modelsPage is one page of the models endpoint.
+type modelsPage struct {
+	Data    []ModelInfo `json:"data"`
+	HasMore bool        `json:"has_more"`
+	LastID  string      `json:"last_id"`
+}
+
+// ListModels returns the models available to the configured key, e.g. for a
+// model picker. Paginated answers (has_more) are followed with the "after"
+// cursor until the list is complete. Errors are reported as for Ping.
+func (c *QWenModelClient) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var (
+		models []ModelInfo
+		after  string
+	)
+	for {
+		reqCtx := ctx
+		if after != "" {
+			reqCtx = httpclient.WithRequestQuery(ctx, url.Values{"after": {after}})
+		}
+		httpResp, err := c.sendModels(reqCtx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		if httpResp.StatusCode != 200 {
+			return nil, newAPIError(httpResp)
+		}
+		var page modelsPage
+		if err := json.Unmarshal(httpResp.Body, &page); err != nil {
+			return nil, newDecodeError("models", httpResp, err)
+		}
+		models = append(models, page.Data...)
+		if !page.HasMore || len(page.Data) == 0 {
+			return models, nil
+		}
+		next := page.LastID
+		if next == "" {
+			next = page.Data[len(page.Data)-1].ID
+		}
+		// 游标不前进时停止，避免死循环
+		if next == after {
+			return models, nil
+		}
+		after = next
+	}
+}
+
+// buildRequest 将 schema 消息与工具信息转换为 QWen 请求
+func (c *QWenModelClient) buildRequest(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo, stream bool) QWenRequest {
+	var system string
+	if c.SystemAsField {
+		system, messages = splitSystem(messages)
+	}
 	reqMessages := make([]QWenMessage, len(messages))
 	for i, msg := range messages {
-		reqMessages[i] = QWenMessage{
-			Role:    msg.Role.String(),
-			Content: msg.Content,
-		}
+		reqMessages[i] = c.toQWenMessage(msg)
+	}
+	if c.prefill(messages) != "" {
+		reqMessages[len(reqMessages)-1].Partial = true
 	}
 
 	qwenReq := QWenRequest{
 		Model:    model,
+		System:   system,
 		Messages: reqMessages,
-		Stream:   false,
+		Stream:   stream,
+		Extra:    c.Extra,
+	}
+	// 上层传入的参数覆盖客户端自身的 Extra
+	if params := ExtraParamsFromContext(ctx); len(params) > 0 {
+		qwenReq.Extra = mergeParams(c.Extra, params)
+	}
+	if stream {
+		qwenReq.StreamOptions = &QWenStreamOptions{IncludeUsage: true}
 	}
 
-	// 添加工具信息
+	// 添加工具信息（如果有）
 	if len(tools) > 0 {
-		qwenTools := make([]map[string]interface{}, len(tools))
-		for i, toolInfo := range tools {
-			qwenTools[i] = map[string]interface{}{
-				"type": "function",
-				"function": map[string]interface{}{
-					"name":        toolInfo.Name,
-					"description": toolInfo.Desc,
-					"parameters":  toolInfo.Parameters,
-				},
-			}
+		qwenReq.Tools = toolDefinitions(tools)
+		// 该参数仅在携带工具时有效
+		if c.ParallelToolCalls != nil {
+			parallel := *c.ParallelToolCalls
+			qwenReq.ParallelToolCalls = &parallel
 		}
-		qwenReq.Tools = qwenTools
 	}
 
+	if c.Seed != nil {
+		seed := *c.Seed
+		qwenReq.Seed = &seed
+	}
+	// 单次调用指定的用户优先于客户端配置
+	qwenReq.User = c.User
+	if user := RequestUserFromContext(ctx); user != "" {
+		qwenReq.User = user
+	}
+
+	// 仅在开启时请求 logprobs
+	if c.LogProbs {
+		enabled := true
+		qwenReq.LogProbs = &enabled
+		if c.TopLogProbs > 0 {
+			top := c.TopLogProbs
+			qwenReq.TopLogProbs = &top
+		}
+	}
+	return qwenReq
+}
+
+// toolDefinitions renders tools as the function objects of the request's
+// "tools" array.
+func toolDefinitions(tools []*tool.ToolInfo) []map[string]interface{} {
+	defs := make([]map[string]interface{}, len(tools))
+	for i, toolInfo := range tools {
+		function := map[string]interface{}{
+			"name":        toolInfo.Name,
+			"description": toolInfo.Desc,
+			"parameters":  toolInfo.JSONSchema(),
+		}
+		if toolInfo.Strict {
+			function["strict"] = true
+		}
+		defs[i] = map[string]interface{}{
+			"type":     "function",
+			"function": function,
+		}
+	}
+	return defs
+}
+
+// prefill returns the content of a trailing assistant message sent as a
+// prefill, or "" when AssistantPrefill is off or there is none.
+func (c *QWenModelClient) prefill(messages []*schema.Message) string {
+	if !c.AssistantPrefill || len(messages) == 0 {
+		return ""
+	}
+	last := messages[len(messages)-1]
+	if last.Role != schema.RoleAssistant || len(last.ToolCalls) > 0 {
+		return ""
+	}
+	return last.Content
+}
+
+// roleLabel returns the wire label for a role, honoring RoleMapping.
+func (c *QWenModelClient) roleLabel(role schema.Role) string {
+	if label, ok := c.RoleMapping[role]; ok {
+		return label
+	}
+	return role.String()
+}
+
+// roleFromLabel maps a response role label back to a schema.Role. Responses
+// are assistant turns, so any label, such as "model", "tool" or an empty
+// one, is RoleAssistant unless RoleMapping maps a role to it explicitly.
+func (c *QWenModelClient) roleFromLabel(label string) schema.Role {
+	for role, l := range c.RoleMapping {
+		if l == label {
+			return role
+		}
+	}
+	return schema.RoleAssistant
+}
+
+// toQWenMessage converts a schema message to the QWen wire format.
+func (c *QWenModelClient) toQWenMessage(msg *schema.Message) QWenMessage {
+	m := QWenMessage{
+		Role:       c.roleLabel(msg.Role),
+		Content:    msg.Content,
+		ToolCallID: msg.ToolCallID,
+	}
+	if c.PromptCaching && msg.CacheHint {
+		m.CacheControl = &QWenCacheControl{Type: "ephemeral"}
+	}
+	for _, tc := range msg.ToolCalls {
+		typ := tc.Type
+		if typ == "" {
+			typ = "function"
+		}
+		m.ToolCalls = append(m.ToolCalls, QWenToolCall{
+			ID:   tc.ID,
+			Type: typ,
+			Function: QWenFunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			},
+		})
+	}
+	return m
+}
+
+// toSchemaToolCalls converts QWen tool calls to schema tool calls.
+func toSchemaToolCalls(calls []QWenToolCall) []schema.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	out := make([]schema.ToolCall, len(calls))
+	for i, tc := range calls {
+		out[i] = schema.ToolCall{
+			Index: tc.Index,
+			ID:    tc.ID,
+			Type:  tc.Type,
+			Function: schema.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			},
+		}
+	}
+	return out
+}
+
+// toSchemaLogProbs converts QWen logprobs to schema logprobs.
+func toSchemaLogProbs(lp *QWenLogProbs) *schema.LogProbs {
+	if lp == nil {
+		return nil
+	}
+	out := &schema.LogProbs{Content: make([]schema.TokenLogProb, len(lp.Content))}
+	for i, tok := range lp.Content {
+		t := schema.TokenLogProb{Token: tok.Token, LogProb: tok.LogProb, Bytes: tok.Bytes}
+		for _, top := range tok.TopLogProbs {
+			t.TopLogProbs = append(t.TopLogProbs, schema.TopLogProb{Token: top.Token, LogProb: top.LogProb, Bytes: top.Bytes})
+		}
+		out.Content[i] = t
+	}
+	return out
+}
+
+// filteredCategories lists the categories that were filtered, sorted.
+func filteredCategories(results map[string]QWenFilterResult) []string {
+	var out []string
+	for category, r := range results {
+		if r.Filtered {
+			out = append(out, category)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// toSchemaUsage converts QWen usage to schema usage; absent usage is nil.
+func toSchemaUsage(u *QWenUsage) *schema.TokenUsage {
+	if u == nil || *u == (QWenUsage{}) {
+		return nil
+	}
+	return &schema.TokenUsage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+}
+
+// decodeResponse 按 ResponsePath 定位到 choices 所在节点后再解码
+func (c *QWenModelClient) decodeResponse(body []byte, v interface{}) error {
+	node := json.RawMessage(body)
+	for _, key := range c.ResponsePath {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(node, &obj); err != nil {
+			return fmt.Errorf("response path %q: %w", strings.Join(c.ResponsePath, "."), err)
+		}
+		next, ok := obj[key]
+		if !ok {
+			return fmt.Errorf("response path %q: key %q not found", strings.Join(c.ResponsePath, "."), key)
+		}
+		node = next
+	}
+	return json.Unmarshal(node, v)
+}
+
+// requestBody returns the wire body of a request in the configured format.
+func (c *QWenModelClient) requestBody(req QWenRequest) interface{} {
+	if c.NativeFormat {
+		return req.toNative()
+	}
+	return req
+}
+
+// decodeChatResponse decodes a non-streaming response in the configured
+// format.
+func (c *QWenModelClient) decodeChatResponse(body []byte) (QWenResponse, error) {
+	if !c.NativeFormat {
+		var resp QWenResponse
+		err := c.decodeResponse(body, &resp)
+		return resp, err
+	}
+	var resp DashScopeResponse
+	if err := c.decodeResponse(body, &resp); err != nil {
+		return QWenResponse{}, err
+	}
+	return resp.toCompatible(), nil
+}
+
+// decodeStreamChunk decodes one stream chunk in the configured format.
+func (c *QWenModelClient) decodeStreamChunk(data []byte) (QWenStreamResponse, error) {
+	if !c.NativeFormat {
+		var resp QWenStreamResponse
+		err := c.decodeResponse(data, &resp)
+		return resp, err
+	}
+	var resp DashScopeResponse
+	if err := c.decodeResponse(data, &resp); err != nil {
+		return QWenStreamResponse{}, err
+	}
+	return resp.toStreamChunk(), nil
+}
+
+// GenerateMessage 调用 QWen API 获取完整响应
+func (c *QWenModelClient) Generate(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo) (*schema.Message, error) {
+	choices, err := c.generate(ctx, model, messages, tools, 0)
+	if err != nil {
+		return nil, err
+	}
+	return choices[0], nil
+}
+
+// GenerateChoices asks for n completions of the same prompt (the "n"
+// parameter) and returns every choice in index order, e.g. for best-of-N
+// selection. Generate is equivalent to taking the first choice.
+func (c *QWenModelClient) GenerateChoices(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo, n int) ([]*schema.Message, error) {
+	if n < 1 {
+		return nil, errors.New("n must be at least 1")
+	}
+	return c.generate(ctx, model, messages, tools, n)
+}
+
+// generate 发送非流式请求并转换所有 choices；n 为 0 时不发送 n 参数
+func (c *QWenModelClient) generate(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo, n int) ([]*schema.Message, error) {
+	qwenReq := c.buildRequest(ctx, model, messages, tools, false)
+	if n > 0 {
+		qwenReq.N = &n
+	}
+
+	m := metrics.OrNoop(c.Metrics)
+	m.IncRequest(qwenProvider, model)
+	log := logging.OrNoop(c.Logger)
+	log.Debug("model request", "provider", qwenProvider, "model", model, "stream", false)
+	start := time.Now()
+
 	// 使用接口客户端发送请求
-	httpResp, err := c.HTTPClient.Send(ctx, httpclient.HTTPMethodPOST, qwenReq)
+	httpResp, err := c.HTTPClient.Send(ctx, httpclient.HTTPMethodPOST, c.requestBody(qwenReq))
+	m.ObserveLatency(qwenProvider, model, time.Since(start))
 	if err != nil {
+		log.Warn("model request failed", "provider", qwenProvider, "model", model, "error", err)
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	if httpResp.StatusCode != 200 {
-		return nil, fmt.Errorf("API request failed with status %d: %s", httpResp.StatusCode, string(httpResp.Body))
+		log.Warn("model request failed", "provider", qwenProvider, "model", model, "status", httpResp.StatusCode)
+		return nil, newAPIError(httpResp)
 	}
 
 	// 解析响应
-	var qwenResp QWenResponse
-	if err := json.Unmarshal(httpResp.Body, &qwenResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	qwenResp, err := c.decodeChatResponse(httpResp.Body)
+	if err != nil {
+		return nil, newDecodeError("response", httpResp, err)
 	}
 
 	// 检查是否有返回的选择
 	if len(qwenResp.Choices) == 0 {
 		return nil, errors.New("no choices returned from API")
 	}
+	m.ObserveTokens(qwenResp.Usage.PromptTokens, qwenResp.Usage.CompletionTokens)
+	c.observeFingerprint(model, qwenResp.SystemFingerprint)
 
-	// 转换为 schema.Message
-	choice := qwenResp.Choices[0]
-	return &schema.Message{
-		Role:    schema.RoleAssistant,
-		Content: choice.Message.Content,
-	}, nil
+	// 按 index 排序后转换为 schema.Message
+	choices := append([]QWenChoice(nil), qwenResp.Choices...)
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].Index < choices[j].Index })
+	// 预填内容与模型的续写拼接为完整回答
+	prefill := c.prefill(messages)
+	out := make([]*schema.Message, len(choices))
+	for i, choice := range choices {
+		out[i] = &schema.Message{
+			Role:             c.roleFromLabel(choice.Message.Role),
+			Content:          prefill + choice.Message.Content,
+			ReasoningContent: choice.Message.ReasoningContent,
+			ToolCalls:        toSchemaToolCalls(choice.Message.ToolCalls),
+			ChoiceIndex:      choice.Index,
+			ResponseMeta: &schema.ResponseMeta{
+				FinishReason:       schema.NormalizeFinishReason(choice.FinishReason),
+				RawFinishReason:    choice.FinishReason,
+				FilteredCategories: filteredCategories(choice.ContentFilterResults),
+				Usage:              toSchemaUsage(&qwenResp.Usage),
+				LogProbs:           toSchemaLogProbs(choice.LogProbs),
+				SystemFingerprint:  qwenResp.SystemFingerprint,
+			},
+		}
+	}
+	return out, nil
+}
+
+// observeFingerprint records the fingerprint of a response for model and
+// reports a change to OnFingerprintChange while a Seed is set.
+func (c *QWenModelClient) observeFingerprint(model, fingerprint string) {
+	if fingerprint == "" || c.Seed == nil || c.OnFingerprintChange == nil || c.fingerprints == nil {
+		return
+	}
+	if prev, loaded := c.fingerprints.Swap(model, fingerprint); loaded && prev.(string) != fingerprint {
+		c.OnFingerprintChange(model, prev.(string), fingerprint)
+	}
+}
+
+// StreamWithCancel is Stream with a CancelFunc for callers that don't own
+// ctx. Calling it aborts the request, which closes the HTTP body, and ends
+// the stream: the message channel is closed and context.Canceled is sent on
+// the error channel, whether or not the caller keeps reading.
+func (c *QWenModelClient) StreamWithCancel(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo) (<-chan *schema.Message, <-chan error, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	msgs, errs := c.Stream(ctx, model, messages, tools)
+	return msgs, errs, cancel
 }
 
 // GenerateMessageStream 通过流式方式调用 QWen API
+//
+// Deltas are sent as they arrive. A clean end of the stream is followed by
+// one message with Final set that holds the assembled content, tool calls,
+// finish reason and usage. Typed server-sent events are dispatched by their
+// "event:" field: "error" ends the stream with ErrStreamErrorEvent, "done"
+// ends it like "data: [DONE]", and any other event is read as data.
 func (c *QWenModelClient) Stream(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo) (<-chan *schema.Message, <-chan error) {
-	msgChan := make(chan *schema.Message, 10)
+	return c.stream(ctx, model, messages, tools, 0)
+}
+
+// StreamChoices streams n completions of the same prompt, e.g. for best-of-N
+// selection. Deltas of all choices arrive interleaved on one channel, each
+// tagged with its ChoiceIndex; a clean end of the stream is followed by one
+// Final message per choice, in index order.
+func (c *QWenModelClient) StreamChoices(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo, n int) (<-chan *schema.Message, <-chan error) {
+	if n < 1 {
+		msgChan := make(chan *schema.Message)
+		errChan := make(chan error, 1)
+		errChan <- errors.New("n must be at least 1")
+		close(msgChan)
+		close(errChan)
+		return msgChan, errChan
+	}
+	return c.stream(ctx, model, messages, tools, n)
+}
+
+// stream 发送流式请求并按 choice index 分别累积增量；n 为 0 时不发送 n 参数
+func (c *QWenModelClient) stream(ctx context.Context, model string, messages []*schema.Message, tools []*tool.ToolInfo, n int) (<-chan *schema.Message, <-chan error) {
+	msgChan := make(chan *schema.Message, c.StreamBuffer)
 	errChan := make(chan error, 1)
 
 	go func() {
 		defer close(msgChan)
 		defer close(errChan)
 
-		// 构建请求
-		reqMessages := make([]QWenMessage, len(messages))
-		for i, msg := range messages {
-			reqMessages[i] = QWenMessage{
-				Role:    msg.Role.String(),
-				Content: msg.Content,
+		// 消费者过慢时阻塞等待，ctx 结束时退出，避免 goroutine 泄漏
+		send := func(msg *schema.Message) bool {
+			select {
+			case msgChan <- msg:
+				return true
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return false
 			}
 		}
 
-		qwenReq := QWenRequest{
-			Model:    model,
-			Messages: reqMessages,
-			Stream:   true,
+		qwenReq := c.buildRequest(ctx, model, messages, tools, true)
+		if n > 0 {
+			qwenReq.N = &n
 		}
 
-		// 添加工具信息（如果有）
-		if len(tools) > 0 {
-			qwenTools := make([]map[string]interface{}, len(tools))
-			for i, toolInfo := range tools {
-				qwenTools[i] = map[string]interface{}{
-					"type": "function",
-					"function": map[string]interface{}{
-						"name":        toolInfo.Name,
-						"description": toolInfo.Desc,
-						"parameters":  toolInfo.Parameters,
-					},
-				}
+		// 流式请求的耗时按整个流计算
+		m := metrics.OrNoop(c.Metrics)
+		m.IncRequest(qwenProvider, model)
+		logging.OrNoop(c.Logger).Debug("model request", "provider", qwenProvider, "model", model, "stream", true)
+		start := time.Now()
+		defer func() { m.ObserveLatency(qwenProvider, model, time.Since(start)) }()
+		// 用量以流中最后一次报告为准，只记录一次；流提前结束时同样记录已报告的用量
+		var streamUsage *QWenUsage
+		defer func() {
+			if streamUsage != nil {
+				m.ObserveTokens(streamUsage.PromptTokens, streamUsage.CompletionTokens)
 			}
-			qwenReq.Tools = qwenTools
-		}
+		}()
 
-		// 为流式创建 Accept 为 SSE 的客户端临时实例
-		base := c.BaseUrl
-		if base == "" {
-			base = "https://dashscope.aliyuncs.com/compatible-mode/v1"
+		// 退出时取消请求，确保底层连接被释放
+		streamCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream, errs := c.StreamHTTPClient.SendStream(streamCtx, httpclient.HTTPMethodPOST, c.requestBody(qwenReq))
+
+		// 相邻数据块之间的空闲计时器
+		var idle <-chan time.Time
+		resetIdle := func() {}
+		if c.StreamIdleTimeout > 0 {
+			timer := time.NewTimer(c.StreamIdleTimeout)
+			defer timer.Stop()
+			idle = timer.C
+			resetIdle = func() { timer.Reset(c.StreamIdleTimeout) }
 		}
-		header := httpclient.HTTPHeader{
-			"Content-Type":  "application/json",
-			"Accept":        "text/event-stream",
-			"Authorization": "Bearer " + c.AuthToken,
+
+		// 每个 choice 各自累积增量，流结束时按 index 顺序发出带完整内容与元数据的最终消息
+		type choiceState struct {
+			acc          schema.MessageAccumulator
+			finishReason string
+			filtered     []string
 		}
-		sseClient := httpclient.NewHTTPClient(base, c.Path,
-			httpclient.WithHeader(header),
-			httpclient.WithTimeout(c.Timeout),
+		var (
+			states      = map[int]*choiceState{}
+			usage       *schema.TokenUsage
+			fingerprint string
 		)
+		state := func(index int) *choiceState {
+			st, ok := states[index]
+			if !ok {
+				st = &choiceState{}
+				states[index] = st
+			}
+			return st
+		}
+		emit := func(index int, delta *schema.Message) bool {
+			delta.ChoiceIndex = index
+			state(index).acc.Add(delta)
+			return send(delta)
+		}
+		finish := func() {
+			indexes := make([]int, 0, len(states))
+			for index := range states {
+				indexes = append(indexes, index)
+			}
+			sort.Ints(indexes)
+			c.observeFingerprint(model, fingerprint)
+			for _, index := range indexes {
+				st := states[index]
+				final := st.acc.Finalize()
+				final.Final = true
+				final.ChoiceIndex = index
+				final.ResponseMeta = &schema.ResponseMeta{
+					FinishReason:       schema.NormalizeFinishReason(st.finishReason),
+					RawFinishReason:    st.finishReason,
+					FilteredCategories: st.filtered,
+					Usage:              usage,
+					SystemFingerprint:  fingerprint,
+				}
+				if !send(final) {
+					return
+				}
+			}
+		}
 
-		stream, errs := sseClient.SendStream(ctx, httpclient.HTTPMethodPOST, qwenReq)
+		// 预填内容在 choice 收到第一个数据块时作为它的第一个增量发出，拼接结果随之包含它
+		prefill := c.prefill(messages)
 
 		// 读取流式响应与解析 SSE
 		var buf bytes.Buffer
+		// 非 200 响应的状态码，其响应体读完后作为 APIError 返回
+		var errStatus int
+		// 当前事件的 event 字段，空行结束一个事件
+		var event string
 		for {
 			select {
 			case chunk, ok := <-stream:
 				if !ok {
+					// 数据通道关闭前可能已写入错误
+					select {
+					case err, ok := <-errs:
+						if ok && err != nil {
+							errChan <- fmt.Errorf("failed to read stream: %w", err)
+							return
+						}
+					default:
+					}
+					if errStatus != 0 {
+						logging.OrNoop(c.Logger).Warn("model request failed", "provider", qwenProvider, "model", model, "status", errStatus)
+						errChan <- newAPIError(&httpclient.HTTPResponse{StatusCode: errStatus, Body: buf.Bytes()})
+						return
+					}
+					finish()
 					return
 				}
+				resetIdle()
 				buf.Write(chunk.Body)
+				// 未携带状态码的数据块按成功处理
+				if errStatus != 0 || (chunk.StatusCode != 0 && chunk.StatusCode != 200) {
+					errStatus = chunk.StatusCode
+					continue
+				}
 				for {
 					line, err := buf.ReadString('\n')
 					if err != nil {
@@ -271,38 +1265,86 @@ func (c *QWenModelClient) Stream(ctx context.Context, model string, messages []*
 					}
 
 					line = strings.TrimRight(line, "\r\n")
-					if line == "" || strings.HasPrefix(line, ":") {
+					if line == "" {
+						event = ""
 						continue
 					}
-					if !strings.HasPrefix(line, "data: ") {
+					if strings.HasPrefix(line, ":") {
 						continue
 					}
-					data := strings.TrimPrefix(line, "data: ")
-					if data == "[DONE]" {
+					if name, ok := strings.CutPrefix(line, "event:"); ok {
+						event = strings.TrimSpace(name)
+						continue
+					}
+					// native 模式的 data 行冒号后没有空格
+					data, ok := strings.CutPrefix(line, "data:")
+					if !ok {
+						continue
+					}
+					data = strings.TrimPrefix(data, " ")
+					// error 事件的数据作为错误返回，done 事件与 [DONE] 一样正常结束；其他事件按数据处理
+					switch {
+					case event == "error":
+						errChan <- fmt.Errorf("%w: %s", ErrStreamErrorEvent, data)
+						return
+					case event == "done" || data == "[DONE]":
+						finish()
 						return
 					}
-					var streamResp QWenStreamResponse
-					if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
+					streamResp, err := c.decodeStreamChunk([]byte(data))
+					if err != nil {
 						continue
 					}
-					if len(streamResp.Choices) > 0 {
-						choice := streamResp.Choices[0]
-						if choice.Delta.Content != "" {
-							msgChan <- &schema.Message{
-								Role:    schema.RoleAssistant,
-								Content: choice.Delta.Content,
+					if streamResp.Usage != nil {
+						usage = toSchemaUsage(streamResp.Usage)
+						streamUsage = streamResp.Usage
+					}
+					if streamResp.SystemFingerprint != "" {
+						fingerprint = streamResp.SystemFingerprint
+					}
+					for _, choice := range streamResp.Choices {
+						if _, seen := states[choice.Index]; !seen && prefill != "" {
+							if !emit(choice.Index, &schema.Message{Role: schema.RoleAssistant, Content: prefill}) {
+								return
+							}
+						}
+						st := state(choice.Index)
+						if choice.FinishReason != "" {
+							st.finishReason = choice.FinishReason
+						}
+						if categories := filteredCategories(choice.ContentFilterResults); len(categories) > 0 {
+							st.filtered = categories
+						}
+						// 推理内容与回答内容分别发出，便于上层区分展示
+						if d := choice.Delta; d.ReasoningContent != "" {
+							if !emit(choice.Index, &schema.Message{Role: c.roleFromLabel(d.Role), ReasoningContent: d.ReasoningContent}) {
+								return
+							}
+						}
+						if d := choice.Delta; d.Content != "" || len(d.ToolCalls) > 0 {
+							if !emit(choice.Index, &schema.Message{
+								Role:      c.roleFromLabel(d.Role),
+								Content:   d.Content,
+								ToolCalls: toSchemaToolCalls(d.ToolCalls),
+							}) {
+								return
 							}
 						}
 					}
 				}
 			case err, ok := <-errs:
 				if !ok {
-					return
+					// 错误通道关闭时数据可能尚未读完，继续读取直到数据通道关闭
+					errs = nil
+					continue
 				}
 				if err != nil {
 					errChan <- fmt.Errorf("failed to read stream: %w", err)
 					return
 				}
+			case <-idle:
+				errChan <- fmt.Errorf("%w: no data received for %s", ErrStreamIdleTimeout, c.StreamIdleTimeout)
+				return
 			case <-ctx.Done():
 				errChan <- ctx.Err()
 				return
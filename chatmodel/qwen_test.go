@@ -0,0 +1,1444 @@
+package chatmodel_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reAct-agent/chatmodel"
+	httpclient "reAct-agent/http_client"
+	"reAct-agent/schema"
+	"reAct-agent/tool"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockHTTPClient returns a fixed response and records every request body.
+type mockHTTPClient struct {
+	status   int
+	body     string
+	requests []interface{}
+}
+
+func (m *mockHTTPClient) Send(ctx context.Context, method httpclient.HTTPMethod, body interface{}) (*httpclient.HTTPResponse, error) {
+	m.requests = append(m.requests, body)
+	status := m.status
+	if status == 0 {
+		status = 200
+	}
+	return &httpclient.HTTPResponse{Body: []byte(m.body), StatusCode: status}, nil
+}
+
+func (m *mockHTTPClient) SendStream(ctx context.Context, method httpclient.HTTPMethod, body interface{}) (httpclient.IOReader, httpclient.IOError) {
+	out := make(chan httpclient.HTTPResponse, 1)
+	errs := make(chan error, 1)
+	m.requests = append(m.requests, body)
+	status := m.status
+	if status == 0 {
+		status = 200
+	}
+	out <- httpclient.HTTPResponse{Body: []byte(m.body), StatusCode: status}
+	close(out)
+	close(errs)
+	return out, errs
+}
+
+// lastRequestJSON returns the JSON encoding of the last recorded request.
+func (m *mockHTTPClient) lastRequestJSON(t *testing.T) map[string]interface{} {
+	t.Helper()
+	if len(m.requests) == 0 {
+		t.Fatal("no request recorded")
+	}
+	b, err := json.Marshal(m.requests[len(m.requests)-1])
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("unmarshal request: %v", err)
+	}
+	return out
+}
+
+func newTestClient(t *testing.T, mock *mockHTTPClient, opts ...chatmodel.Option) *chatmodel.QWenModelClient {
+	t.Helper()
+	c, err := chatmodel.NewQWenModelClient("test-key", append([]chatmodel.Option{chatmodel.WithHTTPClient(mock)}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	return c
+}
+
+var userHello = []*schema.Message{{Role: schema.RoleUser, Content: "hello"}}
+
+func TestGenerateParsesLogProbs(t *testing.T) {
+	mock := &mockHTTPClient{body: `{
+		"choices": [{
+			"index": 0,
+			"message": {"role": "assistant", "content": "Yes"},
+			"finish_reason": "stop",
+			"logprobs": {"content": [{
+				"token": "Yes",
+				"logprob": -0.01,
+				"bytes": [89, 101, 115],
+				"top_logprobs": [
+					{"token": "Yes", "logprob": -0.01},
+					{"token": "No", "logprob": -4.6}
+				]
+			}]}
+		}]
+	}`}
+	c := newTestClient(t, mock, chatmodel.WithLogProbs(2))
+
+	msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	req := mock.lastRequestJSON(t)
+	if req["logprobs"] != true || req["top_logprobs"] != float64(2) {
+		t.Fatalf("logprobs not requested: %v", req)
+	}
+
+	lp := msg.ResponseMeta.LogProbs
+	if lp == nil || len(lp.Content) != 1 {
+		t.Fatalf("logprobs not parsed: %+v", msg.ResponseMeta)
+	}
+	tok := lp.Content[0]
+	if tok.Token != "Yes" || tok.LogProb != -0.01 || len(tok.Bytes) != 3 {
+		t.Fatalf("unexpected token logprob %+v", tok)
+	}
+	if len(tok.TopLogProbs) != 2 || tok.TopLogProbs[1].Token != "No" || tok.TopLogProbs[1].LogProb != -4.6 {
+		t.Fatalf("unexpected top logprobs %+v", tok.TopLogProbs)
+	}
+}
+
+func TestGenerateOmitsLogProbsByDefault(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"choices":[{"message":{"role":"assistant","content":"hi"}}]}`}
+	c := newTestClient(t, mock)
+
+	msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	req := mock.lastRequestJSON(t)
+	if _, ok := req["logprobs"]; ok {
+		t.Fatalf("logprobs should not be requested: %v", req)
+	}
+	if _, ok := req["top_logprobs"]; ok {
+		t.Fatalf("top_logprobs should not be requested: %v", req)
+	}
+	if msg.ResponseMeta.LogProbs != nil {
+		t.Fatalf("unexpected logprobs %+v", msg.ResponseMeta.LogProbs)
+	}
+}
+
+func TestWithLogProbsRejectsNegative(t *testing.T) {
+	_, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithLogProbs(-1))
+	if err == nil || !strings.Contains(err.Error(), "negative") {
+		t.Fatalf("expected negative topLogProbs to be rejected, got %v", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	var gotAuth, gotMethod, gotPath string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth, gotMethod, gotPath = r.Header.Get("Authorization"), r.Method, r.URL.Path
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{"object":"list","data":[]}`))
+		} else {
+			w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	c, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithBaseUrl(srv.URL))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	if gotMethod != http.MethodGet || gotPath != "/models" || gotAuth != "Bearer test-key" {
+		t.Fatalf("unexpected ping request %s %s auth=%q", gotMethod, gotPath, gotAuth)
+	}
+
+	status = http.StatusUnauthorized
+	err = c.Ping(context.Background())
+	if !errors.Is(err, chatmodel.ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+	var apiErr *chatmodel.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected *APIError with status 401, got %v", err)
+	}
+
+	// ChatModel 透传 Ping
+	cm, err := chatmodel.NewChatModel(context.Background(), &chatmodel.ChatModelConfig{Client: c, APIKey: "test-key", Model: "qwen-test"})
+	if err != nil {
+		t.Fatalf("NewChatModel failed: %v", err)
+	}
+	if err := cm.Ping(context.Background()); !errors.Is(err, chatmodel.ErrUnauthorized) {
+		t.Fatalf("ChatModel.Ping: expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestPingUsesSuppliedHTTPClient(t *testing.T) {
+	var gotAuth, gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth, gotPath = r.Header.Get("Authorization"), r.URL.Path
+		w.Write([]byte(`{"object":"list","data":[]}`))
+	}))
+	defer srv.Close()
+
+	// 未设置 BaseUrl 时 models 地址取自客户端自身，而不是默认服务商
+	hc := httpclient.NewHTTPClient(srv.URL+"/v1", "chat/completions", httpclient.WithHeader(httpclient.HTTPHeader{"Authorization": "Bearer own-key"}))
+	c, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithHTTPClient(hc))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	if gotPath != "/v1/models" || gotAuth != "Bearer own-key" {
+		t.Fatalf("Ping should go through the supplied client to its /models, got %s auth=%q", gotPath, gotAuth)
+	}
+
+	// 录制客户端报告被包装客户端的地址，同样可用于 models 接口
+	rec, err := httpclient.NewRecordingHTTPClient(hc, filepath.Join(t.TempDir(), "cassette.json"), httpclient.RecordingMode)
+	if err != nil {
+		t.Fatalf("NewRecordingHTTPClient failed: %v", err)
+	}
+	c, err = chatmodel.NewQWenModelClient("test-key", chatmodel.WithHTTPClient(rec))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	gotPath = ""
+	if err := c.Ping(context.Background()); err != nil || gotPath != "/v1/models" {
+		t.Fatalf("Ping should go through the recording client to /v1/models, got %v and %q", err, gotPath)
+	}
+
+	// 无法得知地址的客户端不会被发往默认地址
+	c, err = chatmodel.NewQWenModelClient("test-key", chatmodel.WithHTTPClient(&mockHTTPClient{}))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	if err := c.Ping(context.Background()); !errors.Is(err, chatmodel.ErrNoModelsURL) {
+		t.Fatalf("expected ErrNoModelsURL, got %v", err)
+	}
+
+	// 显式指定的 models 客户端优先
+	mock := &mockHTTPClient{body: `{"data":[]}`}
+	c, err = chatmodel.NewQWenModelClient("test-key", chatmodel.WithHTTPClient(hc), chatmodel.WithModelsHTTPClient(mock))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil || len(mock.requests) != 1 {
+		t.Fatalf("Ping should use WithModelsHTTPClient, got err=%v and %d requests", err, len(mock.requests))
+	}
+}
+
+func TestListModelsUsesSuppliedHTTPClient(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"object":"list","data":[{"id":"qwen-plus","object":"model"}]}`}
+	c := newTestClient(t, mock, chatmodel.WithModelsHTTPClient(mock))
+
+	models, err := c.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(mock.requests) != 1 || len(models) != 1 || models[0].ID != "qwen-plus" {
+		t.Fatalf("ListModels should go through the supplied client, got %d requests and %+v", len(mock.requests), models)
+	}
+}
+
+func TestListModelsSendsToSuppliedClientBaseURL(t *testing.T) {
+	var gotPaths []string
+	own := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer own-key" {
+			t.Errorf("unexpected auth %q", r.Header.Get("Authorization"))
+		}
+		gotPaths = append(gotPaths, r.URL.Path+"?"+r.URL.RawQuery)
+		if r.URL.Query().Get("after") == "" {
+			w.Write([]byte(`{"data":[{"id":"own-a"}],"has_more":true}`))
+			return
+		}
+		w.Write([]byte(`{"data":[{"id":"own-b"}]}`))
+	}))
+	defer own.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the configured BaseUrl should not receive the supplied client's request %s", r.URL.Path)
+	}))
+	defer other.Close()
+
+	hc := httpclient.NewHTTPClient(own.URL+"/api/", "chat/completions", httpclient.WithHeader(httpclient.HTTPHeader{"Authorization": "Bearer own-key"}))
+	c, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithBaseUrl(other.URL), chatmodel.WithHTTPClient(hc))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	models, err := c.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 2 || models[1].ID != "own-b" {
+		t.Fatalf("unexpected models %+v", models)
+	}
+	if strings.Join(gotPaths, ",") != "/api/models?,/api/models?after=own-a" {
+		t.Fatalf("unexpected models requests %q", gotPaths)
+	}
+}
+
+func TestListModels(t *testing.T) {
+	var afters []string
+	unauthorized := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unauthorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+			return
+		}
+		if r.URL.Path != "/models" || r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("unexpected request %s auth=%q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		after := r.URL.Query().Get("after")
+		afters = append(afters, after)
+		switch after {
+		case "":
+			w.Write([]byte(`{"object":"list","data":[
+				{"id":"qwen-plus","object":"model","created":1719000000,"owned_by":"system"},
+				{"id":"qwen-max","object":"model","created":1719000001,"owned_by":"system"}
+			],"has_more":true}`))
+		case "qwen-max":
+			w.Write([]byte(`{"object":"list","data":[{"id":"qwen-turbo","object":"model","created":1719000002,"owned_by":"system"}],"has_more":false}`))
+		default:
+			t.Errorf("unexpected cursor %q", after)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithBaseUrl(srv.URL))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	defer c.Close()
+	models, err := c.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	want := []chatmodel.ModelInfo{
+		{ID: "qwen-plus", Created: 1719000000, OwnedBy: "system"},
+		{ID: "qwen-max", Created: 1719000001, OwnedBy: "system"},
+		{ID: "qwen-turbo", Created: 1719000002, OwnedBy: "system"},
+	}
+	if !reflect.DeepEqual(models, want) {
+		t.Fatalf("unexpected models %+v", models)
+	}
+	if strings.Join(afters, ",") != ",qwen-max" {
+		t.Fatalf("unexpected pagination cursors %q", afters)
+	}
+
+	unauthorized = true
+	if _, err := c.ListModels(context.Background()); !errors.Is(err, chatmodel.ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestGenerateWithResponsePath(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"code":0,"data":{"result":{"choices":[{"message":{"role":"assistant","content":"wrapped"}}]}}}`}
+	c := newTestClient(t, mock, chatmodel.WithResponsePath([]string{"data", "result"}))
+
+	msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if msg.Content != "wrapped" {
+		t.Fatalf("unexpected content %q", msg.Content)
+	}
+
+	// 路径不存在时返回清晰的错误
+	mock.body = `{"data":{}}`
+	if _, err := c.Generate(context.Background(), "qwen-test", userHello, nil); err == nil || !strings.Contains(err.Error(), `key "result" not found`) {
+		t.Fatalf("expected missing path error, got %v", err)
+	}
+}
+
+func TestRoleMapping(t *testing.T) {
+	history := []*schema.Message{
+		{Role: schema.RoleSystem, Content: "be brief"},
+		{Role: schema.RoleUser, Content: "hi"},
+		{Role: schema.RoleAssistant, Content: "hello"},
+		{Role: schema.RoleUser, Content: "bye"},
+	}
+	roles := func(c *chatmodel.QWenModelClient, mock *mockHTTPClient) []string {
+		if _, err := c.Generate(context.Background(), "qwen-test", history, nil); err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		var out []string
+		for _, m := range mock.requests[len(mock.requests)-1].(chatmodel.QWenRequest).Messages {
+			out = append(out, m.Role)
+		}
+		return out
+	}
+	reply := `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`
+
+	mock := &mockHTTPClient{body: reply}
+	if got := strings.Join(roles(newTestClient(t, mock), mock), ","); got != "system,user,assistant,user" {
+		t.Fatalf("default mapping changed: %s", got)
+	}
+
+	mock = &mockHTTPClient{body: reply}
+	c := newTestClient(t, mock, chatmodel.WithRoleMapping(map[schema.Role]string{
+		schema.RoleUser:      "human",
+		schema.RoleAssistant: "ai",
+	}))
+	if got := strings.Join(roles(c, mock), ","); got != "system,human,ai,human" {
+		t.Fatalf("custom mapping not applied: %s", got)
+	}
+	// schema 本身不受影响
+	if schema.RoleUser.String() != "user" {
+		t.Fatal("schema role labels must stay provider-agnostic")
+	}
+}
+
+func TestRoleMappingRejectsDuplicateLabels(t *testing.T) {
+	_, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithRoleMapping(map[schema.Role]string{
+		schema.RoleUser:      "human",
+		schema.RoleAssistant: "human",
+	}))
+	if err == nil || !strings.Contains(err.Error(), `share the label "human"`) {
+		t.Fatalf("expected duplicate labels to be rejected, got %v", err)
+	}
+}
+
+func TestResponseRoleIsMappedBack(t *testing.T) {
+	cases := []struct {
+		label string
+		opts  []chatmodel.Option
+	}{
+		{label: "assistant"},
+		{label: "model"},
+		{label: "tool"},
+		{label: "user"},
+		{label: "bot", opts: []chatmodel.Option{chatmodel.WithRoleMapping(map[schema.Role]string{schema.RoleAssistant: "bot"})}},
+	}
+	for _, tc := range cases {
+		mock := &mockHTTPClient{body: `{"choices":[{"message":{"role":"` + tc.label + `","content":"Final Answer: hi"}}]}`}
+		msg, err := newTestClient(t, mock, tc.opts...).Generate(context.Background(), "qwen-test", userHello, nil)
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if msg.Role != schema.RoleAssistant {
+			t.Fatalf("role %q decoded as %s, want assistant", tc.label, msg.Role)
+		}
+	}
+
+	mock := &mockHTTPClient{body: "data: " + `{"choices":[{"index":0,"delta":{"role":"model","content":"hi"}}]}` + "\n\ndata: [DONE]\n\n"}
+	msgs, errs := newTestClient(t, mock).Stream(context.Background(), "qwen-test", userHello, nil)
+	for m := range msgs {
+		if m.Role != schema.RoleAssistant {
+			t.Fatalf("streamed role decoded as %s, want assistant", m.Role)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	released := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"Hel"}}]}` + "\n\n"))
+		w.(http.Flusher).Flush()
+		// 之后既不发送数据也不发送 [DONE]
+		select {
+		case <-r.Context().Done():
+		case <-released:
+		}
+	}))
+	defer srv.Close()
+	defer close(released)
+
+	c, err := chatmodel.NewQWenModelClient("test-key",
+		chatmodel.WithBaseUrl(srv.URL),
+		chatmodel.WithStreamIdleTimeout(100*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+
+	start := time.Now()
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	var content string
+	for m := range msgs {
+		content += m.Content
+	}
+	err = <-errs
+	if !errors.Is(err, chatmodel.ErrStreamIdleTimeout) {
+		t.Fatalf("expected ErrStreamIdleTimeout, got %v", err)
+	}
+	if content != "Hel" {
+		t.Fatalf("expected the chunk before the stall, got %q", content)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("idle timeout took too long: %s", elapsed)
+	}
+}
+
+func TestStreamWithCancelStopsTheStream(t *testing.T) {
+	disconnected := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"Hel"}}]}` + "\n\n"))
+		w.(http.Flusher).Flush()
+		// 保持连接直到客户端断开
+		<-r.Context().Done()
+		close(disconnected)
+	}))
+	defer srv.Close()
+
+	c, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithBaseUrl(srv.URL))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	msgs, errs, stop := c.StreamWithCancel(context.Background(), "qwen-test", userHello, nil)
+	if m := <-msgs; m == nil || m.Content != "Hel" {
+		t.Fatalf("expected the first delta, got %+v", m)
+	}
+	stop()
+
+	// 不继续读取消息，goroutine 也应退出并关闭通道
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream goroutine did not exit after cancel")
+	}
+	if _, ok := <-msgs; ok {
+		t.Fatal("message channel should be closed")
+	}
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("HTTP body was not closed after cancel")
+	}
+}
+
+func TestGenerateChoicesReturnsAllChoices(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"choices":[
+		{"index":2,"message":{"role":"assistant","content":"third"}},
+		{"index":0,"message":{"role":"assistant","content":"first"}},
+		{"index":1,"message":{"role":"assistant","content":"second"}}
+	]}`}
+	c := newTestClient(t, mock)
+
+	choices, err := c.GenerateChoices(context.Background(), "qwen-test", userHello, nil, 3)
+	if err != nil {
+		t.Fatalf("GenerateChoices failed: %v", err)
+	}
+	if got := mock.lastRequestJSON(t)["n"]; got != float64(3) {
+		t.Fatalf("expected n=3 in request, got %v", got)
+	}
+	if len(choices) != 3 {
+		t.Fatalf("expected 3 choices, got %d", len(choices))
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		if choices[i].Content != want {
+			t.Fatalf("choice %d: got %q, want %q", i, choices[i].Content, want)
+		}
+	}
+
+	// Generate 仍只返回第一个选择，且不发送 n
+	msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if msg.Content != "first" {
+		t.Fatalf("Generate should return the first choice, got %q", msg.Content)
+	}
+	if _, ok := mock.lastRequestJSON(t)["n"]; ok {
+		t.Fatal("n should be omitted by Generate")
+	}
+
+	if _, err := c.GenerateChoices(context.Background(), "qwen-test", userHello, nil, 0); err == nil {
+		t.Fatal("expected error for n=0")
+	}
+}
+
+func TestExtraFieldsAreMerged(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`}
+	c := newTestClient(t, mock, chatmodel.WithExtra(map[string]interface{}{
+		"enable_thinking": false,
+		"result_format":   "message",
+		"model":           "overwritten",
+		"stream":          true,
+	}))
+	if _, err := c.Generate(context.Background(), "qwen-test", userHello, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	req := mock.lastRequestJSON(t)
+	if req["enable_thinking"] != false || req["result_format"] != "message" {
+		t.Fatalf("extra fields missing from request: %v", req)
+	}
+	if req["model"] != "qwen-test" {
+		t.Fatalf("extra field overwrote model: %v", req["model"])
+	}
+	if _, ok := req["stream"]; ok {
+		t.Fatalf("extra field overwrote stream: %v", req["stream"])
+	}
+	if msgs, ok := req["messages"].([]interface{}); !ok || len(msgs) != 1 {
+		t.Fatalf("core fields lost: %v", req)
+	}
+}
+
+func TestClientIsSafeForConcurrentUse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"hello"}}]}`))
+			return
+		}
+		if r.Header.Get("Accept") != "text/event-stream" {
+			http.Error(w, "stream without SSE accept header", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"hel"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"lo"}}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer srv.Close()
+
+	c, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithBaseUrl(srv.URL))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+	defer c.Close()
+
+	const workers = 16
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		stream := i%2 == 1
+		go func() {
+			var content string
+			if stream {
+				msgs, streamErrs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+				for m := range msgs {
+					if !m.Final {
+						content += m.Content
+					}
+				}
+				if err := <-streamErrs; err != nil {
+					errs <- err
+					return
+				}
+			} else {
+				msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+				if err != nil {
+					errs <- err
+					return
+				}
+				content = msg.Content
+			}
+			if content != "hello" {
+				errs <- errors.New("unexpected content " + content)
+				return
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReasoningContentIsSeparated(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","reasoning_content":"2 plus 2 is 4.","content":"4"}}]}`}
+	c := newTestClient(t, mock)
+	msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if msg.ReasoningContent != "2 plus 2 is 4." || msg.Content != "4" {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	mock.body = `data: {"choices":[{"index":0,"delta":{"reasoning_content":"2 plus "}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"reasoning_content":"2 is 4."}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"content":"4"}}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	var reasoning, answer []string
+	var deltas []*schema.Message
+	for m := range msgs {
+		deltas = append(deltas, m)
+		if m.Final {
+			continue
+		}
+		if m.ReasoningContent != "" {
+			if m.Content != "" {
+				t.Fatalf("reasoning and answer mixed in one delta: %+v", m)
+			}
+			reasoning = append(reasoning, m.ReasoningContent)
+		} else {
+			answer = append(answer, m.Content)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(reasoning) != 2 || strings.Join(answer, "") != "4" {
+		t.Fatalf("unexpected deltas: reasoning %q, answer %q", reasoning, answer)
+	}
+	full := schema.ConcatMessages(deltas)
+	if full.ReasoningContent != "2 plus 2 is 4." || full.Content != "4" {
+		t.Fatalf("unexpected concatenated message %+v", full)
+	}
+}
+
+func TestStreamErrorEventSurfacesOnErrChan(t *testing.T) {
+	mock := &mockHTTPClient{body: `data: {"choices":[{"index":0,"delta":{"content":"par"}}]}` + "\n\n" +
+		"event: error\n" + `data: {"code":"InternalError","message":"backend overloaded"}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"content":"tial"}}]}` + "\n\n"}
+	c := newTestClient(t, mock)
+
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	var content string
+	for m := range msgs {
+		if m.Final {
+			t.Fatal("an error event should not produce a final message")
+		}
+		content += m.Content
+	}
+	err := <-errs
+	if !errors.Is(err, chatmodel.ErrStreamErrorEvent) || !strings.Contains(err.Error(), "backend overloaded") {
+		t.Fatalf("expected ErrStreamErrorEvent with the event data, got %v", err)
+	}
+	if content != "par" {
+		t.Fatalf("deltas after the error event should be dropped, got %q", content)
+	}
+}
+
+func TestStreamDoneEventEndsCleanly(t *testing.T) {
+	// message 事件按数据处理，done 事件之后的内容不再读取
+	mock := &mockHTTPClient{body: "event: message\n" + `data: {"choices":[{"index":0,"delta":{"content":"hi"}}]}` + "\n\n" +
+		"event: done\ndata: {}\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"content":" there"}}]}` + "\n\n"}
+	c := newTestClient(t, mock)
+
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	var final *schema.Message
+	var deltas int
+	for m := range msgs {
+		if m.Final {
+			final = m
+			continue
+		}
+		deltas++
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if deltas != 1 || final == nil || final.Content != "hi" {
+		t.Fatalf("expected one delta and a final %q, got %d deltas and %+v", "hi", deltas, final)
+	}
+}
+
+func TestStreamChoicesAssemblesEachIndex(t *testing.T) {
+	// 两个 choice 的增量交错到达
+	mock := &mockHTTPClient{body: strings.Join([]string{
+		`data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`data: {"choices":[{"index":1,"delta":{"role":"assistant","content":"Good"}}]}`,
+		`data: {"choices":[{"index":1,"delta":{"content":"bye"}},{"index":0,"delta":{"content":"lo"}}]}`,
+		`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+		`data: {"choices":[{"index":1,"delta":{},"finish_reason":"length"}]}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"}
+	c := newTestClient(t, mock)
+
+	msgs, errs := c.StreamChoices(context.Background(), "qwen-test", userHello, nil, 2)
+	deltas := map[int]string{}
+	var finals []*schema.Message
+	for m := range msgs {
+		if m.Final {
+			finals = append(finals, m)
+			continue
+		}
+		deltas[m.ChoiceIndex] += m.Content
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("StreamChoices failed: %v", err)
+	}
+	if got := mock.lastRequestJSON(t)["n"]; got != float64(2) {
+		t.Fatalf("expected n=2 in request, got %v", got)
+	}
+	if deltas[0] != "Hello" || deltas[1] != "Goodbye" {
+		t.Fatalf("deltas routed to the wrong choice: %q", deltas)
+	}
+	if len(finals) != 2 {
+		t.Fatalf("expected one final message per choice, got %d", len(finals))
+	}
+	for i, want := range []struct {
+		content string
+		reason  schema.FinishReason
+	}{{"Hello", schema.FinishStop}, {"Goodbye", schema.FinishLength}} {
+		f := finals[i]
+		if f.ChoiceIndex != i || f.Content != want.content || f.ResponseMeta.FinishReason != want.reason {
+			t.Fatalf("final %d: got index %d, content %q, finish %q", i, f.ChoiceIndex, f.Content, f.ResponseMeta.FinishReason)
+		}
+	}
+}
+
+func sseBody(parts ...string) string {
+	var b strings.Builder
+	for _, p := range parts {
+		b.WriteString(`data: {"choices":[{"index":0,"delta":{"content":"` + p + `"}}]}` + "\n\n")
+	}
+	b.WriteString("data: [DONE]\n\n")
+	return b.String()
+}
+
+func TestStreamChannelBufferWithSlowConsumer(t *testing.T) {
+	mock := &mockHTTPClient{body: sseBody("a", "b", "c", "d", "e")}
+	c := newTestClient(t, mock, chatmodel.WithStreamChannelBuffer(1))
+
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	if cap(msgs) != 1 {
+		t.Fatalf("expected buffer 1, got %d", cap(msgs))
+	}
+	var content string
+	for m := range msgs {
+		time.Sleep(5 * time.Millisecond)
+		if !m.Final {
+			content += m.Content
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if content != "abcde" {
+		t.Fatalf("slow consumer lost deltas: %q", content)
+	}
+
+	// 消费者停止读取并取消 ctx 后，生产者应退出而不是永久阻塞
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs, errs = c.Stream(ctx, "qwen-test", userHello, nil)
+	<-msgs
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream goroutine blocked after cancellation")
+	}
+
+	if _, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithStreamChannelBuffer(-1)); err == nil {
+		t.Fatal("expected error for negative buffer")
+	}
+}
+
+func TestDecodeErrorShowsBodySnippet(t *testing.T) {
+	page := "<html><body>502 Bad Gateway; upstream Authorization: Bearer sk-abcdef1234567890</body></html>" + strings.Repeat(" ", 400)
+	mock := &mockHTTPClient{body: page}
+	c := newTestClient(t, mock)
+
+	_, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	var decodeErr *chatmodel.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected *DecodeError, got %v", err)
+	}
+	if decodeErr.StatusCode != 200 || !strings.HasPrefix(decodeErr.Snippet, "<html><body>502 Bad Gateway") {
+		t.Fatalf("unexpected decode error %+v", decodeErr)
+	}
+	if !strings.Contains(err.Error(), "502 Bad Gateway") || !strings.Contains(err.Error(), "status 200") {
+		t.Fatalf("error should carry the status and body snippet: %v", err)
+	}
+	if strings.Contains(err.Error(), "sk-abcdef") || !strings.Contains(decodeErr.Snippet, "Bearer [REDACTED]") {
+		t.Fatalf("credentials should be redacted: %q", decodeErr.Snippet)
+	}
+	if len(decodeErr.Snippet) > 300 || !strings.HasSuffix(decodeErr.Snippet, "...") {
+		t.Fatalf("snippet should be truncated, got %d bytes", len(decodeErr.Snippet))
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("decode error should wrap the JSON error: %v", err)
+	}
+}
+
+func TestRateLimitError(t *testing.T) {
+	for name, tc := range map[string]struct {
+		header http.Header
+		body   string
+		want   time.Duration
+	}{
+		"header": {http.Header{"Retry-After": {"7"}}, `{"code":"Throttling.RateQuota"}`, 7 * time.Second},
+		"body":   {nil, `{"code":"Throttling","requests_limit":{"retry_after":4}}`, 4 * time.Second},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tc.header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+			c, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithBaseUrl(srv.URL))
+			if err != nil {
+				t.Fatalf("NewQWenModelClient failed: %v", err)
+			}
+
+			_, err = c.Generate(context.Background(), "qwen-test", userHello, nil)
+			var rateErr *chatmodel.RateLimitError
+			if !errors.As(err, &rateErr) {
+				t.Fatalf("expected RateLimitError, got %v", err)
+			}
+			if rateErr.RetryAfter != tc.want {
+				t.Fatalf("RetryAfter = %s, want %s", rateErr.RetryAfter, tc.want)
+			}
+			var apiErr *chatmodel.APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+				t.Fatalf("RateLimitError should unwrap to APIError: %v", err)
+			}
+		})
+	}
+}
+
+func TestStreamEndsWithFinalMessage(t *testing.T) {
+	mock := &mockHTTPClient{body: `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}` + "\n\n" +
+		`data: {"choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}` + "\n\n" +
+		`data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}` + "\n\n" +
+		"data: [DONE]\n\n"}
+	c := newTestClient(t, mock)
+
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	var all []*schema.Message
+	for m := range msgs {
+		all = append(all, m)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 2 deltas and a final message, got %d", len(all))
+	}
+	for _, m := range all[:2] {
+		if m.Final {
+			t.Fatalf("delta marked final: %+v", m)
+		}
+	}
+	final := all[2]
+	if !final.Final || final.Role != schema.RoleAssistant || final.Content != "Hello" {
+		t.Fatalf("unexpected final message %+v", final)
+	}
+	if final.ResponseMeta == nil || final.ResponseMeta.FinishReason != "stop" ||
+		final.ResponseMeta.Usage == nil || final.ResponseMeta.Usage.TotalTokens != 7 {
+		t.Fatalf("final message misses metadata: %+v", final.ResponseMeta)
+	}
+	if req := mock.lastRequestJSON(t); req["stream_options"] == nil {
+		t.Fatalf("stream request should ask for usage: %v", req)
+	}
+	if got := schema.ConcatMessages(all); got.Content != "Hello" {
+		t.Fatalf("ConcatMessages should ignore the final message, got %q", got.Content)
+	}
+}
+
+func TestStreamNon200IsAPIError(t *testing.T) {
+	mock := &mockHTTPClient{status: 400, body: `{"error":{"code":"InvalidParameter","message":"bad model"}}`}
+	c := newTestClient(t, mock)
+
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	for m := range msgs {
+		t.Fatalf("an error response should produce no messages, got %+v", m)
+	}
+	var apiErr *chatmodel.APIError
+	if err := <-errs; !errors.As(err, &apiErr) || apiErr.StatusCode != 400 || !strings.Contains(apiErr.Body, "bad model") {
+		t.Fatalf("expected an APIError with the response body, got %v", err)
+	}
+}
+
+// statuslessStreamClient streams its body in chunks that carry no status
+// code, as IHTTPClient implementations predating StatusCode on chunks do.
+type statuslessStreamClient struct {
+	mockHTTPClient
+	chunks []string
+}
+
+func (m *statuslessStreamClient) SendStream(ctx context.Context, method httpclient.HTTPMethod, body interface{}) (httpclient.IOReader, httpclient.IOError) {
+	out := make(chan httpclient.HTTPResponse, len(m.chunks))
+	errs := make(chan error, 1)
+	for _, chunk := range m.chunks {
+		out <- httpclient.HTTPResponse{Body: []byte(chunk)}
+	}
+	close(out)
+	close(errs)
+	return out, errs
+}
+
+func TestStreamChunksWithoutStatusAreParsed(t *testing.T) {
+	mock := &statuslessStreamClient{chunks: []string{
+		`data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}]}` + "\n\n",
+		`data: {"choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}` + "\n\n",
+		"data: [DONE]\n\n",
+	}}
+	c, err := chatmodel.NewQWenModelClient("test-key", chatmodel.WithHTTPClient(mock))
+	if err != nil {
+		t.Fatalf("NewQWenModelClient failed: %v", err)
+	}
+
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	var all []*schema.Message
+	for m := range msgs {
+		all = append(all, m)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(all) != 3 || !all[2].Final || all[2].Content != "Hello" {
+		t.Fatalf("expected 2 deltas and a final \"Hello\", got %+v", all)
+	}
+}
+
+func TestStreamWithoutDataHasNoFinalMessage(t *testing.T) {
+	mock := &mockHTTPClient{body: "data: [DONE]\n\n"}
+	c := newTestClient(t, mock, chatmodel.WithAssistantPrefill(true))
+
+	history := append(append([]*schema.Message(nil), userHello...), &schema.Message{Role: schema.RoleAssistant, Content: "Sure"})
+	msgs, errs := c.Stream(context.Background(), "qwen-test", history, nil)
+	for m := range msgs {
+		t.Fatalf("a stream without choices should produce no messages, got %+v", m)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+}
+
+func TestNativeDashScopeFormat(t *testing.T) {
+	mock := &mockHTTPClient{body: `{
+		"request_id": "req-1",
+		"output": {"choices": [{
+			"finish_reason": "tool_calls",
+			"message": {"role": "assistant", "content": "", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "search", "arguments": "{\"q\":\"go\"}"}}
+			]}
+		}]},
+		"usage": {"input_tokens": 12, "output_tokens": 3, "total_tokens": 15}
+	}`}
+	c := newTestClient(t, mock, chatmodel.WithNativeDashScopeFormat(true), chatmodel.WithExtra(map[string]interface{}{"enable_search": true}))
+
+	msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Name != "search" {
+		t.Fatalf("unexpected tool calls %+v", msg.ToolCalls)
+	}
+	meta := msg.ResponseMeta
+	if meta.FinishReason != "tool_calls" || meta.Usage == nil || meta.Usage.PromptTokens != 12 || meta.Usage.TotalTokens != 15 {
+		t.Fatalf("unexpected response meta %+v", meta)
+	}
+
+	req := mock.lastRequestJSON(t)
+	if req["model"] != "qwen-test" || req["messages"] != nil {
+		t.Fatalf("native request should nest messages under input: %v", req)
+	}
+	input, _ := req["input"].(map[string]interface{})
+	if msgs, _ := input["messages"].([]interface{}); len(msgs) != 1 {
+		t.Fatalf("unexpected input %v", req["input"])
+	}
+	params, _ := req["parameters"].(map[string]interface{})
+	if params["result_format"] != "message" || params["enable_search"] != true {
+		t.Fatalf("unexpected parameters %v", req["parameters"])
+	}
+}
+
+func TestNativeDashScopeTextResult(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"output":{"text":"hi","finish_reason":"stop"},"usage":{"input_tokens":1,"output_tokens":1,"total_tokens":2}}`}
+	c := newTestClient(t, mock, chatmodel.WithNativeDashScopeFormat(true))
+
+	msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if msg.Content != "hi" || msg.ResponseMeta.FinishReason != "stop" {
+		t.Fatalf("text output should become a message: %+v", msg)
+	}
+}
+
+func TestNativeDashScopeStream(t *testing.T) {
+	mock := &mockHTTPClient{body: "id:1\nevent:result\n" +
+		`data:{"output":{"choices":[{"message":{"role":"assistant","content":"Hel"},"finish_reason":"null"}]},"usage":{"input_tokens":5,"output_tokens":1,"total_tokens":6}}` + "\n\n" +
+		"id:2\nevent:result\n" +
+		`data:{"output":{"choices":[{"message":{"role":"assistant","content":"lo"},"finish_reason":"stop"}]},"usage":{"input_tokens":5,"output_tokens":2,"total_tokens":7}}` + "\n\n"}
+	c := newTestClient(t, mock, chatmodel.WithNativeDashScopeFormat(true))
+
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	var final *schema.Message
+	var content string
+	for m := range msgs {
+		if m.Final {
+			final = m
+			continue
+		}
+		content += m.Content
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if content != "Hello" || final == nil || final.Content != "Hello" {
+		t.Fatalf("unexpected stream: %q, final %+v", content, final)
+	}
+	if final.ResponseMeta.FinishReason != "stop" || final.ResponseMeta.Usage.TotalTokens != 7 {
+		t.Fatalf("unexpected final meta %+v", final.ResponseMeta)
+	}
+	params, _ := mock.lastRequestJSON(t)["parameters"].(map[string]interface{})
+	if params["incremental_output"] != true {
+		t.Fatalf("stream request should ask for incremental output: %v", params)
+	}
+}
+
+func TestSystemPromptPlacement(t *testing.T) {
+	history := []*schema.Message{
+		{Role: schema.RoleSystem, Content: "Be brief."},
+		{Role: schema.RoleSystem, Content: "Answer in English."},
+		{Role: schema.RoleUser, Content: "hello"},
+	}
+	const reply = `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`
+	const nativeReply = `{"output":{"choices":[{"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}}`
+	messagesOf := func(req map[string]interface{}) []interface{} {
+		if input, ok := req["input"].(map[string]interface{}); ok {
+			req = input
+		}
+		msgs, _ := req["messages"].([]interface{})
+		return msgs
+	}
+	for _, tc := range []struct {
+		name       string
+		body       string
+		opts       []chatmodel.Option
+		wantSystem interface{}
+		wantRoles  []string
+	}{
+		{name: "compatible", body: reply, wantRoles: []string{"system", "system", "user"}},
+		{name: "system field", body: reply, opts: []chatmodel.Option{chatmodel.WithSystemField(true)},
+			wantSystem: "Be brief.\n\nAnswer in English.", wantRoles: []string{"user"}},
+		{name: "native with system field", body: nativeReply, opts: []chatmodel.Option{chatmodel.WithNativeDashScopeFormat(true), chatmodel.WithSystemField(true)},
+			wantRoles: []string{"system", "user"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := &mockHTTPClient{body: tc.body}
+			c := newTestClient(t, mock, tc.opts...)
+			if _, err := c.Generate(context.Background(), "qwen-test", history, nil); err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			req := mock.lastRequestJSON(t)
+			if req["system"] != tc.wantSystem {
+				t.Fatalf("system field = %v, want %v", req["system"], tc.wantSystem)
+			}
+			var roles []string
+			for _, m := range messagesOf(req) {
+				roles = append(roles, m.(map[string]interface{})["role"].(string))
+			}
+			if strings.Join(roles, ",") != strings.Join(tc.wantRoles, ",") {
+				t.Fatalf("roles = %v, want %v", roles, tc.wantRoles)
+			}
+		})
+	}
+}
+
+func TestStrictToolsAreFlagged(t *testing.T) {
+	strict := &tool.ToolInfo{Name: "search", Desc: "search", Strict: true, Parameters: map[string]*tool.ParameterInfo{
+		"q": {Name: "q", Type: tool.String, Desc: "query", Required: true},
+	}}
+	loose := &tool.ToolInfo{Name: "noop", Desc: "noop"}
+	functions := func(req map[string]interface{}) []map[string]interface{} {
+		var out []map[string]interface{}
+		for _, raw := range req["tools"].([]interface{}) {
+			out = append(out, raw.(map[string]interface{})["function"].(map[string]interface{}))
+		}
+		return out
+	}
+
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`}
+	c := newTestClient(t, mock)
+	if _, err := c.Generate(context.Background(), "qwen-test", userHello, []*tool.ToolInfo{strict, loose}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	fns := functions(mock.lastRequestJSON(t))
+	if fns[0]["strict"] != true || fns[1]["strict"] != nil {
+		t.Fatalf("strict flag should only be set on strict tools: %v", fns)
+	}
+	if params := fns[0]["parameters"].(map[string]interface{}); params["type"] != "object" || params["additionalProperties"] != false {
+		t.Fatalf("strict tool should send a strict JSON schema: %v", params)
+	}
+
+	mock.body = sseBody("hi")
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, []*tool.ToolInfo{strict})
+	for range msgs {
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if fns := functions(mock.lastRequestJSON(t)); fns[0]["strict"] != true {
+		t.Fatalf("stream request misses the strict flag: %v", fns)
+	}
+}
+
+func TestUserFieldIsSentWhenSet(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`}
+	c := newTestClient(t, mock)
+	if _, err := c.Generate(context.Background(), "qwen-test", userHello, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if _, ok := mock.lastRequestJSON(t)["user"]; ok {
+		t.Fatal("user should be omitted by default")
+	}
+
+	c = newTestClient(t, mock, chatmodel.WithUser("tenant-hash"))
+	if _, err := c.Generate(context.Background(), "qwen-test", userHello, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if got := mock.lastRequestJSON(t)["user"]; got != "tenant-hash" {
+		t.Fatalf("user = %v, want tenant-hash", got)
+	}
+
+	// 单次调用的用户覆盖客户端配置，流式请求同样携带
+	mock.body = sseBody("hi")
+	msgs, errs := c.Stream(chatmodel.WithRequestUser(context.Background(), "user-42"), "qwen-test", userHello, nil)
+	for range msgs {
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if got := mock.lastRequestJSON(t)["user"]; got != "user-42" {
+		t.Fatalf("stream request user = %v, want user-42", got)
+	}
+}
+
+func TestParallelToolCallsFlag(t *testing.T) {
+	search := &tool.ToolInfo{Name: "search", Desc: "search"}
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`}
+	c := newTestClient(t, mock)
+	if _, err := c.Generate(context.Background(), "qwen-test", userHello, []*tool.ToolInfo{search}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if _, ok := mock.lastRequestJSON(t)["parallel_tool_calls"]; ok {
+		t.Fatal("parallel_tool_calls should be omitted by default")
+	}
+
+	c = newTestClient(t, mock, chatmodel.WithParallelToolCalls(false))
+	if _, err := c.Generate(context.Background(), "qwen-test", userHello, []*tool.ToolInfo{search}); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if v, ok := mock.lastRequestJSON(t)["parallel_tool_calls"]; !ok || v != false {
+		t.Fatalf("parallel_tool_calls = %v, want false", v)
+	}
+
+	mock.body = sseBody("hi")
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, []*tool.ToolInfo{search})
+	for range msgs {
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if v := mock.lastRequestJSON(t)["parallel_tool_calls"]; v != false {
+		t.Fatalf("stream request parallel_tool_calls = %v, want false", v)
+	}
+
+	// 不带工具的请求不发送该参数
+	mock.body = `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`
+	if _, err := c.Generate(context.Background(), "qwen-test", userHello, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if _, ok := mock.lastRequestJSON(t)["parallel_tool_calls"]; ok {
+		t.Fatal("parallel_tool_calls should be omitted without tools")
+	}
+}
+
+func TestCacheHintBecomesCacheControl(t *testing.T) {
+	messages := []*schema.Message{
+		{Role: schema.RoleSystem, Content: "long static prompt", CacheHint: true},
+		{Role: schema.RoleUser, Content: "hello"},
+	}
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}]}`}
+	c := newTestClient(t, mock, chatmodel.WithPromptCaching(true))
+	if _, err := c.Generate(context.Background(), "qwen-test", messages, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	sent := mock.lastRequestJSON(t)["messages"].([]interface{})
+	want := []interface{}{map[string]interface{}{
+		"type": "text", "text": "long static prompt", "cache_control": map[string]interface{}{"type": "ephemeral"},
+	}}
+	if got := sent[0].(map[string]interface{})["content"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("hinted message content = %v, want %v", got, want)
+	}
+	if got := sent[1].(map[string]interface{})["content"]; got != "hello" {
+		t.Fatalf("unhinted message content = %v, want a plain string", got)
+	}
+
+	// 未开启时忽略缓存提示
+	c = newTestClient(t, mock)
+	if _, err := c.Generate(context.Background(), "qwen-test", messages, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	sent = mock.lastRequestJSON(t)["messages"].([]interface{})
+	if got := sent[0].(map[string]interface{})["content"]; got != "long static prompt" {
+		t.Fatalf("hint should be ignored without PromptCaching, got %v", got)
+	}
+}
+
+func TestSystemFingerprintIsSurfaced(t *testing.T) {
+	response := func(fp string) string {
+		return `{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"}}],"system_fingerprint":"` + fp + `"}`
+	}
+	type change struct{ model, previous, current string }
+	var changes []change
+	mock := &mockHTTPClient{body: response("fp_a")}
+	c := newTestClient(t, mock, chatmodel.WithSeed(42, func(model, previous, current string) {
+		changes = append(changes, change{model, previous, current})
+	}))
+
+	msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if msg.ResponseMeta.SystemFingerprint != "fp_a" {
+		t.Fatalf("fingerprint = %q, want fp_a", msg.ResponseMeta.SystemFingerprint)
+	}
+	if seed := mock.lastRequestJSON(t)["seed"]; seed != float64(42) {
+		t.Fatalf("seed = %v, want 42", seed)
+	}
+	if _, err := c.Generate(context.Background(), "qwen-test", userHello, nil); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("unchanged fingerprint reported: %v", changes)
+	}
+
+	mock.body = "data: " + response("fp_b") + "\n\ndata: [DONE]\n\n"
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	var final *schema.Message
+	for m := range msgs {
+		if m.Final {
+			final = m
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if final == nil || final.ResponseMeta.SystemFingerprint != "fp_b" {
+		t.Fatalf("stream final message misses the fingerprint: %+v", final)
+	}
+	if want := []change{{"qwen-test", "fp_a", "fp_b"}}; !reflect.DeepEqual(changes, want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+}
+
+func TestFinishReasonIsNormalized(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"cut"},"finish_reason":"max_tokens"}]}`}
+	c := newTestClient(t, mock)
+	msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if msg.FinishReason() != schema.FinishLength || msg.ResponseMeta.RawFinishReason != "max_tokens" {
+		t.Fatalf("unexpected finish reason %+v", msg.ResponseMeta)
+	}
+
+	mock.body = `data: {"choices":[{"index":0,"delta":{"content":"hi"},"finish_reason":"tool_calls"}]}` + "\n\ndata: [DONE]\n\n"
+	msgs, errs := c.Stream(context.Background(), "qwen-test", userHello, nil)
+	var final *schema.Message
+	for m := range msgs {
+		if m.Final {
+			final = m
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if final == nil || final.ResponseMeta.FinishReason != schema.FinishToolCalls || final.ResponseMeta.RawFinishReason != "tool_calls" {
+		t.Fatalf("unexpected final message %+v", final)
+	}
+}
+
+func TestContentFilterCategories(t *testing.T) {
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":""},"finish_reason":"content_filter",
+		"content_filter_results":{"violence":{"filtered":true,"severity":"high"},"hate":{"filtered":false},"self_harm":{"filtered":true}}}]}`}
+	c := newTestClient(t, mock)
+	msg, err := c.Generate(context.Background(), "qwen-test", userHello, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	meta := msg.ResponseMeta
+	if meta.FinishReason != schema.FinishContentFilter || strings.Join(meta.FilteredCategories, ",") != "self_harm,violence" {
+		t.Fatalf("unexpected moderation metadata %+v", meta)
+	}
+}
+
+func TestAssistantPrefill(t *testing.T) {
+	history := []*schema.Message{
+		{Role: schema.RoleUser, Content: "Return the answer as JSON."},
+		{Role: schema.RoleAssistant, Content: "{"},
+	}
+	lastMessage := func(mock *mockHTTPClient) map[string]interface{} {
+		msgs := mock.lastRequestJSON(t)["messages"].([]interface{})
+		return msgs[len(msgs)-1].(map[string]interface{})
+	}
+
+	mock := &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"\"answer\":4}"},"finish_reason":"stop"}]}`}
+	c := newTestClient(t, mock, chatmodel.WithAssistantPrefill(true))
+	msg, err := c.Generate(context.Background(), "qwen-test", history, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if last := lastMessage(mock); last["role"] != "assistant" || last["content"] != "{" || last["partial"] != true {
+		t.Fatalf("prefill not sent as partial: %v", last)
+	}
+	if msg.Content != `{"answer":4}` {
+		t.Fatalf("prefill and completion not joined: %q", msg.Content)
+	}
+
+	mock.body = sseBody(`\"answer\"`, `:4}`)
+	msgs, errs := c.Stream(context.Background(), "qwen-test", history, nil)
+	var streamed string
+	var final *schema.Message
+	for m := range msgs {
+		if m.Final {
+			final = m
+			continue
+		}
+		streamed += m.Content
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if streamed != `{"answer":4}` || final == nil || final.Content != streamed {
+		t.Fatalf("streamed prefill not joined: deltas %q, final %+v", streamed, final)
+	}
+
+	// 未开启时以普通 assistant 消息发送
+	mock = &mockHTTPClient{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"}}]}`}
+	msg, err = newTestClient(t, mock).Generate(context.Background(), "qwen-test", history, nil)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if _, ok := lastMessage(mock)["partial"]; ok || msg.Content != "ok" {
+		t.Fatalf("prefill should be opt-in: %v, %q", lastMessage(mock), msg.Content)
+	}
+}
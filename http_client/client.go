@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"reAct-agent/logging"
+	"strings"
 	"time"
 )
 
@@ -21,11 +24,23 @@ type HTTPHeader map[string]string
 type HTTPResponse struct {
 	Body       []byte
 	StatusCode int
+	// Header holds the response headers. It is nil on stream chunks.
+	Header http.Header
+	// Truncated reports that Body was cut to the client's
+	// WithMaxResponseBytes limit.
+	Truncated bool
 }
 
 type IOReader <-chan HTTPResponse
 type IOError <-chan error
 
+// SendFunc matches the signature of Send.
+type SendFunc func(ctx context.Context, method HTTPMethod, body interface{}) (*HTTPResponse, error)
+
+// Middleware wraps a SendFunc to add behavior such as auth, logging, retry or
+// metrics around every Send.
+type Middleware func(next SendFunc) SendFunc
+
 type IHTTPClient interface {
 	Send(ctx context.Context, method HTTPMethod, body interface{}) (*HTTPResponse, error)
 	SendStream(ctx context.Context, method HTTPMethod, body interface{}) (IOReader, IOError)
@@ -36,6 +51,28 @@ type HTTPClient struct {
 	path    string
 	header  *HTTPHeader
 	timeout time.Duration
+
+	dynamicHeader func(ctx context.Context) HTTPHeader
+	middlewares   []Middleware
+	beforeRequest []BeforeRequestHook
+	afterResponse []AfterResponseHook
+	send          SendFunc
+
+	maxRetries     int
+	retryBackoff   time.Duration
+	maxRetryAfter  time.Duration
+	retryPredicate RetryPredicate
+
+	compress          bool
+	compressThreshold int
+
+	maxResponseBytes int64
+
+	logger logging.Logger
+
+	transport       *http.Transport
+	transportTuning []func(*http.Transport)
+	client          *http.Client
 }
 
 // Option defines a functional option to configure HTTPClient.
@@ -54,6 +91,123 @@ func WithHeader(h HTTPHeader) Option {
 	}
 }
 
+// WithDynamicHeaders registers a function evaluated on every Send/SendStream
+// whose headers are merged over the static ones, winning on conflict. It
+// enables per-request values such as tenant IDs derived from ctx.
+func WithDynamicHeaders(fn func(ctx context.Context) HTTPHeader) Option {
+	return func(c *HTTPClient) {
+		if c == nil {
+			return
+		}
+		c.dynamicHeader = fn
+	}
+}
+
+// BeforeRequestHook observes a request about to be sent. body is a copy of
+// the encoded request body, nil when there is none.
+type BeforeRequestHook func(ctx context.Context, method HTTPMethod, url string, body []byte)
+
+// AfterResponseHook observes the outcome of a request: resp is nil when err
+// is set. The hook must not modify resp.
+type AfterResponseHook func(ctx context.Context, resp *HTTPResponse, err error, elapsed time.Duration)
+
+// WithBeforeRequest registers a hook fired before every Send round trip,
+// e.g. for logging. Hooks run in registration order; with retries they fire
+// once per attempt. SendStream does not fire them.
+func WithBeforeRequest(fn BeforeRequestHook) Option {
+	return func(c *HTTPClient) {
+		if c == nil || fn == nil {
+			return
+		}
+		c.beforeRequest = append(c.beforeRequest, fn)
+	}
+}
+
+// WithAfterResponse registers a hook fired after every Send round trip with
+// its duration, e.g. for timing. It pairs with WithBeforeRequest.
+func WithAfterResponse(fn AfterResponseHook) Option {
+	return func(c *HTTPClient) {
+		if c == nil || fn == nil {
+			return
+		}
+		c.afterResponse = append(c.afterResponse, fn)
+	}
+}
+
+type requestHeadersKey struct{}
+
+// WithRequestHeaders returns a context whose Send/SendStream calls carry h,
+// merged over the client's static and dynamic headers for those requests
+// only. It suits request-scoped values such as trace IDs or A/B flags.
+// Headers added by an outer call are kept unless h overrides them.
+func WithRequestHeaders(ctx context.Context, h HTTPHeader) context.Context {
+	merged := make(HTTPHeader, len(h))
+	for k, v := range RequestHeadersFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range h {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, requestHeadersKey{}, merged)
+}
+
+// RequestHeadersFromContext returns the headers added by WithRequestHeaders.
+func RequestHeadersFromContext(ctx context.Context) HTTPHeader {
+	h, _ := ctx.Value(requestHeadersKey{}).(HTTPHeader)
+	return h
+}
+
+type requestURLKey struct{}
+
+// WithRequestURL returns a context whose Send/SendStream calls go to url
+// instead of the client's baseUrl and path, e.g. to fetch arbitrary pages
+// with a client from NewDefaultHTTPClient.
+func WithRequestURL(ctx context.Context, url string) context.Context {
+	return context.WithValue(ctx, requestURLKey{}, url)
+}
+
+type requestQueryKey struct{}
+
+// WithRequestQuery returns a context whose Send/SendStream calls append q to
+// the request URL, e.g. a pagination cursor.
+func WithRequestQuery(ctx context.Context, q neturl.Values) context.Context {
+	return context.WithValue(ctx, requestQueryKey{}, q)
+}
+
+// WithLogger logs retries to l. Nil logs nothing.
+func WithLogger(l logging.Logger) Option {
+	return func(c *HTTPClient) {
+		c.logger = l
+	}
+}
+
+// WithMiddleware appends middlewares to the Send chain. They apply in order:
+// the first one registered is the outermost and sees the call first.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(c *HTTPClient) {
+		if c == nil {
+			return
+		}
+		for _, mw := range mws {
+			if mw != nil {
+				c.middlewares = append(c.middlewares, mw)
+			}
+		}
+	}
+}
+
+// WithTransport makes the client use t instead of a private one from
+// NewTransport, so several clients can share one connection pool.
+// Close on any of them closes the idle connections of t.
+func WithTransport(t *http.Transport) Option {
+	return func(c *HTTPClient) {
+		if c == nil {
+			return
+		}
+		c.transport = t
+	}
+}
+
 // WithTimeout sets a custom timeout.
 func WithTimeout(d time.Duration) Option {
 	return func(c *HTTPClient) {
@@ -67,6 +221,18 @@ func WithTimeout(d time.Duration) Option {
 	}
 }
 
+// WithMaxResponseBytes caps the bytes of a response body read by Send. The
+// rest is discarded and the response is marked Truncated. Zero or less reads
+// the whole body.
+func WithMaxResponseBytes(n int64) Option {
+	return func(c *HTTPClient) {
+		if c == nil {
+			return
+		}
+		c.maxResponseBytes = n
+	}
+}
+
 // NewHTTPClient creates a new HTTPClient with provided values.
 // If header is nil, a default JSON header is used. If timeout is 0, it defaults to 30s.
 func NewHTTPClient(baseUrl, path string, opts ...Option) *HTTPClient {
@@ -80,12 +246,30 @@ func NewHTTPClient(baseUrl, path string, opts ...Option) *HTTPClient {
 		path:    path,
 		header:  &defaultHeader,
 		timeout: 30 * time.Second,
+
+		compressThreshold: DefaultCompressionThreshold,
 	}
 	for _, opt := range opts {
 		if opt != nil {
 			opt(c)
 		}
 	}
+	// 默认每个客户端持有独立的 transport，便于 Close 时释放空闲连接
+	if c.transport == nil {
+		c.transport = NewTransport()
+	}
+	for _, tune := range c.transportTuning {
+		tune(c.transport)
+	}
+	c.client = &http.Client{Timeout: c.timeout, Transport: c.transport}
+	// 由内向外包装中间件，使第一个注册的位于最外层
+	c.send = c.doSend
+	if c.maxRetries > 0 {
+		c.send = c.retry(c.send)
+	}
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		c.send = c.middlewares[i](c.send)
+	}
 	return c
 }
 
@@ -120,30 +304,81 @@ func (c *HTTPClient) buildURL() string {
 // Ensure HTTPClient implements IHTTPClient
 var _ IHTTPClient = (*HTTPClient)(nil)
 
-// Send performs a simple HTTP request and returns the whole response body.
-func (c *HTTPClient) Send(ctx context.Context, method HTTPMethod, body interface{}) (*HTTPResponse, error) {
-	url := c.buildURL()
-	// prepare body reader
-	var reader io.Reader
+// Close releases the idle keep-alive connections held by the client's
+// transport. Requests still in flight are not interrupted, and the client
+// remains usable afterwards; it simply has to dial new connections.
+func (c *HTTPClient) Close() error {
+	if c == nil || c.transport == nil {
+		return nil
+	}
+	c.transport.CloseIdleConnections()
+	return nil
+}
+
+// resolveURL applies the URL and query carried by ctx to the client's URL.
+func resolveURL(ctx context.Context, url string) string {
+	if u, ok := ctx.Value(requestURLKey{}).(string); ok {
+		url = u
+	}
+	if q, ok := ctx.Value(requestQueryKey{}).(neturl.Values); ok && len(q) > 0 {
+		sep := "?"
+		if strings.Contains(url, "?") {
+			sep = "&"
+		}
+		url += sep + q.Encode()
+	}
+	return url
+}
+
+// encodeBody returns the bytes sent for body: []byte and string are sent as
+// they are, other values are marshaled to JSON. It is nil when body is nil.
+func encodeBody(body interface{}) ([]byte, error) {
 	switch v := body.(type) {
 	case nil:
-		reader = nil
+		return nil, nil
 	case []byte:
-		reader = bytes.NewReader(v)
+		return v, nil
 	case string:
-		reader = bytes.NewBufferString(v)
+		return []byte(v), nil
 	default:
-		// marshal to JSON by default
-		b, err := json.Marshal(v)
-		if err != nil {
-			return nil, err
+		return json.Marshal(v)
+	}
+}
+
+// URL returns the request URL built from baseUrl and path.
+func (c *HTTPClient) URL() string {
+	return c.buildURL()
+}
+
+// newRequest encodes body and builds the request with static headers, then
+// dynamic ones, then the ones carried by ctx.
+func (c *HTTPClient) newRequest(ctx context.Context, method HTTPMethod, body interface{}) (*http.Request, error) {
+	req, _, err := c.newRequestBody(ctx, method, body)
+	return req, err
+}
+
+// newRequestBody is newRequest that also returns the encoded body.
+func (c *HTTPClient) newRequestBody(ctx context.Context, method HTTPMethod, body interface{}) (*http.Request, []byte, error) {
+	url := resolveURL(ctx, c.buildURL())
+	data, err := encodeBody(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	sent := data
+	compressed := c.compress && len(data) > c.compressThreshold
+	if compressed {
+		if sent, err = gzipBody(data); err != nil {
+			return nil, nil, err
 		}
-		reader = bytes.NewReader(b)
+	}
+	var reader io.Reader
+	if sent != nil {
+		reader = bytes.NewReader(sent)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, string(method), url, reader)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// apply headers
 	if c.header != nil {
@@ -151,21 +386,70 @@ func (c *HTTPClient) Send(ctx context.Context, method HTTPMethod, body interface
 			req.Header.Set(k, v)
 		}
 	}
+	if c.dynamicHeader != nil {
+		for k, v := range c.dynamicHeader(ctx) {
+			req.Header.Set(k, v)
+		}
+	}
+	for k, v := range RequestHeadersFromContext(ctx) {
+		req.Header.Set(k, v)
+	}
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return req, data, nil
+}
+
+// Send performs a simple HTTP request through the middleware chain and returns
+// the whole response body.
+func (c *HTTPClient) Send(ctx context.Context, method HTTPMethod, body interface{}) (*HTTPResponse, error) {
+	return c.send(ctx, method, body)
+}
 
-	client := &http.Client{Timeout: c.timeout}
-	resp, err := client.Do(req)
+// doSend performs the actual HTTP round trip at the end of the chain.
+func (c *HTTPClient) doSend(ctx context.Context, method HTTPMethod, body interface{}) (*HTTPResponse, error) {
+	req, data, err := c.newRequestBody(ctx, method, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, hook := range c.beforeRequest {
+		// 传入副本，钩子无法修改实际发送的请求体
+		hook(ctx, method, req.URL.String(), bytes.Clone(data))
+	}
+	start := time.Now()
+	resp, err := c.roundTrip(req)
+	for _, hook := range c.afterResponse {
+		hook(ctx, resp, err, time.Since(start))
+	}
+	return resp, err
+}
+
+// roundTrip sends req and reads the whole response.
+func (c *HTTPClient) roundTrip(req *http.Request) (*HTTPResponse, error) {
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	b, err := io.ReadAll(resp.Body)
+	var body io.Reader = resp.Body
+	if c.maxResponseBytes > 0 {
+		// 多读一个字节用于判断是否超出上限
+		body = io.LimitReader(resp.Body, c.maxResponseBytes+1)
+	}
+	b, err := io.ReadAll(body)
 	if err != nil {
 		return nil, err
 	}
-	return &HTTPResponse{Body: b, StatusCode: resp.StatusCode}, nil
+	truncated := c.maxResponseBytes > 0 && int64(len(b)) > c.maxResponseBytes
+	if truncated {
+		b = b[:c.maxResponseBytes]
+	}
+	return &HTTPResponse{Body: b, StatusCode: resp.StatusCode, Header: resp.Header, Truncated: truncated}, nil
 }
 
 // SendStream performs the request and streams the response body in chunks.
+// The request is bound to ctx: cancelling it aborts the connection to the
+// server, before or during the body, and ends the stream with ctx.Err().
 func (c *HTTPClient) SendStream(ctx context.Context, method HTTPMethod, body interface{}) (IOReader, IOError) {
 	out := make(chan HTTPResponse)
 	errs := make(chan error, 1)
@@ -174,38 +458,13 @@ func (c *HTTPClient) SendStream(ctx context.Context, method HTTPMethod, body int
 		defer close(out)
 		defer close(errs)
 
-		url := c.buildURL()
-		// prepare body reader
-		var reader io.Reader
-		switch v := body.(type) {
-		case nil:
-			reader = nil
-		case []byte:
-			reader = bytes.NewReader(v)
-		case string:
-			reader = bytes.NewBufferString(v)
-		default:
-			b, err := json.Marshal(v)
-			if err != nil {
-				errs <- err
-				return
-			}
-			reader = bytes.NewReader(b)
-		}
-
-		req, err := http.NewRequestWithContext(ctx, string(method), url, reader)
+		req, err := c.newRequest(ctx, method, body)
 		if err != nil {
 			errs <- err
 			return
 		}
-		if c.header != nil {
-			for k, v := range *c.header {
-				req.Header.Set(k, v)
-			}
-		}
 
-		client := &http.Client{Timeout: c.timeout}
-		resp, err := client.Do(req)
+		resp, err := c.client.Do(req)
 		if err != nil {
 			errs <- err
 			return
@@ -219,7 +478,13 @@ func (c *HTTPClient) SendStream(ctx context.Context, method HTTPMethod, body int
 				// copy the buffer chunk to avoid data race
 				chunk := make([]byte, n)
 				copy(chunk, buf[:n])
-				out <- HTTPResponse{Body: chunk}
+				// 消费者停止读取时随 ctx 退出，避免 goroutine 泄漏
+				select {
+				case out <- HTTPResponse{Body: chunk, StatusCode: resp.StatusCode}:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
 			}
 			if err != nil {
 				if err == io.EOF {
@@ -0,0 +1,420 @@
+package httpclient_test
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	httpclient "reAct-agent/http_client"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCloseReleasesIdleConnections(t *testing.T) {
+	var mu sync.Mutex
+	states := make(map[net.Conn]http.ConnState)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		mu.Lock()
+		states[conn] = state
+		mu.Unlock()
+	}
+	srv.Start()
+	defer srv.Close()
+
+	countIn := func(want http.ConnState) int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, s := range states {
+			if s == want {
+				n++
+			}
+		}
+		return n
+	}
+	waitFor := func(want http.ConnState) {
+		deadline := time.Now().Add(2 * time.Second)
+		for countIn(want) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for connection state %v", want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	c := httpclient.NewHTTPClient(srv.URL, "chat")
+	resp, err := c.Send(context.Background(), httpclient.HTTPMethodPOST, map[string]string{"q": "ping"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	// 请求完成后连接保持空闲，Close 应将其关闭
+	waitFor(http.StateIdle)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	waitFor(http.StateClosed)
+	if n := countIn(http.StateIdle); n != 0 {
+		t.Fatalf("expected no idle connections after Close, got %d", n)
+	}
+}
+
+type tenantKey struct{}
+
+func TestDynamicHeadersAreEvaluatedPerCall(t *testing.T) {
+	var mu sync.Mutex
+	var tenants, auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tenants = append(tenants, r.Header.Get("X-Tenant"))
+		auths = append(auths, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Write([]byte("data: ok\n\n"))
+	}))
+	defer srv.Close()
+
+	c := httpclient.NewHTTPClient(srv.URL, "",
+		httpclient.WithHeader(httpclient.HTTPHeader{"Authorization": "Bearer static", "X-Static": "1"}),
+		httpclient.WithDynamicHeaders(func(ctx context.Context) httpclient.HTTPHeader {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			return httpclient.HTTPHeader{"X-Tenant": tenant, "Authorization": "Bearer " + tenant}
+		}),
+	)
+	defer c.Close()
+
+	for _, tenant := range []string{"alpha", "beta"} {
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		if _, err := c.Send(ctx, httpclient.HTTPMethodGET, nil); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	ctx := context.WithValue(context.Background(), tenantKey{}, "gamma")
+	chunks, errs := c.SendStream(ctx, httpclient.HTTPMethodGET, nil)
+	for range chunks {
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+
+	want := []string{"alpha", "beta", "gamma"}
+	for i, tenant := range want {
+		if tenants[i] != tenant {
+			t.Fatalf("request %d: X-Tenant = %q, want %q", i, tenants[i], tenant)
+		}
+		// 动态头覆盖同名的静态头
+		if auths[i] != "Bearer "+tenant {
+			t.Fatalf("request %d: Authorization = %q, dynamic header should win", i, auths[i])
+		}
+	}
+}
+
+func TestRequestHeadersApplyToOneCall(t *testing.T) {
+	var mu sync.Mutex
+	var traces, auths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traces = append(traces, r.Header.Get("X-Trace-Id"))
+		auths = append(auths, r.Header.Get("Authorization"))
+		mu.Unlock()
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	c := httpclient.NewHTTPClient(srv.URL, "",
+		httpclient.WithHeader(httpclient.HTTPHeader{"Authorization": "Bearer static"}))
+	defer c.Close()
+
+	ctx := httpclient.WithRequestHeaders(context.Background(), httpclient.HTTPHeader{"X-Trace-Id": "t-1"})
+	ctx = httpclient.WithRequestHeaders(ctx, httpclient.HTTPHeader{"Authorization": "Bearer per-call"})
+	if _, err := c.Send(ctx, httpclient.HTTPMethodPOST, nil); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if _, err := c.Send(context.Background(), httpclient.HTTPMethodPOST, nil); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	// 单次请求头覆盖客户端头，且不影响后续请求
+	if traces[0] != "t-1" || auths[0] != "Bearer per-call" {
+		t.Fatalf("first request: X-Trace-Id = %q, Authorization = %q", traces[0], auths[0])
+	}
+	if traces[1] != "" || auths[1] != "Bearer static" {
+		t.Fatalf("second request: X-Trace-Id = %q, Authorization = %q", traces[1], auths[1])
+	}
+}
+
+func TestRequestURLOverridesTarget(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	defer srv.Close()
+
+	c := httpclient.NewDefaultHTTPClient()
+	defer c.Close()
+	ctx := httpclient.WithRequestURL(context.Background(), srv.URL+"/page")
+	if _, err := c.Send(ctx, httpclient.HTTPMethodGET, nil); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if path != "/page" {
+		t.Fatalf("request sent to %q, want /page", path)
+	}
+}
+
+func TestMaxResponseBytesTruncatesBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	c := httpclient.NewHTTPClient(srv.URL, "", httpclient.WithMaxResponseBytes(10))
+	defer c.Close()
+	resp, err := c.Send(context.Background(), httpclient.HTTPMethodGET, nil)
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if len(resp.Body) != 10 || !resp.Truncated {
+		t.Fatalf("expected 10 bytes marked truncated, got %d bytes, truncated=%v", len(resp.Body), resp.Truncated)
+	}
+
+	c = httpclient.NewHTTPClient(srv.URL, "", httpclient.WithMaxResponseBytes(100))
+	defer c.Close()
+	if resp, err = c.Send(context.Background(), httpclient.HTTPMethodGET, nil); err != nil || len(resp.Body) != 100 || resp.Truncated {
+		t.Fatalf("a body at the limit should be read whole, got err=%v truncated=%v", err, resp.Truncated)
+	}
+}
+
+func TestRequestCompressionAboveThreshold(t *testing.T) {
+	type received struct {
+		encoding string
+		body     string
+	}
+	var got []received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("body is not gzip: %v", err)
+				return
+			}
+			body = zr
+		}
+		b, _ := io.ReadAll(body)
+		got = append(got, received{r.Header.Get("Content-Encoding"), string(b)})
+	}))
+	defer srv.Close()
+
+	c := httpclient.NewHTTPClient(srv.URL, "",
+		httpclient.WithRequestCompression(true),
+		httpclient.WithCompressionThreshold(64))
+	defer c.Close()
+	large := strings.Repeat("x", 100)
+	for _, body := range []string{"small", large} {
+		if _, err := c.Send(context.Background(), httpclient.HTTPMethodPOST, body); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d requests, want 2", len(got))
+	}
+	if got[0].encoding != "" || got[0].body != "small" {
+		t.Fatalf("small body sent as %+v, want it uncompressed", got[0])
+	}
+	if got[1].encoding != "gzip" || got[1].body != large {
+		t.Fatalf("large body sent with encoding %q, want gzip of the body", got[1].encoding)
+	}
+}
+
+func TestSendStreamCancelAbortsServerRequest(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// firstChunk 为 false 时服务端在写响应头之前阻塞
+		firstChunk bool
+	}{
+		{name: "while streaming", firstChunk: true},
+		{name: "before headers"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			started := make(chan struct{})
+			aborted := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.firstChunk {
+					w.Write([]byte("data: first\n\n"))
+					w.(http.Flusher).Flush()
+				}
+				close(started)
+				select {
+				case <-r.Context().Done():
+					close(aborted)
+				case <-time.After(10 * time.Second):
+				}
+			}))
+			defer srv.Close()
+
+			c := httpclient.NewHTTPClient(srv.URL, "")
+			defer c.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			chunks, errs := c.SendStream(ctx, httpclient.HTTPMethodPOST, nil)
+			if tc.firstChunk {
+				if chunk := <-chunks; !strings.Contains(string(chunk.Body), "first") {
+					t.Fatalf("unexpected first chunk %q", chunk.Body)
+				}
+			}
+			<-started
+			cancel()
+
+			select {
+			case <-aborted:
+			case <-time.After(time.Second):
+				t.Fatal("server-side request was not cancelled")
+			}
+			for range chunks {
+			}
+			if err := <-errs; !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRequestHooksFireAroundSend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	var (
+		events  []string
+		gotURL  string
+		gotBody []byte
+		gotResp *httpclient.HTTPResponse
+		elapsed time.Duration
+	)
+	c := httpclient.NewHTTPClient(srv.URL, "chat",
+		httpclient.WithBeforeRequest(func(ctx context.Context, method httpclient.HTTPMethod, url string, body []byte) {
+			events = append(events, "before "+string(method))
+			gotURL, gotBody = url, body
+			// 修改副本不影响实际请求
+			for i := range body {
+				body[i] = 'x'
+			}
+		}),
+		httpclient.WithBeforeRequest(nil),
+		httpclient.WithAfterResponse(func(ctx context.Context, resp *httpclient.HTTPResponse, err error, d time.Duration) {
+			events = append(events, "after")
+			gotResp, elapsed = resp, d
+		}),
+	)
+	defer c.Close()
+
+	resp, err := c.Send(context.Background(), httpclient.HTTPMethodPOST, map[string]string{"q": "hi"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if strings.Join(events, ",") != "before POST,after" {
+		t.Fatalf("unexpected hook order %v", events)
+	}
+	if gotURL != srv.URL+"/chat" || !strings.HasPrefix(string(gotBody), "xxx") {
+		t.Fatalf("unexpected before-hook args: url %q, body %q", gotURL, gotBody)
+	}
+	if string(resp.Body) != `{"q":"hi"}` {
+		t.Fatalf("hooks must not alter the request, server got %q", resp.Body)
+	}
+	if gotResp != resp || gotResp.StatusCode != http.StatusAccepted || elapsed <= 0 {
+		t.Fatalf("unexpected after-hook args: %+v, %s", gotResp, elapsed)
+	}
+
+	// 传输错误时 resp 为 nil
+	var hookErr error
+	failing := httpclient.NewHTTPClient("http://127.0.0.1:1", "",
+		httpclient.WithAfterResponse(func(ctx context.Context, resp *httpclient.HTTPResponse, err error, d time.Duration) {
+			if resp != nil {
+				t.Errorf("resp should be nil on error, got %+v", resp)
+			}
+			hookErr = err
+		}))
+	if _, err := failing.Send(context.Background(), httpclient.HTTPMethodGET, nil); err == nil || hookErr != err {
+		t.Fatalf("after hook should get the Send error, got %v and %v", hookErr, err)
+	}
+}
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	var gotHeader string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get("Content-Type")
+		w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	var order []string
+	trace := func(name string) httpclient.Middleware {
+		return func(next httpclient.SendFunc) httpclient.SendFunc {
+			return func(ctx context.Context, method httpclient.HTTPMethod, body interface{}) (*httpclient.HTTPResponse, error) {
+				order = append(order, name+":before")
+				resp, err := next(ctx, method, body)
+				order = append(order, name+":after")
+				return resp, err
+			}
+		}
+	}
+	// 第二个中间件改写请求体，验证其位于内层
+	rewrite := func(next httpclient.SendFunc) httpclient.SendFunc {
+		return func(ctx context.Context, method httpclient.HTTPMethod, body interface{}) (*httpclient.HTTPResponse, error) {
+			order = append(order, "rewrite")
+			resp, err := next(ctx, method, `{"rewritten":true}`)
+			if resp != nil {
+				resp.Body = append([]byte("wrapped:"), resp.Body...)
+			}
+			return resp, err
+		}
+	}
+
+	c := httpclient.NewHTTPClient(srv.URL, "", httpclient.WithMiddleware(trace("outer"), rewrite))
+	defer c.Close()
+	resp, err := c.Send(context.Background(), httpclient.HTTPMethodPOST, map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if got := strings.Join(order, ","); got != "outer:before,rewrite,outer:after" {
+		t.Fatalf("unexpected middleware order %s", got)
+	}
+	if string(resp.Body) != "wrapped:body" {
+		t.Fatalf("middleware response rewrite lost: %q", resp.Body)
+	}
+	if gotHeader != "application/json" {
+		t.Fatalf("default headers lost: %q", gotHeader)
+	}
+}
+
+func TestTransportTuningIsApplied(t *testing.T) {
+	transport := httpclient.NewTransport()
+	if transport.MaxIdleConns != httpclient.DefaultMaxIdleConns ||
+		transport.MaxIdleConnsPerHost != httpclient.DefaultMaxIdleConnsPerHost ||
+		transport.IdleConnTimeout != httpclient.DefaultIdleConnTimeout {
+		t.Fatalf("unexpected defaults: %d, %d, %s", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+
+	httpclient.NewHTTPClient("http://example.invalid", "",
+		httpclient.WithTransport(transport),
+		httpclient.WithMaxIdleConns(200),
+		httpclient.WithMaxIdleConnsPerHost(50),
+		httpclient.WithIdleConnTimeout(30*time.Second),
+	)
+	if transport.MaxIdleConns != 200 || transport.MaxIdleConnsPerHost != 50 || transport.IdleConnTimeout != 30*time.Second {
+		t.Fatalf("tuning not applied: %d, %d, %s", transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout)
+	}
+}
@@ -0,0 +1,48 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+)
+
+// DefaultCompressionThreshold is the body size above which
+// WithRequestCompression gzips a request.
+const DefaultCompressionThreshold = 8 << 10
+
+// WithRequestCompression gzips request bodies larger than the compression
+// threshold and sets Content-Encoding: gzip, saving upload bandwidth on long
+// histories and tool schemas. Enable it only for servers that accept
+// compressed requests. Hooks still see the uncompressed body.
+func WithRequestCompression(enabled bool) Option {
+	return func(c *HTTPClient) {
+		if c == nil {
+			return
+		}
+		c.compress = enabled
+	}
+}
+
+// WithCompressionThreshold sets the body size in bytes above which
+// WithRequestCompression applies. Non-positive values keep
+// DefaultCompressionThreshold.
+func WithCompressionThreshold(n int) Option {
+	return func(c *HTTPClient) {
+		if c == nil || n <= 0 {
+			return
+		}
+		c.compressThreshold = n
+	}
+}
+
+// gzipBody compresses data for a request body.
+func gzipBody(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,375 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RecordMode selects whether a RecordingHTTPClient talks to the network.
+type RecordMode int
+
+const (
+	// ReplayMode serves responses from the cassette and never calls the
+	// wrapped client.
+	ReplayMode RecordMode = iota
+	// RecordingMode sends requests through the wrapped client and writes
+	// every request/response pair to the cassette.
+	RecordingMode
+)
+
+// ErrNoRecording is returned in ReplayMode for a request the cassette has no
+// (unused) response for.
+var ErrNoRecording = errors.New("no recorded response")
+
+// Interaction is one recorded request/response pair. Requests are matched by
+// Method, the path and query of URL, and Request compared as normalized
+// JSON, so the host, key order and whitespace do not matter; BodySHA256 is
+// only compared for interactions without Request. Request headers are never
+// recorded, so API keys stay out of the cassette.
+type Interaction struct {
+	Method     HTTPMethod `json:"method"`
+	URL        string     `json:"url"`
+	BodySHA256 string     `json:"body_sha256"`
+	Request    string     `json:"request,omitempty"`
+
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	// Chunks holds the body of a SendStream response as it was received.
+	Chunks []string `json:"chunks,omitempty"`
+}
+
+// cassette is the file layout written by a RecordingHTTPClient.
+type cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// RecordingHTTPClient wraps an IHTTPClient for VCR-style tests: in
+// RecordingMode it records every exchange to a JSON cassette file, in
+// ReplayMode it answers from that file without network access. Identical
+// requests are answered in the order they were recorded.
+//
+// The URL of a request is the one carried by ctx (see WithRequestURL), or
+// the wrapped client's URL when it has a URL method like *HTTPClient. In
+// ReplayMode the wrapped client is never called but still provides the URL,
+// so build it as for recording.
+type RecordingHTTPClient struct {
+	inner   IHTTPClient
+	path    string
+	mode    RecordMode
+	ignored [][]string
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+var _ IHTTPClient = (*RecordingHTTPClient)(nil)
+
+// RecordingOption configures a RecordingHTTPClient.
+type RecordingOption func(*RecordingHTTPClient)
+
+// WithIgnoredFields leaves JSON request fields out of replay matching, each
+// given as a dotted path from the top-level object such as "tools" or
+// "stream_options.include_usage", e.g. to keep a cassette valid when tool
+// descriptions change.
+func WithIgnoredFields(paths ...string) RecordingOption {
+	return func(c *RecordingHTTPClient) {
+		for _, p := range paths {
+			c.ignored = append(c.ignored, strings.Split(p, "."))
+		}
+	}
+}
+
+// NewRecordingHTTPClient wraps inner with the cassette at path. ReplayMode
+// loads the cassette, which must exist; RecordingMode starts a new one,
+// replacing any previous file once the first exchange is recorded.
+func NewRecordingHTTPClient(inner IHTTPClient, path string, mode RecordMode, opts ...RecordingOption) (*RecordingHTTPClient, error) {
+	c := &RecordingHTTPClient{inner: inner, path: path, mode: mode}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+	if mode == ReplayMode {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette: %w", err)
+		}
+		var cs cassette
+		if err := json.Unmarshal(data, &cs); err != nil {
+			return nil, fmt.Errorf("failed to decode cassette %s: %w", path, err)
+		}
+		c.interactions = cs.Interactions
+		c.used = make([]bool, len(cs.Interactions))
+	} else if inner == nil {
+		return nil, errors.New("recording requires a client")
+	}
+	return c, nil
+}
+
+// Interactions returns the exchanges loaded or recorded so far.
+func (c *RecordingHTTPClient) Interactions() []*Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Interaction(nil), c.interactions...)
+}
+
+// URL returns the wrapped client's URL, or "" when it has no URL method.
+func (c *RecordingHTTPClient) URL() string {
+	if u, ok := c.inner.(interface{ URL() string }); ok {
+		return u.URL()
+	}
+	return ""
+}
+
+func (c *RecordingHTTPClient) Send(ctx context.Context, method HTTPMethod, body interface{}) (*HTTPResponse, error) {
+	in, err := c.request(ctx, method, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.mode == ReplayMode {
+		rec, err := c.replay(in)
+		if err != nil {
+			return nil, err
+		}
+		return &HTTPResponse{Body: []byte(rec.Body), StatusCode: rec.StatusCode, Header: rec.Header}, nil
+	}
+
+	resp, err := c.inner.Send(ctx, method, body)
+	if err != nil {
+		return nil, err
+	}
+	in.StatusCode, in.Header, in.Body = resp.StatusCode, resp.Header, string(resp.Body)
+	if err := c.record(in); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *RecordingHTTPClient) SendStream(ctx context.Context, method HTTPMethod, body interface{}) (IOReader, IOError) {
+	out := make(chan HTTPResponse)
+	errs := make(chan error, 1)
+	in, err := c.request(ctx, method, body)
+	if err != nil {
+		errs <- err
+		close(out)
+		close(errs)
+		return out, errs
+	}
+
+	if c.mode == ReplayMode {
+		go func() {
+			defer close(out)
+			defer close(errs)
+			rec, err := c.replay(in)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for _, chunk := range rec.Chunks {
+				select {
+				case out <- HTTPResponse{Body: []byte(chunk), StatusCode: rec.StatusCode}:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+		}()
+		return out, errs
+	}
+
+	// 转发数据块的同时记录，流正常结束后写入 cassette
+	chunks, innerErrs := c.inner.SendStream(ctx, method, body)
+	go func() {
+		defer close(out)
+		defer close(errs)
+		for chunk := range chunks {
+			if in.StatusCode == 0 {
+				in.StatusCode = chunk.StatusCode
+			}
+			in.Chunks = append(in.Chunks, string(chunk.Body))
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+		if err := <-innerErrs; err != nil {
+			errs <- err
+			return
+		}
+		if err := c.record(in); err != nil {
+			errs <- err
+		}
+	}()
+	return out, errs
+}
+
+// request describes a request as it is matched against the cassette.
+func (c *RecordingHTTPClient) request(ctx context.Context, method HTTPMethod, body interface{}) (*Interaction, error) {
+	data, err := encodeBody(body)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &Interaction{
+		Method:     method,
+		URL:        resolveURL(ctx, c.URL()),
+		BodySHA256: hex.EncodeToString(sum[:]),
+		Request:    string(data),
+	}, nil
+}
+
+// replay returns the first unused recorded response matching in. When none
+// matches, the error names the first field in which the request differs
+// from the first unused recording for the same method and path.
+func (c *RecordingHTTPClient) replay(in *Interaction) (*Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	path := requestPath(in.URL)
+	body := c.normalize(in.Request)
+	var diff string
+	for i, rec := range c.interactions {
+		if c.used[i] || rec.Method != in.Method || requestPath(rec.URL) != path {
+			continue
+		}
+		if rec.Request == "" {
+			if rec.BodySHA256 == in.BodySHA256 {
+				c.used[i] = true
+				return rec, nil
+			}
+			continue
+		}
+		recBody := c.normalize(rec.Request)
+		if reflect.DeepEqual(recBody, body) {
+			c.used[i] = true
+			return rec, nil
+		}
+		if diff == "" {
+			diff = firstDiff("body", recBody, body)
+		}
+	}
+	if diff != "" {
+		return nil, fmt.Errorf("%w for %s %s: %s differs from the recording", ErrNoRecording, in.Method, path, diff)
+	}
+	return nil, fmt.Errorf("%w for %s %s", ErrNoRecording, in.Method, path)
+}
+
+// requestPath returns the path and query of url, or url itself when it
+// cannot be parsed.
+func requestPath(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return url
+	}
+	return u.RequestURI()
+}
+
+// normalize decodes a JSON request body without the ignored fields. A body
+// that is not JSON is returned as a string.
+func (c *RecordingHTTPClient) normalize(body string) interface{} {
+	dec := json.NewDecoder(bytes.NewReader([]byte(body)))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return body
+	}
+	for _, path := range c.ignored {
+		removeField(v, path)
+	}
+	return v
+}
+
+// removeField deletes the field at path from the JSON value v.
+func removeField(v interface{}, path []string) {
+	obj, ok := v.(map[string]interface{})
+	if !ok || len(path) == 0 {
+		return
+	}
+	if len(path) == 1 {
+		delete(obj, path[0])
+		return
+	}
+	removeField(obj[path[0]], path[1:])
+}
+
+// firstDiff returns the path of the first difference between two decoded
+// JSON values, e.g. "body.tools[0].function.description".
+func firstDiff(path string, a, b interface{}) string {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			return path
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if d := firstDiff(path+"."+k, av[k], bv[k]); d != "" {
+				return d
+			}
+		}
+		return ""
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			return path
+		}
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if d := firstDiff(fmt.Sprintf("%s[%d]", path, i), av[i], bv[i]); d != "" {
+				return d
+			}
+		}
+		if len(av) != len(bv) {
+			return fmt.Sprintf("%s (length %d, recorded %d)", path, len(bv), len(av))
+		}
+		return ""
+	}
+	if !reflect.DeepEqual(a, b) {
+		return path
+	}
+	return ""
+}
+
+// record appends in to the cassette and rewrites the file.
+func (c *RecordingHTTPClient) record(in *Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, in)
+	data, err := json.MarshalIndent(cassette{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if dir := filepath.Dir(c.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to write cassette: %w", err)
+		}
+	}
+	if err := os.WriteFile(c.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
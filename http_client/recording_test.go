@@ -0,0 +1,140 @@
+package httpclient_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	httpclient "reAct-agent/http_client"
+	"strings"
+	"testing"
+)
+
+func TestRecordingHTTPClientRecordsAndReplays(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasSuffix(r.URL.Path, "/stream") {
+			for _, part := range []string{"data: a\n\n", "data: b\n\n"} {
+				w.Write([]byte(part))
+				w.(http.Flusher).Flush()
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"echo":` + string(body) + `}`))
+	}))
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	auth := httpclient.WithHeader(httpclient.HTTPHeader{"Authorization": "Bearer secret-key"})
+	ctx := context.Background()
+
+	rec, err := httpclient.NewRecordingHTTPClient(httpclient.NewHTTPClient(srv.URL, "chat", auth), path, httpclient.RecordingMode)
+	if err != nil {
+		t.Fatalf("NewRecordingHTTPClient failed: %v", err)
+	}
+	live, err := rec.Send(ctx, httpclient.HTTPMethodPOST, map[string]string{"q": "hi"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	streamCtx := httpclient.WithRequestURL(ctx, srv.URL+"/stream")
+	liveStream := readStream(t, rec, streamCtx)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cassette not written: %v", err)
+	}
+	if strings.Contains(string(data), "secret-key") {
+		t.Fatal("request headers must not be recorded")
+	}
+
+	// 回放时服务端已关闭，只能从 cassette 读取
+	srv.Close()
+	replay, err := httpclient.NewRecordingHTTPClient(httpclient.NewHTTPClient(srv.URL, "chat", auth), path, httpclient.ReplayMode)
+	if err != nil {
+		t.Fatalf("NewRecordingHTTPClient failed: %v", err)
+	}
+	resp, err := replay.Send(ctx, httpclient.HTTPMethodPOST, map[string]string{"q": "hi"})
+	if err != nil {
+		t.Fatalf("replayed Send failed: %v", err)
+	}
+	if string(resp.Body) != string(live.Body) || resp.StatusCode != live.StatusCode || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("replayed response differs: %+v vs %+v", resp, live)
+	}
+	if got := readStream(t, replay, streamCtx); strings.Join(got, "") != strings.Join(liveStream, "") {
+		t.Fatalf("replayed stream differs: %q vs %q", got, liveStream)
+	}
+
+	// 每条记录只回放一次，未记录的请求报错
+	if _, err := replay.Send(ctx, httpclient.HTTPMethodPOST, map[string]string{"q": "hi"}); !errors.Is(err, httpclient.ErrNoRecording) {
+		t.Fatalf("expected ErrNoRecording for a used recording, got %v", err)
+	}
+	if _, err := replay.Send(ctx, httpclient.HTTPMethodPOST, map[string]string{"q": "other"}); !errors.Is(err, httpclient.ErrNoRecording) {
+		t.Fatalf("expected ErrNoRecording for a different body, got %v", err)
+	}
+}
+
+func readStream(t *testing.T, c httpclient.IHTTPClient, ctx context.Context) []string {
+	t.Helper()
+	chunks, errs := c.SendStream(ctx, httpclient.HTTPMethodPOST, map[string]bool{"stream": true})
+	var out []string
+	for chunk := range chunks {
+		out = append(out, string(chunk.Body))
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("SendStream failed: %v", err)
+	}
+	if len(out) == 0 {
+		t.Fatal("stream returned no chunks")
+	}
+	return out
+}
+
+func TestReplayMatchesNormalizedRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette := `{"interactions":[{
+		"method": "POST",
+		"url": "https://recorded.example/v1/chat",
+		"body_sha256": "stale",
+		"request": "{\"model\":\"m\",\"tools\":[{\"description\":\"old\"}],\"messages\":[{\"role\":\"user\",\"content\":\"hi\"}]}",
+		"status_code": 200,
+		"body": "ok"
+	}]}`
+	if err := os.WriteFile(path, []byte(cassette), 0o644); err != nil {
+		t.Fatalf("write cassette: %v", err)
+	}
+	ctx := context.Background()
+	inner := httpclient.NewHTTPClient("http://other.example/v1", "chat")
+	body := map[string]interface{}{
+		"messages": []map[string]string{{"content": "hi", "role": "user"}},
+		"model":    "m",
+		"tools":    []map[string]string{{"description": "new"}},
+	}
+
+	// 字段差异在错误中指明
+	replay, err := httpclient.NewRecordingHTTPClient(inner, path, httpclient.ReplayMode)
+	if err != nil {
+		t.Fatalf("NewRecordingHTTPClient failed: %v", err)
+	}
+	if _, err := replay.Send(ctx, httpclient.HTTPMethodPOST, body); !errors.Is(err, httpclient.ErrNoRecording) || !strings.Contains(err.Error(), "body.tools[0].description") {
+		t.Fatalf("expected ErrNoRecording naming the changed field, got %v", err)
+	}
+
+	// 主机、键顺序与忽略的字段不影响匹配
+	replay, err = httpclient.NewRecordingHTTPClient(inner, path, httpclient.ReplayMode, httpclient.WithIgnoredFields("tools"))
+	if err != nil {
+		t.Fatalf("NewRecordingHTTPClient failed: %v", err)
+	}
+	resp, err := replay.Send(ctx, httpclient.HTTPMethodPOST, body)
+	if err != nil || string(resp.Body) != "ok" {
+		t.Fatalf("expected the recording to match, got %v", err)
+	}
+}
+
+func TestReplayRequiresCassette(t *testing.T) {
+	_, err := httpclient.NewRecordingHTTPClient(nil, filepath.Join(t.TempDir(), "missing.json"), httpclient.ReplayMode)
+	if err == nil {
+		t.Fatal("expected an error for a missing cassette")
+	}
+}
@@ -0,0 +1,120 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reAct-agent/logging"
+	"time"
+)
+
+// RetryPredicate decides whether a Send attempt should be retried given its
+// response (nil on transport errors) and error.
+type RetryPredicate func(resp *HTTPResponse, err error) bool
+
+// DefaultRetryPredicate retries timeouts, 429 Too Many Requests and 5xx
+// responses. Cancellation of the caller's context is never retried.
+func DefaultRetryPredicate(resp *HTTPResponse, err error) bool {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false
+		}
+		var netErr net.Error
+		return errors.As(err, &netErr) && netErr.Timeout()
+	}
+	return resp != nil && (resp.StatusCode == 429 || resp.StatusCode >= 500)
+}
+
+// DefaultMaxRetryAfter is the longest server-requested wait a retry honors
+// unless WithMaxRetryAfter is used.
+const DefaultMaxRetryAfter = time.Minute
+
+// WithRetry retries a failed Send up to maxRetries times, waiting backoff
+// before the first retry and doubling the wait after each one. A wait
+// requested by the server through Retry-After (see ParseRetryAfter) is used
+// instead of the backoff when present; when it exceeds WithMaxRetryAfter,
+// the failed response is returned without retrying. Which failures are
+// retried is decided by DefaultRetryPredicate unless WithRetryPredicate is
+// used. SendStream is not retried.
+func WithRetry(maxRetries int, backoff time.Duration) Option {
+	return func(c *HTTPClient) {
+		if c == nil {
+			return
+		}
+		c.maxRetries = maxRetries
+		c.retryBackoff = backoff
+	}
+}
+
+// WithMaxRetryAfter sets the longest server-requested wait a retry honors,
+// DefaultMaxRetryAfter by default. A response asking for a longer wait,
+// e.g. "retry_after": 86400, is returned instead of stalling the call.
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(c *HTTPClient) {
+		if c == nil || d <= 0 {
+			return
+		}
+		c.maxRetryAfter = d
+	}
+}
+
+// WithRetryPredicate replaces DefaultRetryPredicate, e.g. to retry on a
+// provider error code embedded in a 200 body, or to never retry a 400.
+func WithRetryPredicate(p RetryPredicate) Option {
+	return func(c *HTTPClient) {
+		if c == nil {
+			return
+		}
+		c.retryPredicate = p
+	}
+}
+
+// retry wraps next so that retryable attempts are repeated with exponential
+// backoff. It runs inside the middleware chain, so every middleware sees one
+// logical call.
+func (c *HTTPClient) retry(next SendFunc) SendFunc {
+	shouldRetry := c.retryPredicate
+	if shouldRetry == nil {
+		shouldRetry = DefaultRetryPredicate
+	}
+	maxRetryAfter := c.maxRetryAfter
+	if maxRetryAfter == 0 {
+		maxRetryAfter = DefaultMaxRetryAfter
+	}
+	return func(ctx context.Context, method HTTPMethod, body interface{}) (*HTTPResponse, error) {
+		wait := c.retryBackoff
+		for attempt := 0; ; attempt++ {
+			resp, err := next(ctx, method, body)
+			if attempt >= c.maxRetries || !shouldRetry(resp, err) {
+				return resp, err
+			}
+			// 服务端给出 Retry-After 时以其为准；超过上限时不再重试，直接返回该响应
+			delay := wait
+			if resp != nil {
+				if d, ok := ParseRetryAfter(resp.Header, resp.Body); ok {
+					if d > maxRetryAfter {
+						logging.OrNoop(c.logger).Warn("retry-after exceeds the limit, not retrying", "retry_after", d, "limit", maxRetryAfter)
+						return resp, err
+					}
+					delay = d
+				}
+			}
+			// 等待期间响应 ctx 取消
+			kv := []any{"attempt", attempt + 1, "delay", delay}
+			if err != nil {
+				kv = append(kv, "error", err)
+			} else if resp != nil {
+				kv = append(kv, "status", resp.StatusCode)
+			}
+			logging.OrNoop(c.logger).Warn("retrying request", kv...)
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+			wait *= 2
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package httpclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retryAfterKeys are body fields read by ParseRetryAfter, mapped to the unit
+// of numeric values.
+var retryAfterKeys = map[string]time.Duration{
+	"retry_after":    time.Second,
+	"retryAfter":     time.Second,
+	"retry_after_ms": time.Millisecond,
+	"reset_after":    time.Second,
+}
+
+// ParseRetryAfter returns how long the server asked to wait before retrying.
+// It reads the Retry-After header (delay seconds or an HTTP-date) and falls
+// back to JSON body fields such as "retry_after", "retry_after_ms" or
+// "reset_after" at any depth, e.g. inside "requests_limit" or "error"
+// objects. String values may be seconds or a duration like "1.5s".
+func ParseRetryAfter(header http.Header, body []byte) (time.Duration, bool) {
+	if v := strings.TrimSpace(header.Get("Retry-After")); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+			return time.Duration(secs * float64(time.Second)), true
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			d := time.Until(at)
+			if d < 0 {
+				d = 0
+			}
+			return d, true
+		}
+	}
+	var doc interface{}
+	if len(body) == 0 || json.Unmarshal(body, &doc) != nil {
+		return 0, false
+	}
+	return findRetryAfter(doc)
+}
+
+func findRetryAfter(node interface{}) (time.Duration, bool) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for key, unit := range retryAfterKeys {
+			if d, ok := durationValue(v[key], unit); ok {
+				return d, true
+			}
+		}
+		for _, child := range v {
+			if d, ok := findRetryAfter(child); ok {
+				return d, true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if d, ok := findRetryAfter(child); ok {
+				return d, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func durationValue(v interface{}, unit time.Duration) (time.Duration, bool) {
+	switch n := v.(type) {
+	case float64:
+		if n >= 0 {
+			return time.Duration(n * float64(unit)), true
+		}
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil && f >= 0 {
+			return time.Duration(f * float64(unit)), true
+		}
+		if d, err := time.ParseDuration(n); err == nil && d >= 0 {
+			return d, true
+		}
+	}
+	return 0, false
+}
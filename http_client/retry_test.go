@@ -0,0 +1,157 @@
+package httpclient_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	httpclient "reAct-agent/http_client"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer answers status for the first failures requests, then 200.
+func failingServer(t *testing.T, status int, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetryDefaultPolicy(t *testing.T) {
+	srv, calls := failingServer(t, http.StatusServiceUnavailable, 2)
+	c := httpclient.NewHTTPClient(srv.URL, "", httpclient.WithRetry(3, time.Millisecond))
+	resp, err := c.Send(context.Background(), httpclient.HTTPMethodGET, nil)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("expected success after retries, got %v, %v", resp, err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+
+	// 默认策略不重试 4xx（429 除外）
+	srv, calls = failingServer(t, http.StatusTeapot, 2)
+	c = httpclient.NewHTTPClient(srv.URL, "", httpclient.WithRetry(3, time.Millisecond))
+	resp, err = c.Send(context.Background(), httpclient.HTTPMethodGET, nil)
+	if err != nil || resp.StatusCode != http.StatusTeapot || calls.Load() != 1 {
+		t.Fatalf("418 should not be retried by default: %v, %v, %d attempts", resp, err, calls.Load())
+	}
+}
+
+func TestRetryCustomPredicate(t *testing.T) {
+	srv, calls := failingServer(t, http.StatusTeapot, 2)
+	c := httpclient.NewHTTPClient(srv.URL, "",
+		httpclient.WithRetry(5, time.Millisecond),
+		httpclient.WithRetryPredicate(func(resp *httpclient.HTTPResponse, err error) bool {
+			return err == nil && resp.StatusCode == http.StatusTeapot
+		}),
+	)
+	resp, err := c.Send(context.Background(), httpclient.HTTPMethodGET, nil)
+	if err != nil || resp.StatusCode != 200 || string(resp.Body) != "ok" {
+		t.Fatalf("expected success after retrying 418, got %v, %v", resp, err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestRetryGivesUpAfterMaxRetries(t *testing.T) {
+	srv, calls := failingServer(t, http.StatusBadGateway, 100)
+	c := httpclient.NewHTTPClient(srv.URL, "", httpclient.WithRetry(2, time.Millisecond))
+	resp, err := c.Send(context.Background(), httpclient.HTTPMethodGET, nil)
+	if err != nil || resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected the last failing response, got %v, %v", resp, err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 1 attempt plus 2 retries, got %d", calls.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	future := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	cases := map[string]struct {
+		header string
+		body   string
+		want   time.Duration
+		ok     bool
+	}{
+		"header seconds":  {header: "2", want: 2 * time.Second, ok: true},
+		"header date":     {header: future, want: 30 * time.Second, ok: true},
+		"body seconds":    {body: `{"error":{"retry_after":3}}`, want: 3 * time.Second, ok: true},
+		"body ms":         {body: `{"retry_after_ms":1500}`, want: 1500 * time.Millisecond, ok: true},
+		"body nested":     {body: `{"requests_limit":{"limit":60,"reset_after":"1.5s"}}`, want: 1500 * time.Millisecond, ok: true},
+		"header wins":     {header: "1", body: `{"retry_after":9}`, want: time.Second, ok: true},
+		"nothing":         {body: `{"error":"slow down"}`},
+		"invalid body":    {body: `not json`},
+		"negative header": {header: "-1"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := http.Header{}
+			if tc.header != "" {
+				h.Set("Retry-After", tc.header)
+			}
+			got, ok := httpclient.ParseRetryAfter(h, []byte(tc.body))
+			if ok != tc.ok {
+				t.Fatalf("ok = %v, want %v", ok, tc.ok)
+			}
+			// HTTP 日期精度为秒，允许少量误差
+			if diff := got - tc.want; diff > time.Second || diff < -time.Second {
+				t.Fatalf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// 指数退避为 1 分钟，若未采用 Retry-After 测试将超时
+	c := httpclient.NewHTTPClient(srv.URL, "", httpclient.WithRetry(1, time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := c.Send(ctx, httpclient.HTTPMethodGET, nil)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("expected success after Retry-After, got %v, %v", resp, err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected 2 attempts, got %d", calls.Load())
+	}
+}
+
+func TestRetrySkipsRetryAfterBeyondLimit(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"retry_after":86400}}`))
+	}))
+	defer srv.Close()
+
+	c := httpclient.NewHTTPClient(srv.URL, "", httpclient.WithRetry(3, time.Millisecond), httpclient.WithMaxRetryAfter(time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := c.Send(ctx, httpclient.HTTPMethodGET, nil)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected the 429 to be returned, got %v, %v", resp, err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("a wait beyond the limit should not be retried, got %d attempts", calls.Load())
+	}
+}
@@ -0,0 +1,57 @@
+package httpclient
+
+import (
+	"net/http"
+	"time"
+)
+
+// Connection pool defaults of NewTransport. They follow http.DefaultTransport
+// except for the idle connections kept per host, raised from 2 so that
+// concurrent calls to a single provider reuse connections instead of
+// dialing and closing them on every burst.
+const (
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 16
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+// NewTransport returns a clone of http.DefaultTransport with the pool
+// defaults above. It is used when no transport is given via WithTransport,
+// and can be passed to several clients to share one pool.
+func NewTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = DefaultMaxIdleConns
+	t.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	t.IdleConnTimeout = DefaultIdleConnTimeout
+	return t
+}
+
+// WithMaxIdleConns limits the idle connections kept across all hosts; zero
+// means no limit.
+func WithMaxIdleConns(n int) Option {
+	return withTransportTuning(func(t *http.Transport) { t.MaxIdleConns = n })
+}
+
+// WithMaxIdleConnsPerHost limits the idle connections kept per host; zero
+// means http.DefaultMaxIdleConnsPerHost.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return withTransportTuning(func(t *http.Transport) { t.MaxIdleConnsPerHost = n })
+}
+
+// WithIdleConnTimeout sets how long an idle connection stays in the pool;
+// zero keeps it until the server closes it.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return withTransportTuning(func(t *http.Transport) { t.IdleConnTimeout = d })
+}
+
+// withTransportTuning records a change applied to the client's transport once
+// it is chosen. A transport given via WithTransport is shared, so the change
+// affects every client using it.
+func withTransportTuning(tune func(t *http.Transport)) Option {
+	return func(c *HTTPClient) {
+		if c == nil {
+			return
+		}
+		c.transportTuning = append(c.transportTuning, tune)
+	}
+}
@@ -0,0 +1,81 @@
+// Package logging defines the structured logger used by the HTTP client,
+// model clients and the agent loop. Implementations adapt it to a backend
+// such as zap; a *slog.Logger can be used directly; Noop is used when none is configured.
+package logging
+
+import "log/slog"
+
+// Logger receives leveled log lines with alternating key/value pairs, in the
+// style of log/slog. Implementations must be safe for concurrent use.
+type Logger interface {
+	Debug(msg string, kv ...any)
+	Info(msg string, kv ...any)
+	Warn(msg string, kv ...any)
+	Error(msg string, kv ...any)
+}
+
+// Level is the severity of a log line. The values match slog.Level.
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+// Noop discards every log line.
+type Noop struct{}
+
+var _ Logger = Noop{}
+
+func (Noop) Debug(msg string, kv ...any) {}
+func (Noop) Info(msg string, kv ...any)  {}
+func (Noop) Warn(msg string, kv ...any)  {}
+func (Noop) Error(msg string, kv ...any) {}
+
+// OrNoop returns l, or Noop when l is nil.
+func OrNoop(l Logger) Logger {
+	if l == nil {
+		return Noop{}
+	}
+	return l
+}
+
+// WithMinLevel returns a Logger that passes lines at min and above to l and
+// drops the rest.
+func WithMinLevel(l Logger, min Level) Logger {
+	return leveled{next: OrNoop(l), min: min}
+}
+
+type leveled struct {
+	next Logger
+	min  Level
+}
+
+func (l leveled) Debug(msg string, kv ...any) {
+	if l.min <= LevelDebug {
+		l.next.Debug(msg, kv...)
+	}
+}
+
+func (l leveled) Info(msg string, kv ...any) {
+	if l.min <= LevelInfo {
+		l.next.Info(msg, kv...)
+	}
+}
+
+func (l leveled) Warn(msg string, kv ...any) {
+	if l.min <= LevelWarn {
+		l.next.Warn(msg, kv...)
+	}
+}
+
+func (l leveled) Error(msg string, kv ...any) {
+	if l.min <= LevelError {
+		l.next.Error(msg, kv...)
+	}
+}
+
+// *slog.Logger implements Logger as is.
+var _ Logger = (*slog.Logger)(nil)
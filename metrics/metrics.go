@@ -0,0 +1,37 @@
+// Package metrics defines the observability hooks reported by model clients
+// and the agent loop. Implementations adapt them to a backend such as
+// Prometheus; Noop is used when none is configured.
+package metrics
+
+import "time"
+
+// Metrics receives counters and observations. Implementations must be safe
+// for concurrent use.
+type Metrics interface {
+	// IncRequest counts one request sent to a model provider.
+	IncRequest(provider, model string)
+	// ObserveLatency records how long a model request took.
+	ObserveLatency(provider, model string, d time.Duration)
+	// IncToolCall counts one tool execution and whether it succeeded.
+	IncToolCall(name string, success bool)
+	// ObserveTokens records the token usage reported for a request.
+	ObserveTokens(prompt, completion int)
+}
+
+// Noop discards every metric.
+type Noop struct{}
+
+var _ Metrics = Noop{}
+
+func (Noop) IncRequest(provider, model string)                      {}
+func (Noop) ObserveLatency(provider, model string, d time.Duration) {}
+func (Noop) IncToolCall(name string, success bool)                  {}
+func (Noop) ObserveTokens(prompt, completion int)                   {}
+
+// OrNoop returns m, or Noop when m is nil.
+func OrNoop(m Metrics) Metrics {
+	if m == nil {
+		return Noop{}
+	}
+	return m
+}
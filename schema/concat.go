@@ -0,0 +1,122 @@
+package schema
+
+import "strings"
+
+// MessageAccumulator assembles a complete message from streamed deltas.
+//
+// Accumulation strategy: Content, ReasoningContent and tool-call Arguments are joined by
+// raw concatenation, with no separator inserted. Providers split JSON
+// arguments at arbitrary byte positions (even inside a string literal or a
+// number), so anything other than plain concatenation would corrupt them;
+// content deltas already carry their own whitespace.
+//
+// Tool-call deltas are grouped by Index. A delta without an Index is matched
+// by ID, and a delta with neither is appended to the most recent call. Name,
+// ID and Type keep the first non-empty value seen for a call.
+//
+// The role is the first one set on a delta. A delta without a role, such as
+// a usage-only or keep-alive chunk, carries the zero value RoleUser, which a
+// streamed reply never has, so it is skipped; without any role the message
+// is RoleAssistant.
+type MessageAccumulator struct {
+	role    Role
+	hasRole bool
+	content strings.Builder
+	reason  strings.Builder
+	calls   []*toolCallBuilder
+	byIndex map[int]*toolCallBuilder
+}
+
+type toolCallBuilder struct {
+	id   string
+	typ  string
+	name string
+	args strings.Builder
+}
+
+// Add merges a delta into the accumulated message. Nil deltas and Final
+// messages, which repeat the whole content, are ignored.
+func (a *MessageAccumulator) Add(delta *Message) {
+	if delta == nil || delta.Final {
+		return
+	}
+	// 零值即未设置角色，取第一个设置了角色的增量
+	if !a.hasRole && delta.Role != RoleUser {
+		a.role = delta.Role
+		a.hasRole = true
+	}
+	a.content.WriteString(delta.Content)
+	a.reason.WriteString(delta.ReasoningContent)
+	for _, tc := range delta.ToolCalls {
+		b := a.builderFor(tc)
+		if b.id == "" {
+			b.id = tc.ID
+		}
+		if b.typ == "" {
+			b.typ = tc.Type
+		}
+		if b.name == "" {
+			b.name = tc.Function.Name
+		}
+		b.args.WriteString(tc.Function.Arguments)
+	}
+}
+
+// builderFor locates the tool call a delta belongs to, creating it if needed.
+func (a *MessageAccumulator) builderFor(tc ToolCall) *toolCallBuilder {
+	if tc.Index != nil {
+		if a.byIndex == nil {
+			a.byIndex = make(map[int]*toolCallBuilder)
+		}
+		if b, ok := a.byIndex[*tc.Index]; ok {
+			return b
+		}
+		b := &toolCallBuilder{}
+		a.byIndex[*tc.Index] = b
+		a.calls = append(a.calls, b)
+		return b
+	}
+	if tc.ID != "" {
+		for _, b := range a.calls {
+			if b.id == tc.ID {
+				return b
+			}
+		}
+	} else if len(a.calls) > 0 {
+		return a.calls[len(a.calls)-1]
+	}
+	b := &toolCallBuilder{}
+	a.calls = append(a.calls, b)
+	return b
+}
+
+// Finalize returns the assembled message. Tool calls keep the order in which
+// they first appeared and have their Index cleared, as in a non-streaming
+// response.
+func (a *MessageAccumulator) Finalize() *Message {
+	msg := &Message{Role: a.role, Content: a.content.String(), ReasoningContent: a.reason.String()}
+	if !a.hasRole {
+		msg.Role = RoleAssistant
+	}
+	for _, b := range a.calls {
+		msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+			ID:   b.id,
+			Type: b.typ,
+			Function: FunctionCall{
+				Name:      b.name,
+				Arguments: b.args.String(),
+			},
+		})
+	}
+	return msg
+}
+
+// ConcatMessages assembles streamed deltas into a single message using the
+// MessageAccumulator strategy.
+func ConcatMessages(deltas []*Message) *Message {
+	var acc MessageAccumulator
+	for _, d := range deltas {
+		acc.Add(d)
+	}
+	return acc.Finalize()
+}
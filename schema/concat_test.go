@@ -0,0 +1,83 @@
+package schema_test
+
+import (
+	"encoding/json"
+	"reAct-agent/schema"
+	"testing"
+)
+
+func intPtr(i int) *int { return &i }
+
+func TestConcatMessagesReassemblesArgumentsAtEverySplit(t *testing.T) {
+	args := `{"expression":"(1 + 2) * 3","precision":2,"tags":["a","b"]}`
+	for i := 0; i <= len(args); i++ {
+		for j := i; j <= len(args); j++ {
+			deltas := []*schema.Message{
+				{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: intPtr(0), ID: "call_1", Type: "function", Function: schema.FunctionCall{Name: "calculator", Arguments: args[:i]}}}},
+				{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: intPtr(0), Function: schema.FunctionCall{Arguments: args[i:j]}}}},
+				{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: intPtr(0), Function: schema.FunctionCall{Arguments: args[j:]}}}},
+			}
+			msg := schema.ConcatMessages(deltas)
+			if len(msg.ToolCalls) != 1 {
+				t.Fatalf("split %d/%d: expected 1 tool call, got %d", i, j, len(msg.ToolCalls))
+			}
+			got := msg.ToolCalls[0]
+			if got.Function.Arguments != args {
+				t.Fatalf("split %d/%d: arguments %q != %q", i, j, got.Function.Arguments, args)
+			}
+			if !json.Valid([]byte(got.Function.Arguments)) {
+				t.Fatalf("split %d/%d: reassembled arguments are not valid JSON", i, j)
+			}
+			if got.ID != "call_1" || got.Function.Name != "calculator" || got.Index != nil {
+				t.Fatalf("split %d/%d: unexpected call metadata %+v", i, j, got)
+			}
+		}
+	}
+}
+
+func TestConcatMessagesGroupsInterleavedCallsByIndex(t *testing.T) {
+	deltas := []*schema.Message{
+		{Role: schema.RoleAssistant, Content: "Let me "},
+		{Role: schema.RoleAssistant, Content: "check.", ToolCalls: []schema.ToolCall{{Index: intPtr(0), ID: "a", Function: schema.FunctionCall{Name: "first", Arguments: `{"x":`}}}},
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: intPtr(1), ID: "b", Function: schema.FunctionCall{Name: "second", Arguments: `{"y":`}}}},
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: intPtr(0), Function: schema.FunctionCall{Arguments: `1}`}}}},
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Index: intPtr(1), Function: schema.FunctionCall{Arguments: `2}`}}}},
+	}
+	msg := schema.ConcatMessages(deltas)
+	if msg.Content != "Let me check." {
+		t.Fatalf("content not concatenated raw: %q", msg.Content)
+	}
+	if len(msg.ToolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %d", len(msg.ToolCalls))
+	}
+	if msg.ToolCalls[0].Function.Name != "first" || msg.ToolCalls[0].Function.Arguments != `{"x":1}` {
+		t.Fatalf("unexpected first call %+v", msg.ToolCalls[0])
+	}
+	if msg.ToolCalls[1].Function.Name != "second" || msg.ToolCalls[1].Function.Arguments != `{"y":2}` {
+		t.Fatalf("unexpected second call %+v", msg.ToolCalls[1])
+	}
+}
+
+func TestConcatMessagesWithoutIndexAppendsToLastCall(t *testing.T) {
+	msg := schema.ConcatMessages([]*schema.Message{
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{ID: "a", Function: schema.FunctionCall{Name: "tool", Arguments: `{"q":"he`}}}},
+		{Role: schema.RoleAssistant, ToolCalls: []schema.ToolCall{{Function: schema.FunctionCall{Arguments: `llo"}`}}}},
+	})
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Function.Arguments != `{"q":"hello"}` {
+		t.Fatalf("unexpected tool calls %+v", msg.ToolCalls)
+	}
+}
+
+func TestConcatMessagesTakesFirstSetRole(t *testing.T) {
+	msg := schema.ConcatMessages([]*schema.Message{
+		{ResponseMeta: &schema.ResponseMeta{Usage: &schema.TokenUsage{TotalTokens: 1}}},
+		{Role: schema.RoleTool, Content: "a"},
+		{Role: schema.RoleAssistant, Content: "b"},
+	})
+	if msg.Role != schema.RoleTool || msg.Content != "ab" {
+		t.Fatalf("expected the first set role, got %v %q", msg.Role, msg.Content)
+	}
+	if msg := schema.ConcatMessages([]*schema.Message{{Content: "hi"}}); msg.Role != schema.RoleAssistant {
+		t.Fatalf("deltas without a role should assemble an assistant message, got %v", msg.Role)
+	}
+}
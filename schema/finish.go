@@ -0,0 +1,55 @@
+package schema
+
+// FinishReason is the provider-independent reason a message ended. Clients
+// map each provider's raw value to it; the raw value is kept in
+// ResponseMeta.RawFinishReason. The empty value means none was reported.
+type FinishReason string
+
+const (
+	// FinishStop is a natural end of the answer or a stop sequence.
+	FinishStop FinishReason = "stop"
+	// FinishToolCalls means the model stopped to call tools.
+	FinishToolCalls FinishReason = "tool_calls"
+	// FinishLength means the output hit the token limit.
+	FinishLength FinishReason = "length"
+	// FinishContentFilter means the provider withheld or cut the output.
+	FinishContentFilter FinishReason = "content_filter"
+	// FinishOther covers reasons without a normalized equivalent.
+	FinishOther FinishReason = "other"
+)
+
+// finishReasons maps raw values used by common providers: OpenAI-compatible
+// APIs such as QWen, and Anthropic's stop_reason.
+var finishReasons = map[string]FinishReason{
+	"stop":           FinishStop,
+	"end_turn":       FinishStop,
+	"stop_sequence":  FinishStop,
+	"tool_calls":     FinishToolCalls,
+	"function_call":  FinishToolCalls,
+	"tool_use":       FinishToolCalls,
+	"length":         FinishLength,
+	"max_tokens":     FinishLength,
+	"content_filter": FinishContentFilter,
+	"refusal":        FinishContentFilter,
+}
+
+// NormalizeFinishReason maps a provider's raw finish reason. Unknown values
+// become FinishOther; an empty value stays empty.
+func NormalizeFinishReason(raw string) FinishReason {
+	if raw == "" {
+		return ""
+	}
+	if r, ok := finishReasons[raw]; ok {
+		return r
+	}
+	return FinishOther
+}
+
+// FinishReason returns the normalized reason the model ended msg, or "" for
+// messages that did not come from a model client.
+func (m *Message) FinishReason() FinishReason {
+	if m == nil || m.ResponseMeta == nil {
+		return ""
+	}
+	return m.ResponseMeta.FinishReason
+}
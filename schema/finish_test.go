@@ -0,0 +1,44 @@
+package schema_test
+
+import (
+	"reAct-agent/schema"
+	"testing"
+)
+
+func TestNormalizeFinishReason(t *testing.T) {
+	for _, tc := range []struct {
+		provider string
+		raw      string
+		want     schema.FinishReason
+	}{
+		{"qwen", "stop", schema.FinishStop},
+		{"qwen", "tool_calls", schema.FinishToolCalls},
+		{"qwen", "length", schema.FinishLength},
+		{"qwen", "content_filter", schema.FinishContentFilter},
+		{"qwen", "", ""},
+		{"claude", "end_turn", schema.FinishStop},
+		{"claude", "stop_sequence", schema.FinishStop},
+		{"claude", "tool_use", schema.FinishToolCalls},
+		{"claude", "max_tokens", schema.FinishLength},
+		{"claude", "refusal", schema.FinishContentFilter},
+		{"claude", "pause_turn", schema.FinishOther},
+	} {
+		if got := schema.NormalizeFinishReason(tc.raw); got != tc.want {
+			t.Errorf("%s %q: got %q, want %q", tc.provider, tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestMessageFinishReason(t *testing.T) {
+	var nilMsg *schema.Message
+	if got := nilMsg.FinishReason(); got != "" {
+		t.Fatalf("nil message: got %q", got)
+	}
+	if got := (&schema.Message{Content: "local"}).FinishReason(); got != "" {
+		t.Fatalf("message without metadata: got %q", got)
+	}
+	msg := &schema.Message{ResponseMeta: &schema.ResponseMeta{FinishReason: schema.FinishLength, RawFinishReason: "max_tokens"}}
+	if got := msg.FinishReason(); got != schema.FinishLength {
+		t.Fatalf("got %q, want %q", got, schema.FinishLength)
+	}
+}
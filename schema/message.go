@@ -1,5 +1,10 @@
 package schema
 
+import (
+	"fmt"
+	"time"
+)
+
 // Role represents the role of a message sender.
 // It follows the UML enum: User, String, Assistant, Tool.
 // Using iota for stable internal representation.
@@ -27,8 +32,125 @@ func (r Role) String() string {
 	}
 }
 
+// MarshalText encodes the role as its label, e.g. "assistant".
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText decodes a role label produced by MarshalText.
+func (r *Role) UnmarshalText(text []byte) error {
+	for _, role := range []Role{RoleUser, RoleSystem, RoleAssistant, RoleTool} {
+		if role.String() == string(text) {
+			*r = role
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown role %q", text)
+}
+
 // Message models a chat message with a role and textual content.
+// Assistant messages may carry structured ToolCalls; tool messages reference
+// the call they answer through ToolCallID.
 type Message struct {
-	Role    Role
-	Content string
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+	// ReasoningContent holds the model's reasoning ("thinking") output,
+	// kept apart from the answer in Content so UIs can show or hide it. A
+	// streamed delta carrying only ReasoningContent is a reasoning delta.
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+
+	// ResponseMeta is set on messages returned by a model client.
+	ResponseMeta *ResponseMeta `json:"response_meta,omitempty"`
+
+	// CreatedAt is when the agent created or received the message, and Seq
+	// its position in the conversation, counting from 1. Both are zero on
+	// messages the agent has not recorded yet, e.g. stream deltas.
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	Seq       int64     `json:"seq,omitempty"`
+
+	// CacheHint asks providers that support prompt caching to cache the
+	// prompt up to and including this message, e.g. a large static system
+	// prompt. Clients without support ignore it.
+	CacheHint bool `json:"cache_hint,omitempty"`
+
+	// NeedsUserInput marks a final answer that asks the user for more input,
+	// such as a clarifying question, so a UI can prompt for a reply instead
+	// of treating the task as done. The agent sets it when configured to.
+	NeedsUserInput bool `json:"needs_user_input,omitempty"`
+
+	// ChoiceIndex is the index of the completion a message belongs to when
+	// several were requested, such as with QWenModelClient.StreamChoices.
+	// It is 0 otherwise.
+	ChoiceIndex int `json:"choice_index,omitempty"`
+
+	// Final marks the terminal message of a stream: it carries the whole
+	// assembled content, tool calls and metadata rather than a delta.
+	// MessageAccumulator ignores final messages.
+	Final bool `json:"-"`
+}
+
+// ResponseMeta carries provider metadata about how a message was generated.
+type ResponseMeta struct {
+	// FinishReason is the normalized reason for ending the message; branch
+	// on it rather than on RawFinishReason, the provider's own value.
+	FinishReason    FinishReason `json:"finish_reason,omitempty"`
+	RawFinishReason string       `json:"raw_finish_reason,omitempty"`
+	// FilteredCategories lists the moderation categories that caused a
+	// FinishContentFilter, when the provider reports them.
+	FilteredCategories []string `json:"filtered_categories,omitempty"`
+	// Usage is the token usage of the request, when reported.
+	Usage *TokenUsage `json:"usage,omitempty"`
+	// LogProbs is only populated when log-probabilities were requested.
+	LogProbs *LogProbs `json:"logprobs,omitempty"`
+	// SystemFingerprint identifies the backend configuration that served
+	// the request, when reported. With a fixed seed, responses are only
+	// expected to be reproducible while it stays the same.
+	SystemFingerprint string `json:"system_fingerprint,omitempty"`
+}
+
+// TokenUsage reports the tokens consumed by a request.
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// LogProbs holds the token log-probabilities of the generated content.
+type LogProbs struct {
+	Content []TokenLogProb `json:"content"`
+}
+
+// TokenLogProb describes one generated token and its most likely alternatives.
+type TokenLogProb struct {
+	Token       string       `json:"token"`
+	LogProb     float64      `json:"logprob"`
+	Bytes       []int64      `json:"bytes,omitempty"`
+	TopLogProbs []TopLogProb `json:"top_logprobs,omitempty"`
+}
+
+// TopLogProb is one of the most likely candidates at a token position.
+type TopLogProb struct {
+	Token   string  `json:"token"`
+	LogProb float64 `json:"logprob"`
+	Bytes   []int64 `json:"bytes,omitempty"`
+}
+
+// ToolCall describes a single function invocation requested by the model.
+type ToolCall struct {
+	// Index is the position of the call within a streamed response. It is nil
+	// for non-streaming responses.
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall holds the name of the function to call and its arguments
+// encoded as a JSON string.
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
 }
@@ -0,0 +1,43 @@
+package schema
+
+import "strings"
+
+// Transcript renders messages as readable text for logs and golden files,
+// one "role: content" entry per message. Reasoning is shown on its own
+// "role (reasoning):" line, every tool call as "role -> name(arguments)
+// [id]" and tool results as "tool [id]: content". Continuation lines of
+// multi-line content are indented by two spaces; nil messages are skipped.
+func Transcript(messages []*Message) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		role := msg.Role.String()
+		if msg.ReasoningContent != "" {
+			writeEntry(&b, role+" (reasoning)", msg.ReasoningContent)
+		}
+		switch {
+		case msg.Role == RoleTool && msg.ToolCallID != "":
+			writeEntry(&b, role+" ["+msg.ToolCallID+"]", msg.Content)
+		case msg.Content != "" || len(msg.ToolCalls) == 0:
+			writeEntry(&b, role, msg.Content)
+		}
+		for _, call := range msg.ToolCalls {
+			b.WriteString(role + " -> " + call.Function.Name + "(" + call.Function.Arguments + ")")
+			if call.ID != "" {
+				b.WriteString(" [" + call.ID + "]")
+			}
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func writeEntry(b *strings.Builder, label, content string) {
+	b.WriteString(label + ":")
+	if content != "" {
+		b.WriteString(" " + strings.ReplaceAll(strings.TrimRight(content, "\n"), "\n", "\n  "))
+	}
+	b.WriteByte('\n')
+}
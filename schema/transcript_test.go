@@ -0,0 +1,37 @@
+package schema_test
+
+import (
+	"reAct-agent/schema"
+	"testing"
+)
+
+func TestTranscript(t *testing.T) {
+	messages := []*schema.Message{
+		{Role: schema.RoleSystem, Content: "You are a calculator."},
+		{Role: schema.RoleUser, Content: "What is 2+2,\nand 3*3?"},
+		{Role: schema.RoleAssistant, ReasoningContent: "Two calculations.", ToolCalls: []schema.ToolCall{
+			{ID: "call_1", Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expression":"2+2"}`}},
+			{ID: "call_2", Function: schema.FunctionCall{Name: "calculator", Arguments: `{"expression":"3*3"}`}},
+		}},
+		{Role: schema.RoleTool, ToolCallID: "call_1", Content: `{"result":4}`},
+		{Role: schema.RoleTool, ToolCallID: "call_2", Content: `{"result":9}`},
+		nil,
+		{Role: schema.RoleAssistant, Content: "Final Answer: 4 and 9"},
+	}
+	want := `system: You are a calculator.
+user: What is 2+2,
+  and 3*3?
+assistant (reasoning): Two calculations.
+assistant -> calculator({"expression":"2+2"}) [call_1]
+assistant -> calculator({"expression":"3*3"}) [call_2]
+tool [call_1]: {"result":4}
+tool [call_2]: {"result":9}
+assistant: Final Answer: 4 and 9
+`
+	if got := schema.Transcript(messages); got != want {
+		t.Fatalf("unexpected transcript:\n%s\nwant:\n%s", got, want)
+	}
+	if got := schema.Transcript(nil); got != "" {
+		t.Fatalf("empty conversation should render nothing, got %q", got)
+	}
+}
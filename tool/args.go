@@ -0,0 +1,110 @@
+package tool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DecodeArgs decodes the arguments passed to Execute into out, a pointer to a
+// struct whose fields use json tags:
+//
+//	type CalcArgs struct {
+//		Expression string `json:"expression" validate:"required"`
+//	}
+//	var args CalcArgs
+//	if err := tool.DecodeArgs(params, &args); err != nil { ... }
+//
+// Fields tagged validate:"required" must be present and non-null, including
+// fields of nested structs whose parent object is present. Errors name the
+// offending argument.
+func DecodeArgs(params map[string]interface{}, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("decode arguments: out must be a non-nil pointer, got %T", out)
+	}
+	if t := rv.Elem().Type(); t.Kind() == reflect.Struct {
+		if err := checkRequiredFields(t, params, ""); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("decode arguments: %w", err)
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return fmt.Errorf("argument %q: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return fmt.Errorf("decode arguments: %w", err)
+	}
+	return nil
+}
+
+// checkRequiredFields reports the first validate:"required" field of t that
+// is missing from obj, recursing into nested structs.
+func checkRequiredFields(t reflect.Type, obj map[string]interface{}, prefix string) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		// 匿名嵌入的结构体字段与外层处于同一层级
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			if err := checkRequiredFields(ft, obj, prefix); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		v, ok := lookupArg(obj, name)
+		if !ok || v == nil {
+			if hasValidateRule(f, "required") {
+				return fmt.Errorf("argument %q is required", prefix+name)
+			}
+			continue
+		}
+		if sub, isObj := v.(map[string]interface{}); isObj && ft.Kind() == reflect.Struct {
+			if err := checkRequiredFields(ft, sub, prefix+name+"."); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookupArg finds key like encoding/json does: exact match first, then a
+// case-insensitive one.
+func lookupArg(obj map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := obj[key]; ok {
+		return v, true
+	}
+	for k, v := range obj {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func hasValidateRule(f reflect.StructField, rule string) bool {
+	for _, r := range strings.Split(f.Tag.Get("validate"), ",") {
+		if strings.TrimSpace(r) == rule {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package tool_test
+
+import (
+	"reAct-agent/tool"
+	"strings"
+	"testing"
+)
+
+type searchArgs struct {
+	Query  string   `json:"q" validate:"required"`
+	Limit  int      `json:"limit"`
+	Tags   []string `json:"tags"`
+	Filter *struct {
+		Lang string `json:"lang" validate:"required"`
+	} `json:"filter"`
+}
+
+func TestDecodeArgs(t *testing.T) {
+	var args searchArgs
+	err := tool.DecodeArgs(map[string]interface{}{
+		"q":      "golang",
+		"limit":  float64(5),
+		"tags":   []interface{}{"a", "b"},
+		"filter": map[string]interface{}{"lang": "en"},
+	}, &args)
+	if err != nil {
+		t.Fatalf("DecodeArgs failed: %v", err)
+	}
+	if args.Query != "golang" || args.Limit != 5 || len(args.Tags) != 2 || args.Filter == nil || args.Filter.Lang != "en" {
+		t.Fatalf("unexpected args %+v", args)
+	}
+}
+
+func TestDecodeArgsErrors(t *testing.T) {
+	cases := map[string]struct {
+		params map[string]interface{}
+		want   string
+	}{
+		"missing required":        {map[string]interface{}{"limit": float64(1)}, `argument "q" is required`},
+		"null required":           {map[string]interface{}{"q": nil}, `argument "q" is required`},
+		"nested missing required": {map[string]interface{}{"q": "x", "filter": map[string]interface{}{}}, `argument "filter.lang" is required`},
+		"type mismatch":           {map[string]interface{}{"q": "x", "limit": "five"}, `argument "limit": expected int, got string`},
+		"element mismatch":        {map[string]interface{}{"q": "x", "tags": []interface{}{1}}, `expected string, got number`},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var args searchArgs
+			err := tool.DecodeArgs(tc.params, &args)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+
+	var args searchArgs
+	if err := tool.DecodeArgs(map[string]interface{}{"q": "x"}, args); err == nil {
+		t.Fatal("expected error for non-pointer out")
+	}
+}
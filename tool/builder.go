@@ -0,0 +1,163 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ToolInfoBuilder constructs a ToolInfo fluently:
+//
+//	info, err := tool.NewToolInfo("search", "search documents").
+//		AddString("q", "query text", true).
+//		AddObject("filter", "optional filters", false,
+//			tool.NewParam("lang", tool.String, "language code", false)).
+//		Build()
+//
+// Mistakes such as duplicate parameter names are collected and reported by
+// Build, so calls can be chained without intermediate error checks.
+type ToolInfoBuilder struct {
+	info ToolInfo
+	errs []error
+}
+
+// NewToolInfo starts building a ToolInfo with the given name and description.
+func NewToolInfo(name, desc string) *ToolInfoBuilder {
+	return &ToolInfoBuilder{info: ToolInfo{Name: name, Desc: desc, Parameters: make(map[string]*ParameterInfo)}}
+}
+
+// NewParam returns a ParameterInfo, handy for object fields and array elements.
+func NewParam(name string, typ DataType, desc string, required bool) *ParameterInfo {
+	return &ParameterInfo{Name: name, Type: typ, Desc: desc, Required: required}
+}
+
+// Add registers an arbitrary parameter.
+func (b *ToolInfoBuilder) Add(p *ParameterInfo) *ToolInfoBuilder {
+	if p == nil {
+		b.errs = append(b.errs, errors.New("nil parameter"))
+		return b
+	}
+	if err := checkParam(p, "parameter"); err != nil {
+		b.errs = append(b.errs, err)
+		return b
+	}
+	if _, dup := b.info.Parameters[p.Name]; dup {
+		b.errs = append(b.errs, fmt.Errorf("duplicate parameter %q", p.Name))
+		return b
+	}
+	b.info.Parameters[p.Name] = p
+	return b
+}
+
+// AddString registers a string parameter.
+func (b *ToolInfoBuilder) AddString(name, desc string, required bool) *ToolInfoBuilder {
+	return b.Add(NewParam(name, String, desc, required))
+}
+
+// AddInteger registers an integer parameter.
+func (b *ToolInfoBuilder) AddInteger(name, desc string, required bool) *ToolInfoBuilder {
+	return b.Add(NewParam(name, Integer, desc, required))
+}
+
+// AddNumber registers a floating point parameter.
+func (b *ToolInfoBuilder) AddNumber(name, desc string, required bool) *ToolInfoBuilder {
+	return b.Add(NewParam(name, Number, desc, required))
+}
+
+// AddBoolean registers a boolean parameter.
+func (b *ToolInfoBuilder) AddBoolean(name, desc string, required bool) *ToolInfoBuilder {
+	return b.Add(NewParam(name, Boolean, desc, required))
+}
+
+// AddObject registers an object parameter with the given fields.
+func (b *ToolInfoBuilder) AddObject(name, desc string, required bool, fields ...*ParameterInfo) *ToolInfoBuilder {
+	p := NewParam(name, Object, desc, required)
+	p.SubInfo = make(map[string]*ParameterInfo, len(fields))
+	for _, f := range fields {
+		if f == nil {
+			b.errs = append(b.errs, fmt.Errorf("object %q: nil field", name))
+			return b
+		}
+		if _, dup := p.SubInfo[f.Name]; dup {
+			b.errs = append(b.errs, fmt.Errorf("object %q: duplicate field %q", name, f.Name))
+			return b
+		}
+		p.SubInfo[f.Name] = f
+	}
+	return b.Add(p)
+}
+
+// AddArray registers an array parameter whose elements follow elem.
+func (b *ToolInfoBuilder) AddArray(name, desc string, required bool, elem *ParameterInfo) *ToolInfoBuilder {
+	p := NewParam(name, Array, desc, required)
+	p.ElemInfo = elem
+	return b.Add(p)
+}
+
+// Strict sets ToolInfo.Strict.
+func (b *ToolInfoBuilder) Strict(strict bool) *ToolInfoBuilder {
+	b.info.Strict = strict
+	return b
+}
+
+// Returns sets ToolInfo.ReturnSchema, the shape of the tool's result.
+func (b *ToolInfoBuilder) Returns(p *ParameterInfo) *ToolInfoBuilder {
+	if p == nil {
+		b.errs = append(b.errs, errors.New("nil return schema"))
+		return b
+	}
+	if err := checkParam(p, "return schema"); err != nil {
+		b.errs = append(b.errs, err)
+		return b
+	}
+	b.info.ReturnSchema = p
+	return b
+}
+
+// Build returns the ToolInfo, or every problem collected while building it.
+func (b *ToolInfoBuilder) Build() (ToolInfo, error) {
+	errs := b.errs
+	if b.info.Name == "" {
+		errs = append([]error{errors.New("tool name is required")}, errs...)
+	}
+	if len(errs) > 0 {
+		return ToolInfo{}, errors.Join(errs...)
+	}
+	return b.info, nil
+}
+
+// checkParam verifies a parameter has a name and a known type, that arrays
+// describe their elements and objects their fields, recursing into both.
+func checkParam(p *ParameterInfo, path string) error {
+	if p.Name == "" {
+		return fmt.Errorf("%s: name is required", path)
+	}
+	path = fmt.Sprintf("%s %q", path, p.Name)
+	if p.Type < Integer || p.Type > Array {
+		return fmt.Errorf("%s: unknown type %d", path, int(p.Type))
+	}
+	if p.Type == Array && p.ElemInfo == nil {
+		return fmt.Errorf("%s: array requires ElemInfo", path)
+	}
+	if p.Type == Object && p.SubInfo == nil {
+		return fmt.Errorf("%s: object requires SubInfo", path)
+	}
+	for _, f := range p.SubInfo {
+		if f == nil {
+			return fmt.Errorf("%s: nil field", path)
+		}
+		if err := checkParam(f, path+" field"); err != nil {
+			return err
+		}
+	}
+	if p.ElemInfo != nil {
+		elem := *p.ElemInfo
+		if elem.Name == "" {
+			// 数组元素名称可省略
+			elem.Name = "item"
+		}
+		if err := checkParam(&elem, path+" element"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package tool_test
+
+import (
+	"reAct-agent/tool"
+	"strings"
+	"testing"
+)
+
+func TestToolInfoBuilder(t *testing.T) {
+	info, err := tool.NewToolInfo("search", "search documents").
+		AddString("q", "query text", true).
+		AddInteger("limit", "max results", false).
+		AddObject("filter", "optional filters", false,
+			tool.NewParam("lang", tool.String, "language code", false),
+			tool.NewParam("after", tool.Number, "unix time", false)).
+		AddArray("tags", "tags to match", false, tool.NewParam("tag", tool.String, "a tag", false)).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if info.Name != "search" || info.Desc != "search documents" || len(info.Parameters) != 4 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	q := info.Parameters["q"]
+	if q.Name != "q" || q.Type != tool.String || !q.Required {
+		t.Fatalf("unexpected q parameter %+v", q)
+	}
+	if f := info.Parameters["filter"]; f.Type != tool.Object || f.SubInfo["lang"].Type != tool.String || f.SubInfo["after"].Type != tool.Number {
+		t.Fatalf("unexpected filter parameter %+v", f)
+	}
+	if tags := info.Parameters["tags"]; tags.Type != tool.Array || tags.ElemInfo.Type != tool.String {
+		t.Fatalf("unexpected tags parameter %+v", tags)
+	}
+}
+
+func TestToolInfoBuilderValidation(t *testing.T) {
+	cases := map[string]struct {
+		build *tool.ToolInfoBuilder
+		want  string
+	}{
+		"missing tool name": {tool.NewToolInfo("", "desc").AddString("q", "", true), "tool name is required"},
+		"duplicate parameter": {
+			tool.NewToolInfo("t", "").AddString("q", "", true).AddInteger("q", "", false),
+			`duplicate parameter "q"`,
+		},
+		"missing parameter name": {tool.NewToolInfo("t", "").AddString("", "", true), "name is required"},
+		"unknown type":           {tool.NewToolInfo("t", "").Add(&tool.ParameterInfo{Name: "x", Type: tool.DataType(42)}), "unknown type 42"},
+		"duplicate object field": {
+			tool.NewToolInfo("t", "").AddObject("o", "", false, tool.NewParam("a", tool.String, "", false), tool.NewParam("a", tool.Integer, "", false)),
+			`object "o": duplicate field "a"`,
+		},
+		"nested field without name": {
+			tool.NewToolInfo("t", "").AddObject("o", "", false, tool.NewParam("", tool.String, "", false)),
+			`parameter "o" field: name is required`,
+		},
+	}
+	for name, tc := range cases {
+		_, err := tc.build.Build()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: expected error containing %q, got %v", name, tc.want, err)
+		}
+	}
+
+	// 所有错误一并返回
+	_, err := tool.NewToolInfo("", "").AddString("a", "", false).AddString("a", "", false).Build()
+	if err == nil || !strings.Contains(err.Error(), "tool name is required") || !strings.Contains(err.Error(), "duplicate parameter") {
+		t.Fatalf("expected all problems to be reported, got %v", err)
+	}
+}
+
+func TestToolInfoValidate(t *testing.T) {
+	cases := map[string]struct {
+		info tool.ToolInfo
+		want string
+	}{
+		"empty name":    {tool.ToolInfo{}, "tool name is required"},
+		"nil parameter": {tool.ToolInfo{Name: "t", Parameters: map[string]*tool.ParameterInfo{"p": nil}}, `parameter "p" is nil`},
+		"empty parameter name": {tool.ToolInfo{Name: "t", Parameters: map[string]*tool.ParameterInfo{
+			"p": {Type: tool.String},
+		}}, "name is required"},
+		"array without elem": {tool.ToolInfo{Name: "t", Parameters: map[string]*tool.ParameterInfo{
+			"tags": {Name: "tags", Type: tool.Array},
+		}}, `"tags": array requires ElemInfo`},
+		"object without fields": {tool.ToolInfo{Name: "t", Parameters: map[string]*tool.ParameterInfo{
+			"filter": {Name: "filter", Type: tool.Object},
+		}}, `"filter": object requires SubInfo`},
+		"nested array without elem": {tool.ToolInfo{Name: "t", Parameters: map[string]*tool.ParameterInfo{
+			"filter": {Name: "filter", Type: tool.Object, SubInfo: map[string]*tool.ParameterInfo{
+				"ids": {Name: "ids", Type: tool.Array},
+			}},
+		}}, `"ids": array requires ElemInfo`},
+		"unknown type": {tool.ToolInfo{Name: "t", Parameters: map[string]*tool.ParameterInfo{
+			"p": {Name: "p", Type: tool.DataType(42)},
+		}}, "unknown type 42"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.info.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+
+	if err := (&tool.CalculatorTool{}).Info().Validate(); err != nil {
+		t.Fatalf("calculator info should be valid: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package tool
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// ToolCache stores tool results keyed by tool name and arguments. The agent
+// consults it before calling Execute and fills it after a successful call,
+// so identical calls of deterministic or expensive tools run once.
+type ToolCache interface {
+	Get(name string, args map[string]interface{}) (interface{}, bool)
+	Set(name string, args map[string]interface{}, result interface{})
+}
+
+// MemoryCache is an in-memory ToolCache whose entries expire after a TTL. It
+// is safe for concurrent use.
+type MemoryCache struct {
+	ttl     time.Duration
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	result  interface{}
+	expires time.Time
+}
+
+var _ ToolCache = (*MemoryCache)(nil)
+
+// NewMemoryCache creates a MemoryCache keeping entries for ttl. A ttl of zero
+// or less keeps them until the process exits.
+func NewMemoryCache(ttl time.Duration) *MemoryCache {
+	return &MemoryCache{ttl: ttl, now: time.Now, entries: make(map[string]cacheEntry)}
+}
+
+func (c *MemoryCache) Get(name string, args map[string]interface{}) (interface{}, bool) {
+	key, ok := cacheKey(name, args)
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	if !e.expires.IsZero() && !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.result, true
+}
+
+func (c *MemoryCache) Set(name string, args map[string]interface{}, result interface{}) {
+	key, ok := cacheKey(name, args)
+	if !ok {
+		return
+	}
+	e := cacheEntry{result: result}
+	if c.ttl > 0 {
+		e.expires = c.now().Add(c.ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = e
+}
+
+// cacheKey combines the name with the arguments' JSON encoding, which sorts
+// object keys and so is canonical.
+func cacheKey(name string, args map[string]interface{}) (string, bool) {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	return name + "\x00" + string(b), true
+}
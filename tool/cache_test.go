@@ -0,0 +1,33 @@
+package tool_test
+
+import (
+	"reAct-agent/tool"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	c := tool.NewMemoryCache(50 * time.Millisecond)
+	args := map[string]interface{}{"q": "go", "limit": float64(3)}
+	if _, ok := c.Get("search", args); ok {
+		t.Fatal("empty cache should miss")
+	}
+	c.Set("search", args, "result")
+
+	// 参数顺序不同但内容相同，应命中同一条缓存
+	same := map[string]interface{}{"limit": float64(3), "q": "go"}
+	if v, ok := c.Get("search", same); !ok || v != "result" {
+		t.Fatalf("expected hit, got %v, %v", v, ok)
+	}
+	if _, ok := c.Get("other", args); ok {
+		t.Fatal("different tool name should miss")
+	}
+	if _, ok := c.Get("search", map[string]interface{}{"q": "rust"}); ok {
+		t.Fatal("different arguments should miss")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := c.Get("search", args); ok {
+		t.Fatal("expired entry should miss")
+	}
+}
@@ -3,6 +3,10 @@ package tool
 import (
 	"context"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
 var _ Tool = (*CalculatorTool)(nil)
@@ -12,12 +16,12 @@ type CalculatorTool struct{}
 func (c *CalculatorTool) Info() ToolInfo {
 	return ToolInfo{
 		Name: "calculator",
-		Desc: "执行数学计算",
+		Desc: "执行数学计算，支持 + - * / % ^ 与括号，函数 sqrt、abs、pow、min、max、sin、cos、log，常量 pi、e",
 		Parameters: map[string]*ParameterInfo{
 			"expression": {
 				Name:     "expression",
 				Type:     String,
-				Desc:     "数学表达式，如: 2+3*4",
+				Desc:     "数学表达式，如: 2+3*4、sqrt(16)、pow(2,10)",
 				Required: true,
 			},
 		},
@@ -30,21 +34,295 @@ func (c *CalculatorTool) Execute(ctx context.Context, params map[string]interfac
 		return nil, fmt.Errorf("表达式参数错误")
 	}
 
-	result := c.safeEval(expression)
+	result, err := c.safeEval(expression)
+	if err != nil {
+		return nil, err
+	}
 	return map[string]interface{}{
 		"result":     result,
 		"expression": expression,
 	}, nil
 }
 
-func (c *CalculatorTool) safeEval(expr string) float64 {
-	// 简化实现，实际应该使用安全的数学表达式解析器
-	switch expr {
-	case "2+2":
-		return 4
-	case "3*4":
-		return 12
+// safeEval 使用递归下降解析器求值，不执行任何代码
+func (c *CalculatorTool) safeEval(expr string) (float64, error) {
+	p := &exprParser{input: expr}
+	p.next()
+	v, err := p.parseExpr()
+	if err != nil {
+		return 0, err
+	}
+	if p.tok.kind != tokEOF {
+		return 0, fmt.Errorf("表达式错误: 位置 %d 处有多余的 %q", p.tok.pos, p.tok.text)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("计算结果无效: %v", v)
+	}
+	return v, nil
+}
+
+var calcConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// calcFunctions maps function names to their implementation and arity
+// (maxArgs < 0 means variadic).
+var calcFunctions = map[string]struct {
+	minArgs, maxArgs int
+	fn               func(args []float64) (float64, error)
+}{
+	"sqrt": {1, 1, func(a []float64) (float64, error) {
+		if a[0] < 0 {
+			return 0, fmt.Errorf("sqrt 的参数不能为负数")
+		}
+		return math.Sqrt(a[0]), nil
+	}},
+	"abs": {1, 1, func(a []float64) (float64, error) { return math.Abs(a[0]), nil }},
+	"pow": {2, 2, func(a []float64) (float64, error) { return math.Pow(a[0], a[1]), nil }},
+	"min": {1, -1, func(a []float64) (float64, error) {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Min(m, v)
+		}
+		return m, nil
+	}},
+	"max": {1, -1, func(a []float64) (float64, error) {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Max(m, v)
+		}
+		return m, nil
+	}},
+	"sin": {1, 1, func(a []float64) (float64, error) { return math.Sin(a[0]), nil }},
+	"cos": {1, 1, func(a []float64) (float64, error) { return math.Cos(a[0]), nil }},
+	"log": {1, 1, func(a []float64) (float64, error) {
+		if a[0] <= 0 {
+			return 0, fmt.Errorf("log 的参数必须为正数")
+		}
+		return math.Log(a[0]), nil
+	}},
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+// exprParser implements the grammar:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/" | "%") unary }
+//	unary   = ("+" | "-") unary | power
+//	power   = primary [ "^" unary ]
+//	primary = number | ident | ident "(" [ expr { "," expr } ] ")" | "(" expr ")"
+type exprParser struct {
+	input string
+	pos   int
+	tok   token
+	err   error
+}
+
+func (p *exprParser) next() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.input) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+	ch := p.input[p.pos]
+	switch {
+	case ch >= '0' && ch <= '9' || ch == '.':
+		for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		// 科学计数法，如 1e3、2.5E-4
+		if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+			end := p.pos + 1
+			if end < len(p.input) && (p.input[end] == '+' || p.input[end] == '-') {
+				end++
+			}
+			if end < len(p.input) && p.input[end] >= '0' && p.input[end] <= '9' {
+				for end < len(p.input) && p.input[end] >= '0' && p.input[end] <= '9' {
+					end++
+				}
+				p.pos = end
+			}
+		}
+		text := p.input[start:p.pos]
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil && p.err == nil {
+			p.err = fmt.Errorf("表达式错误: 无效的数字 %q", text)
+		}
+		p.tok = token{kind: tokNumber, text: text, num: v, pos: start}
+	case unicode.IsLetter(rune(ch)) || ch == '_':
+		for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos])) || p.input[p.pos] == '_') {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: strings.ToLower(p.input[start:p.pos]), pos: start}
+	default:
+		p.pos++
+		p.tok = token{kind: tokOp, text: string(ch), pos: start}
+	}
+}
+
+func (p *exprParser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *exprParser) parseExpr() (float64, error) {
+	v, err := p.parseTerm()
+	if err != nil {
+		return 0, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		op := p.tok.text
+		p.next()
+		rhs, err := p.parseTerm()
+		if err != nil {
+			return 0, err
+		}
+		if op == "+" {
+			v += rhs
+		} else {
+			v -= rhs
+		}
+	}
+	return v, nil
+}
+
+func (p *exprParser) parseTerm() (float64, error) {
+	v, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("%") {
+		op := p.tok.text
+		p.next()
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "*":
+			v *= rhs
+		case "/":
+			if rhs == 0 {
+				return 0, fmt.Errorf("除数不能为 0")
+			}
+			v /= rhs
+		case "%":
+			if rhs == 0 {
+				return 0, fmt.Errorf("除数不能为 0")
+			}
+			v = math.Mod(v, rhs)
+		}
+	}
+	return v, nil
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	if p.isOp("-") || p.isOp("+") {
+		neg := p.isOp("-")
+		p.next()
+		v, err := p.parseUnary()
+		if neg {
+			v = -v
+		}
+		return v, err
+	}
+	return p.parsePower()
+}
+
+func (p *exprParser) parsePower() (float64, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return 0, err
+	}
+	if p.isOp("^") {
+		p.next()
+		// 右结合：2^3^2 = 2^(3^2)
+		exp, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(base, exp), nil
+	}
+	return base, nil
+}
+
+func (p *exprParser) parsePrimary() (float64, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	tok := p.tok
+	switch tok.kind {
+	case tokNumber:
+		p.next()
+		return tok.num, p.err
+	case tokIdent:
+		p.next()
+		if !p.isOp("(") {
+			if v, ok := calcConstants[tok.text]; ok {
+				return v, nil
+			}
+			return 0, fmt.Errorf("未知常量: %s", tok.text)
+		}
+		fn, ok := calcFunctions[tok.text]
+		if !ok {
+			return 0, fmt.Errorf("未知函数: %s", tok.text)
+		}
+		p.next()
+		var args []float64
+		if !p.isOp(")") {
+			for {
+				v, err := p.parseExpr()
+				if err != nil {
+					return 0, err
+				}
+				args = append(args, v)
+				if !p.isOp(",") {
+					break
+				}
+				p.next()
+			}
+		}
+		if !p.isOp(")") {
+			return 0, fmt.Errorf("表达式错误: 函数 %s 缺少右括号", tok.text)
+		}
+		p.next()
+		if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+			return 0, fmt.Errorf("函数 %s 的参数个数错误: %d", tok.text, len(args))
+		}
+		return fn.fn(args)
+	case tokOp:
+		if tok.text == "(" {
+			p.next()
+			v, err := p.parseExpr()
+			if err != nil {
+				return 0, err
+			}
+			if !p.isOp(")") {
+				return 0, fmt.Errorf("表达式错误: 缺少右括号")
+			}
+			p.next()
+			return v, nil
+		}
+		return 0, fmt.Errorf("表达式错误: 位置 %d 处不应出现 %q", tok.pos, tok.text)
 	default:
-		return 0
+		return 0, fmt.Errorf("表达式错误: 表达式不完整")
 	}
 }
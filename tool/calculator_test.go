@@ -0,0 +1,68 @@
+package tool_test
+
+import (
+	"context"
+	"math"
+	"reAct-agent/tool"
+	"strings"
+	"testing"
+)
+
+func calc(t *testing.T, expr string) (float64, error) {
+	t.Helper()
+	res, err := (&tool.CalculatorTool{}).Execute(context.Background(), map[string]interface{}{"expression": expr})
+	if err != nil {
+		return 0, err
+	}
+	return res.(map[string]interface{})["result"].(float64), nil
+}
+
+func TestCalculatorEvaluates(t *testing.T) {
+	cases := map[string]float64{
+		"2+2":                       4,
+		"3*4":                       12,
+		"2+3*4":                     14,
+		"(2+3)*4":                   20,
+		"-2^2":                      -4,
+		"2^3^2":                     512,
+		"10 % 4":                    2,
+		"1.5e2 / 3":                 50,
+		"sqrt(16)":                  4,
+		"pow(2,10)":                 1024,
+		"abs(-3.5)":                 3.5,
+		"min(3, 1, 2)":              1,
+		"max(3, 1, 2)":              3,
+		"cos(0) + sin(0)":           1,
+		"log(e)":                    1,
+		"2*pi":                      2 * math.Pi,
+		"sqrt(pow(3,2) + pow(4,2))": 5,
+	}
+	for expr, want := range cases {
+		got, err := calc(t, expr)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", expr, err)
+		}
+		if math.Abs(got-want) > 1e-9 {
+			t.Fatalf("%s = %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestCalculatorErrors(t *testing.T) {
+	cases := map[string]string{
+		"foo(1)":   "未知函数: foo",
+		"tau * 2":  "未知常量: tau",
+		"pow(2)":   "参数个数错误",
+		"1 / 0":    "除数不能为 0",
+		"(1 + 2":   "缺少右括号",
+		"1 +":      "表达式不完整",
+		"2 3":      "多余",
+		"sqrt(-1)": "不能为负数",
+	}
+	for expr, want := range cases {
+		_, err := calc(t, expr)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: expected error containing %q, got %v", expr, want, err)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package tool
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// CallIDPrefix is the prefix of every ID produced by NewCallID.
+const CallIDPrefix = "call_"
+
+// NewCallID returns a unique tool-call ID of the form "call_<24 hex chars>".
+// It is used to correlate a tool call with its result when the model did not
+// supply an ID itself, e.g. for text-format calls.
+func NewCallID() string {
+	var b [12]byte
+	// crypto/rand.Read never returns an error on supported platforms
+	_, _ = rand.Read(b[:])
+	return CallIDPrefix + hex.EncodeToString(b[:])
+}
@@ -0,0 +1,22 @@
+package tool_test
+
+import (
+	"reAct-agent/tool"
+	"regexp"
+	"testing"
+)
+
+func TestNewCallIDFormatAndUniqueness(t *testing.T) {
+	format := regexp.MustCompile(`^call_[0-9a-f]{24}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 10000; i++ {
+		id := tool.NewCallID()
+		if !format.MatchString(id) {
+			t.Fatalf("unexpected call ID format: %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate call ID after %d calls: %q", i, id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,258 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+var _ Tool = (*CodeExecTool)(nil)
+
+// CodeRequest is a piece of code handed to a Runner.
+type CodeRequest struct {
+	Language string
+	Code     string
+	// MaxOutputBytes caps stdout and stderr each; runners may stop reading
+	// beyond it. CodeExecTool truncates longer output either way.
+	MaxOutputBytes int
+}
+
+// CodeResult is the outcome of running a CodeRequest.
+type CodeResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Runner executes code in a sandbox. Implementations decide the isolation,
+// e.g. a container, a wasm runtime or a jailed subprocess, and must stop when
+// ctx is done. A non-zero exit code is reported in CodeResult, not as an
+// error; errors mean the code could not be run at all.
+type Runner interface {
+	Run(ctx context.Context, req CodeRequest) (*CodeResult, error)
+}
+
+// CodeExecTool lets the model run code through a Runner and returns stdout,
+// stderr and the exit code. Every run is bounded by a timeout, and output
+// beyond the size cap is truncated.
+//
+// The tool itself isolates nothing: the Runner is the sandbox. Never wire it
+// to a runner that executes untrusted code directly on the host.
+type CodeExecTool struct {
+	runner    Runner
+	languages []string
+	timeout   time.Duration
+	maxOutput int
+}
+
+// CodeExecOption configures a CodeExecTool.
+type CodeExecOption func(*CodeExecTool)
+
+// WithCodeLanguages sets the languages the model may request. The default is
+// python and javascript.
+func WithCodeLanguages(languages ...string) CodeExecOption {
+	return func(t *CodeExecTool) {
+		if len(languages) > 0 {
+			t.languages = append([]string(nil), languages...)
+		}
+	}
+}
+
+// WithCodeTimeout sets the timeout of a single run.
+func WithCodeTimeout(d time.Duration) CodeExecOption {
+	return func(t *CodeExecTool) {
+		if d > 0 {
+			t.timeout = d
+		}
+	}
+}
+
+// WithCodeMaxOutputBytes sets the cap applied to stdout and stderr each.
+func WithCodeMaxOutputBytes(n int) CodeExecOption {
+	return func(t *CodeExecTool) {
+		if n > 0 {
+			t.maxOutput = n
+		}
+	}
+}
+
+// NewCodeExecTool creates a CodeExecTool running code through runner, with a
+// 10s timeout and 64KiB of output per stream unless configured otherwise.
+func NewCodeExecTool(runner Runner, opts ...CodeExecOption) *CodeExecTool {
+	t := &CodeExecTool{
+		runner:    runner,
+		languages: []string{"python", "javascript"},
+		timeout:   10 * time.Second,
+		maxOutput: 64 << 10,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(t)
+		}
+	}
+	return t
+}
+
+func (t *CodeExecTool) Info() ToolInfo {
+	return ToolInfo{
+		Name: "code_exec",
+		Desc: "在沙箱中执行代码，返回标准输出、标准错误与退出码",
+		Parameters: map[string]*ParameterInfo{
+			"language": {
+				Name:     "language",
+				Type:     String,
+				Desc:     "编程语言，可选: " + strings.Join(t.languages, ", "),
+				Required: true,
+			},
+			"code": {
+				Name:     "code",
+				Type:     String,
+				Desc:     "要执行的完整代码，结果需输出到标准输出",
+				Required: true,
+			},
+		},
+	}
+}
+
+func (t *CodeExecTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	if t.runner == nil {
+		return nil, errors.New("未配置沙箱运行器")
+	}
+	language, _ := params["language"].(string)
+	if !t.supports(language) {
+		return nil, fmt.Errorf("不支持的语言 %q，可选: %s", language, strings.Join(t.languages, ", "))
+	}
+	code, ok := params["code"].(string)
+	if !ok || strings.TrimSpace(code) == "" {
+		return nil, fmt.Errorf("code 参数错误")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	res, err := t.runner.Run(ctx, CodeRequest{Language: language, Code: code, MaxOutputBytes: t.maxOutput})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("执行超时（%s）", t.timeout)
+		}
+		return nil, fmt.Errorf("执行失败: %w", err)
+	}
+	stdout, outCut := truncateOutput(res.Stdout, t.maxOutput)
+	stderr, errCut := truncateOutput(res.Stderr, t.maxOutput)
+	return map[string]interface{}{
+		"stdout":    stdout,
+		"stderr":    stderr,
+		"exit_code": res.ExitCode,
+		"truncated": outCut || errCut,
+	}, nil
+}
+
+func (t *CodeExecTool) supports(language string) bool {
+	for _, l := range t.languages {
+		if l == language {
+			return true
+		}
+	}
+	return false
+}
+
+// truncateOutput cuts s to at most n bytes.
+func truncateOutput(s string, n int) (string, bool) {
+	if len(s) <= n {
+		return s, false
+	}
+	return s[:n], true
+}
+
+// SubprocessRunner runs code with a local interpreter, reading the code from
+// stdin.
+//
+// WARNING: this is NOT a sandbox. The code runs with the privileges of the
+// current process and can read files, use the network and start other
+// programs. Only use it for trusted code or inside an environment that is
+// isolated by other means; use a container or wasm Runner otherwise.
+type SubprocessRunner struct {
+	interpreters map[string][]string
+}
+
+var _ Runner = (*SubprocessRunner)(nil)
+
+// NewUnsandboxedSubprocessRunner creates a SubprocessRunner. The name is the
+// opt-in: see the warning on SubprocessRunner. interpreters maps a language
+// to the command line reading a program from stdin; nil uses python3 and
+// node.
+func NewUnsandboxedSubprocessRunner(interpreters map[string][]string) *SubprocessRunner {
+	if interpreters == nil {
+		interpreters = map[string][]string{
+			"python":     {"python3", "-"},
+			"javascript": {"node", "-"},
+		}
+	}
+	return &SubprocessRunner{interpreters: interpreters}
+}
+
+// Languages lists the configured languages, e.g. for WithCodeLanguages.
+func (r *SubprocessRunner) Languages() []string {
+	languages := make([]string, 0, len(r.interpreters))
+	for l := range r.interpreters {
+		languages = append(languages, l)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+func (r *SubprocessRunner) Run(ctx context.Context, req CodeRequest) (*CodeResult, error) {
+	argv, ok := r.interpreters[req.Language]
+	if !ok || len(argv) == 0 {
+		return nil, fmt.Errorf("no interpreter for %q", req.Language)
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdin = strings.NewReader(req.Code)
+	stdout := &cappedBuffer{max: req.MaxOutputBytes}
+	stderr := &cappedBuffer{max: req.MaxOutputBytes}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	// 子进程继承输出管道时，超时后最多再等待一秒
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	res := &CodeResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// cappedBuffer keeps the first max bytes written (all when max <= 0) and
+// discards the rest without failing the writer.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.max > 0 {
+		// 多保留一个字节，便于上层判断是否截断
+		room := b.max + 1 - b.Len()
+		if room <= 0 {
+			return n, nil
+		}
+		if len(p) > room {
+			p = p[:room]
+		}
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
@@ -0,0 +1,97 @@
+package tool_test
+
+import (
+	"context"
+	"os/exec"
+	"reAct-agent/tool"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockRunner records requests and replays a fixed result, or blocks until the
+// context ends when block is set.
+type mockRunner struct {
+	result   *tool.CodeResult
+	block    bool
+	requests []tool.CodeRequest
+}
+
+func (m *mockRunner) Run(ctx context.Context, req tool.CodeRequest) (*tool.CodeResult, error) {
+	m.requests = append(m.requests, req)
+	if m.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return m.result, nil
+}
+
+func TestCodeExecToolRunsThroughRunner(t *testing.T) {
+	runner := &mockRunner{result: &tool.CodeResult{Stdout: "4\n", Stderr: "warning", ExitCode: 1}}
+	codeTool := tool.NewCodeExecTool(runner)
+	res, err := codeTool.Execute(context.Background(), map[string]interface{}{"language": "python", "code": "print(2+2)"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	out := res.(map[string]interface{})
+	if out["stdout"] != "4\n" || out["stderr"] != "warning" || out["exit_code"] != 1 || out["truncated"] != false {
+		t.Fatalf("unexpected result %v", out)
+	}
+	if len(runner.requests) != 1 || runner.requests[0].Code != "print(2+2)" || runner.requests[0].MaxOutputBytes != 64<<10 {
+		t.Fatalf("unexpected request %+v", runner.requests)
+	}
+}
+
+func TestCodeExecToolRejectsUnsupportedLanguage(t *testing.T) {
+	runner := &mockRunner{result: &tool.CodeResult{}}
+	codeTool := tool.NewCodeExecTool(runner, tool.WithCodeLanguages("python"))
+	_, err := codeTool.Execute(context.Background(), map[string]interface{}{"language": "javascript", "code": "1"})
+	if err == nil || !strings.Contains(err.Error(), "不支持的语言") || len(runner.requests) != 0 {
+		t.Fatalf("expected unsupported language error before running, got %v", err)
+	}
+	if _, err := tool.NewCodeExecTool(nil).Execute(context.Background(), map[string]interface{}{"language": "python", "code": "1"}); err == nil {
+		t.Fatal("expected an error without a runner")
+	}
+}
+
+func TestCodeExecToolTruncatesOutput(t *testing.T) {
+	runner := &mockRunner{result: &tool.CodeResult{Stdout: strings.Repeat("x", 20)}}
+	codeTool := tool.NewCodeExecTool(runner, tool.WithCodeMaxOutputBytes(8))
+	res, err := codeTool.Execute(context.Background(), map[string]interface{}{"language": "python", "code": "spam()"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	out := res.(map[string]interface{})
+	if out["stdout"] != "xxxxxxxx" || out["truncated"] != true {
+		t.Fatalf("output not truncated: %v", out)
+	}
+}
+
+func TestCodeExecToolTimeout(t *testing.T) {
+	codeTool := tool.NewCodeExecTool(&mockRunner{block: true}, tool.WithCodeTimeout(20*time.Millisecond))
+	_, err := codeTool.Execute(context.Background(), map[string]interface{}{"language": "python", "code": "while True: pass"})
+	if err == nil || !strings.Contains(err.Error(), "执行超时") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+func TestUnsandboxedSubprocessRunner(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	runner := tool.NewUnsandboxedSubprocessRunner(map[string][]string{"sh": {"sh", "-s"}})
+	codeTool := tool.NewCodeExecTool(runner, tool.WithCodeLanguages(runner.Languages()...), tool.WithCodeMaxOutputBytes(5))
+	res, err := codeTool.Execute(context.Background(), map[string]interface{}{"language": "sh", "code": "echo hello world; echo oops >&2; exit 3"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	out := res.(map[string]interface{})
+	if out["stdout"] != "hello" || out["stderr"] != "oops\n" || out["exit_code"] != 3 || out["truncated"] != true {
+		t.Fatalf("unexpected result %v", out)
+	}
+
+	codeTool = tool.NewCodeExecTool(runner, tool.WithCodeLanguages("sh"), tool.WithCodeTimeout(50*time.Millisecond))
+	if _, err := codeTool.Execute(context.Background(), map[string]interface{}{"language": "sh", "code": "sleep 5"}); err == nil || !strings.Contains(err.Error(), "执行超时") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
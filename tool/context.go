@@ -0,0 +1,33 @@
+package tool
+
+import "context"
+
+type runIDKey struct{}
+
+// WithRunID returns a context carrying the ID of the agent run. The agent
+// sets it before calling Execute.
+func WithRunID(ctx context.Context, runID string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, runID)
+}
+
+// RunIDFromContext returns the run ID carried by ctx, or "". Tools can use it
+// to tag logs or downstream requests with the run that triggered them.
+func RunIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+type dependencyKey[T any] struct{}
+
+// WithDependency returns a context carrying v, retrievable by its type with
+// Dependency. Together with ReactAgentConfig.ToolContext it hands shared
+// dependencies such as a DB handle or tenant settings to every tool.
+func WithDependency[T any](ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, dependencyKey[T]{}, v)
+}
+
+// Dependency returns the value of type T carried by ctx, if any.
+func Dependency[T any](ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(dependencyKey[T]{}).(T)
+	return v, ok
+}
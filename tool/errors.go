@@ -0,0 +1,32 @@
+package tool
+
+import "errors"
+
+// FatalError marks a tool error that should end the agent run instead of
+// being fed back to the model as an observation, e.g. rejected credentials
+// or a denied permission that no retry can fix. Wrap errors with Fatal.
+type FatalError struct {
+	Err error
+}
+
+func (e *FatalError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FatalError) Unwrap() error {
+	return e.Err
+}
+
+// Fatal wraps err in a *FatalError; a nil err stays nil.
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &FatalError{Err: err}
+}
+
+// IsFatal reports whether err, or an error it wraps, is a *FatalError.
+func IsFatal(err error) bool {
+	var fatal *FatalError
+	return errors.As(err, &fatal)
+}
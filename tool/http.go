@@ -0,0 +1,115 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	httpclient "reAct-agent/http_client"
+)
+
+var _ Tool = (*HTTPTool)(nil)
+
+// HTTPTool exposes an HTTP endpoint as a tool. The call arguments are sent
+// as the JSON request body (GET requests send none) and the result reports
+// the status code and the response body.
+//
+// By default the whole response is read with Send. Streaming endpoints (SSE,
+// chunked transfer, long polling) can use WithHTTPStreaming instead, which
+// reads the body with SendStream and aggregates the chunks.
+type HTTPTool struct {
+	info    ToolInfo
+	client  httpclient.IHTTPClient
+	method  httpclient.HTTPMethod
+	stream  bool
+	onChunk func(ctx context.Context, chunk []byte)
+}
+
+// HTTPToolOption configures an HTTPTool.
+type HTTPToolOption func(*HTTPTool)
+
+// WithHTTPMethod sets the request method. The default is POST.
+func WithHTTPMethod(method httpclient.HTTPMethod) HTTPToolOption {
+	return func(t *HTTPTool) {
+		t.method = method
+	}
+}
+
+// WithHTTPStreaming reads the response with SendStream. onChunk, when not
+// nil, receives every chunk as it arrives, e.g. to forward partial output;
+// the result still contains the aggregated body.
+func WithHTTPStreaming(onChunk func(ctx context.Context, chunk []byte)) HTTPToolOption {
+	return func(t *HTTPTool) {
+		t.stream = true
+		t.onChunk = onChunk
+	}
+}
+
+// NewHTTPTool creates an HTTPTool described by info that sends requests
+// through client.
+func NewHTTPTool(info ToolInfo, client httpclient.IHTTPClient, opts ...HTTPToolOption) *HTTPTool {
+	t := &HTTPTool{info: info, client: client, method: httpclient.HTTPMethodPOST}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(t)
+		}
+	}
+	return t
+}
+
+func (t *HTTPTool) Info() ToolInfo {
+	return t.info
+}
+
+func (t *HTTPTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	var body interface{}
+	if t.method != httpclient.HTTPMethodGET {
+		body = params
+	}
+
+	var (
+		status int
+		data   []byte
+		err    error
+	)
+	if t.stream {
+		status, data, err = t.readStream(ctx, body)
+	} else {
+		var resp *httpclient.HTTPResponse
+		resp, err = t.client.Send(ctx, t.method, body)
+		if resp != nil {
+			status, data = resp.StatusCode, resp.Body
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	if status != 0 && (status < 200 || status > 299) {
+		return nil, fmt.Errorf("请求失败，状态码 %d: %s", status, data)
+	}
+	return map[string]interface{}{
+		"status_code": status,
+		"body":        string(data),
+	}, nil
+}
+
+// readStream 聚合流式响应的所有数据块
+func (t *HTTPTool) readStream(ctx context.Context, body interface{}) (int, []byte, error) {
+	chunks, errs := t.client.SendStream(ctx, t.method, body)
+	var (
+		buf    bytes.Buffer
+		status int
+	)
+	for chunk := range chunks {
+		if status == 0 {
+			status = chunk.StatusCode
+		}
+		buf.Write(chunk.Body)
+		if t.onChunk != nil {
+			t.onChunk(ctx, chunk.Body)
+		}
+	}
+	if err := <-errs; err != nil {
+		return status, buf.Bytes(), err
+	}
+	return status, buf.Bytes(), nil
+}
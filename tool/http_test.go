@@ -0,0 +1,80 @@
+package tool_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	httpclient "reAct-agent/http_client"
+	"reAct-agent/tool"
+	"strings"
+	"testing"
+)
+
+var echoInfo = tool.ToolInfo{Name: "echo", Desc: "回显请求", Parameters: map[string]*tool.ParameterInfo{
+	"text": {Name: "text", Type: tool.String, Desc: "内容", Required: true},
+}}
+
+func TestHTTPToolSend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Write([]byte("echo: " + req["text"].(string)))
+	}))
+	defer srv.Close()
+
+	ht := tool.NewHTTPTool(echoInfo, httpclient.NewHTTPClient(srv.URL, ""))
+	out, err := ht.Execute(context.Background(), map[string]interface{}{"text": "hi"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	res := out.(map[string]interface{})
+	if res["status_code"] != 200 || res["body"] != "echo: hi" {
+		t.Fatalf("unexpected result %v", res)
+	}
+}
+
+func TestHTTPToolStreamAggregatesChunks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 未设置 Content-Length，逐块 Flush 触发 chunked 传输
+		for _, part := range []string{"alpha ", "beta ", "gamma"} {
+			w.Write([]byte(part))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	var chunks []string
+	ht := tool.NewHTTPTool(echoInfo, httpclient.NewHTTPClient(srv.URL, ""),
+		tool.WithHTTPStreaming(func(ctx context.Context, chunk []byte) {
+			chunks = append(chunks, string(chunk))
+		}))
+	out, err := ht.Execute(context.Background(), map[string]interface{}{"text": "hi"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	res := out.(map[string]interface{})
+	if res["status_code"] != 200 || res["body"] != "alpha beta gamma" {
+		t.Fatalf("chunks not aggregated: %v", res)
+	}
+	if len(chunks) == 0 || strings.Join(chunks, "") != "alpha beta gamma" {
+		t.Fatalf("chunks not forwarded: %q", chunks)
+	}
+}
+
+func TestHTTPToolReportsErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	for name, opts := range map[string][]tool.HTTPToolOption{
+		"send":   nil,
+		"stream": {tool.WithHTTPStreaming(nil)},
+	} {
+		ht := tool.NewHTTPTool(echoInfo, httpclient.NewHTTPClient(srv.URL, ""), opts...)
+		if _, err := ht.Execute(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "502") {
+			t.Fatalf("%s: expected status error, got %v", name, err)
+		}
+	}
+}
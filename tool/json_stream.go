@@ -0,0 +1,89 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StreamingTool is a Tool whose result is a potentially huge JSON array. The
+// agent calls ExecuteStream instead of Execute and decodes the array one
+// element at a time, so the whole document is never held in memory; the
+// observation keeps as many elements as fit its size limit.
+type StreamingTool interface {
+	Tool
+	ExecuteStream(ctx context.Context, params map[string]interface{}) (io.ReadCloser, error)
+}
+
+// DecodeJSONArray reads a JSON array from r with json.Decoder.Token and sends
+// each element as soon as it is decoded. The element channel is closed at the
+// end of the array; the error channel then yields nil, or the decoding or
+// context error that stopped it early.
+func DecodeJSONArray(ctx context.Context, r io.Reader) (<-chan json.RawMessage, <-chan error) {
+	elems := make(chan json.RawMessage)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(elems)
+		dec := json.NewDecoder(r)
+		tok, err := dec.Token()
+		if err != nil {
+			errs <- fmt.Errorf("failed to decode array: %w", err)
+			return
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			errs <- fmt.Errorf("failed to decode array: expected '[', got %v", tok)
+			return
+		}
+		for dec.More() {
+			var elem json.RawMessage
+			if err := dec.Decode(&elem); err != nil {
+				errs <- fmt.Errorf("failed to decode array element: %w", err)
+				return
+			}
+			select {
+			case elems <- elem:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			errs <- fmt.Errorf("failed to decode array: %w", err)
+		}
+	}()
+	return elems, errs
+}
+
+// ObservationDeltas turns streamed elements into fragments of a JSON array
+// observation: "[", then each element prefixed by a comma after the first,
+// then "]". Once the fragments would exceed maxBytes (when positive) it stops
+// and ends the array early, so the joined fragments always form valid JSON.
+// After the fragment channel closes, the second channel tells whether
+// elements were dropped; the caller should then cancel the producer.
+func ObservationDeltas(elems <-chan json.RawMessage, maxBytes int) (<-chan string, <-chan bool) {
+	out := make(chan string)
+	truncated := make(chan bool, 1)
+	go func() {
+		defer close(truncated)
+		defer close(out)
+		out <- "["
+		size, n := 2, 0
+		for elem := range elems {
+			delta := string(elem)
+			if n > 0 {
+				delta = "," + delta
+			}
+			if maxBytes > 0 && size+len(delta) > maxBytes {
+				truncated <- true
+				break
+			}
+			size += len(delta)
+			n++
+			out <- delta
+		}
+		out <- "]"
+	}()
+	return out, truncated
+}
@@ -0,0 +1,86 @@
+package tool_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reAct-agent/tool"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONArrayIsIncremental(t *testing.T) {
+	const n = 20000
+	pr, pw := io.Pipe()
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		pw.Write([]byte("["))
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				pw.Write([]byte(","))
+			}
+			fmt.Fprintf(pw, `{"id":%d,"name":"item-%d"}`, i, i)
+		}
+		pw.Write([]byte("]"))
+		pw.Close()
+	}()
+
+	elems, errs := tool.DecodeJSONArray(context.Background(), pr)
+	count := 0
+	for elem := range elems {
+		if count == 0 {
+			// 第一个元素到达时写入方远未结束
+			select {
+			case <-written:
+				t.Fatal("first element arrived only after the whole array was written")
+			default:
+			}
+		}
+		var item struct{ ID int }
+		if err := json.Unmarshal(elem, &item); err != nil || item.ID != count {
+			t.Fatalf("element %d decoded as %s (%v)", count, elem, err)
+		}
+		count++
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("DecodeJSONArray failed: %v", err)
+	}
+	if count != n {
+		t.Fatalf("expected %d elements, got %d", n, count)
+	}
+}
+
+func TestDecodeJSONArrayRejectsNonArray(t *testing.T) {
+	elems, errs := tool.DecodeJSONArray(context.Background(), strings.NewReader(`{"a":1}`))
+	for range elems {
+	}
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "expected '['") {
+		t.Fatalf("expected a non-array error, got %v", err)
+	}
+}
+
+func TestObservationDeltas(t *testing.T) {
+	collect := func(input string, maxBytes int) (string, bool) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		elems, _ := tool.DecodeJSONArray(ctx, strings.NewReader(input))
+		deltas, truncated := tool.ObservationDeltas(elems, maxBytes)
+		var b strings.Builder
+		for d := range deltas {
+			b.WriteString(d)
+		}
+		return b.String(), <-truncated
+	}
+	if got, cut := collect(`[1, 2, {"a": 3}]`, 0); got != `[1,2,{"a": 3}]` || cut {
+		t.Fatalf("unexpected observation %s (truncated %v)", got, cut)
+	}
+	got, cut := collect(`[100, 200, 300, 400]`, 10)
+	if got != `[100,200]` || !cut {
+		t.Fatalf("unexpected truncated observation %s (truncated %v)", got, cut)
+	}
+	if !json.Valid([]byte(got)) {
+		t.Fatalf("truncated observation is not valid JSON: %s", got)
+	}
+}
@@ -0,0 +1,12 @@
+package tool
+
+import "reAct-agent/schema"
+
+// Result lets Execute contribute more than one observation. Returning a
+// *Result instead of a plain value makes the agent use Content as the tool
+// observation and then append ExtraMessages to the history, in order, e.g. a
+// system hint asking the model to focus on part of the data.
+type Result struct {
+	Content       interface{}
+	ExtraMessages []*schema.Message
+}
@@ -0,0 +1,91 @@
+package tool
+
+import "sort"
+
+// jsonSchemaTypes maps a DataType to its JSON Schema type name.
+var jsonSchemaTypes = [...]string{
+	Integer: "integer",
+	String:  "string",
+	Number:  "number",
+	Boolean: "boolean",
+	Object:  "object",
+	Array:   "array",
+}
+
+// JSONSchema renders the parameters as the JSON Schema object expected in the
+// "parameters" of a function definition.
+//
+// With Strict set it follows the strict-mode rules: every object lists all
+// its properties as required and forbids additional ones, and optional
+// parameters accept null instead of being omitted.
+func (ti ToolInfo) JSONSchema() map[string]interface{} {
+	return objectSchema("", ti.Parameters, ti.Strict)
+}
+
+// ReturnJSONSchema renders ReturnSchema as JSON Schema, or nil when the tool
+// declares no return shape.
+func (ti ToolInfo) ReturnJSONSchema() map[string]interface{} {
+	if ti.ReturnSchema == nil {
+		return nil
+	}
+	return paramSchema(ti.ReturnSchema, false)
+}
+
+func objectSchema(desc string, fields map[string]*ParameterInfo, strict bool) map[string]interface{} {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	properties := make(map[string]interface{}, len(fields))
+	required := make([]string, 0, len(fields))
+	for _, name := range names {
+		p := fields[name]
+		properties[name] = paramSchema(p, strict)
+		if p.Required || strict {
+			required = append(required, name)
+		}
+	}
+	s := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+	if desc != "" {
+		s["description"] = desc
+	}
+	if strict {
+		s["additionalProperties"] = false
+	}
+	return s
+}
+
+func paramSchema(p *ParameterInfo, strict bool) map[string]interface{} {
+	var s map[string]interface{}
+	switch p.Type {
+	case Object:
+		s = objectSchema(p.Desc, p.SubInfo, strict)
+	case Array:
+		s = map[string]interface{}{"type": "array"}
+		if p.ElemInfo != nil {
+			elem := *p.ElemInfo
+			// 数组元素本身总是必填
+			elem.Required = true
+			s["items"] = paramSchema(&elem, strict)
+		}
+		if p.Desc != "" {
+			s["description"] = p.Desc
+		}
+	default:
+		s = map[string]interface{}{"type": jsonSchemaTypes[p.Type]}
+		if p.Desc != "" {
+			s["description"] = p.Desc
+		}
+	}
+	// 严格模式下可选参数以 null 表示未提供
+	if strict && !p.Required {
+		s["type"] = []string{s["type"].(string), "null"}
+	}
+	return s
+}
@@ -0,0 +1,53 @@
+package tool_test
+
+import (
+	"encoding/json"
+	"reAct-agent/tool"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	build := func(strict bool) tool.ToolInfo {
+		info, err := tool.NewToolInfo("search", "search documents").
+			AddString("q", "query text", true).
+			AddInteger("limit", "max hits", false).
+			AddArray("tags", "tag filter", false, tool.NewParam("", tool.String, "tag", false)).
+			Strict(strict).
+			Build()
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		return info
+	}
+	render := func(info tool.ToolInfo) string {
+		b, err := json.Marshal(info.JSONSchema())
+		if err != nil {
+			t.Fatalf("marshal schema: %v", err)
+		}
+		return string(b)
+	}
+
+	want := `{"properties":{"limit":{"description":"max hits","type":"integer"},"q":{"description":"query text","type":"string"},"tags":{"description":"tag filter","items":{"description":"tag","type":"string"},"type":"array"}},"required":["q"],"type":"object"}`
+	if got := render(build(false)); got != want {
+		t.Fatalf("unexpected schema:\ngot  %s\nwant %s", got, want)
+	}
+
+	info, err := tool.NewToolInfo("search", "search documents").
+		Returns(&tool.ParameterInfo{Name: "hits", Type: tool.Array, Desc: "matching documents", ElemInfo: tool.NewParam("", tool.String, "document id", true)}).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	b, _ := json.Marshal(info.ReturnJSONSchema())
+	if want := `{"description":"matching documents","items":{"description":"document id","type":"string"},"type":"array"}`; string(b) != want {
+		t.Fatalf("unexpected return schema:\ngot  %s\nwant %s", b, want)
+	}
+	if build(false).ReturnJSONSchema() != nil {
+		t.Fatal("tools without ReturnSchema should have no return schema")
+	}
+
+	want = `{"additionalProperties":false,"properties":{"limit":{"description":"max hits","type":["integer","null"]},"q":{"description":"query text","type":"string"},"tags":{"description":"tag filter","items":{"description":"tag","type":"string"},"type":["array","null"]}},"required":["limit","q","tags"],"type":"object"}`
+	if got := render(build(true)); got != want {
+		t.Fatalf("unexpected strict schema:\ngot  %s\nwant %s", got, want)
+	}
+}
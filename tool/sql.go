@@ -0,0 +1,235 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var _ Tool = (*SQLTool)(nil)
+
+// SQLTool runs parameterized queries against a database. Values are always
+// bound through driver placeholders, never interpolated into the query text.
+//
+// By default the tool is read-only: only single SELECT or WITH queries are
+// accepted, and they run in a read-only transaction that is rolled back
+// afterwards, so the database refuses writes such as SELECT ... INTO or
+// side-effecting functions. The driver must support read-only transactions.
+// Queries return {"rows": [...], "truncated": bool}; rows are capped at
+// MaxRows and truncated reports that more were available. Every query runs
+// under Timeout.
+type SQLTool struct {
+	db       *sql.DB
+	readOnly bool
+	allowed  map[string]bool
+	maxRows  int
+	timeout  time.Duration
+}
+
+// SQLOption configures a SQLTool.
+type SQLOption func(*SQLTool)
+
+// WithSQLReadOnly toggles read-only mode. When disabled, statements other
+// than SELECT are executed and report the number of affected rows.
+func WithSQLReadOnly(readOnly bool) SQLOption {
+	return func(t *SQLTool) {
+		t.readOnly = readOnly
+	}
+}
+
+// WithSQLAllowedStatements restricts the statement kinds (leading keyword,
+// e.g. "SELECT", "INSERT") the tool accepts. Read-only mode still applies.
+func WithSQLAllowedStatements(statements ...string) SQLOption {
+	return func(t *SQLTool) {
+		t.allowed = make(map[string]bool, len(statements))
+		for _, s := range statements {
+			t.allowed[strings.ToUpper(strings.TrimSpace(s))] = true
+		}
+	}
+}
+
+// WithSQLMaxRows sets the maximum number of rows returned by a query.
+func WithSQLMaxRows(n int) SQLOption {
+	return func(t *SQLTool) {
+		if n > 0 {
+			t.maxRows = n
+		}
+	}
+}
+
+// WithSQLTimeout sets the per-query timeout.
+func WithSQLTimeout(d time.Duration) SQLOption {
+	return func(t *SQLTool) {
+		if d > 0 {
+			t.timeout = d
+		}
+	}
+}
+
+// NewSQLTool creates a read-only SQLTool returning at most 100 rows with a
+// 10s query timeout unless configured otherwise.
+func NewSQLTool(db *sql.DB, opts ...SQLOption) *SQLTool {
+	t := &SQLTool{
+		db:       db,
+		readOnly: true,
+		maxRows:  100,
+		timeout:  10 * time.Second,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(t)
+		}
+	}
+	return t
+}
+
+func (t *SQLTool) Info() ToolInfo {
+	desc := "执行 SQL 查询，参数通过 ? 占位符绑定"
+	if t.readOnly {
+		desc = "执行只读 SQL 查询（仅支持 SELECT 与 WITH），参数通过 ? 占位符绑定"
+	}
+	return ToolInfo{
+		Name: "sql_query",
+		Desc: desc,
+		Parameters: map[string]*ParameterInfo{
+			"query": {
+				Name:     "query",
+				Type:     String,
+				Desc:     "SQL 语句，如: SELECT name FROM users WHERE id = ?",
+				Required: true,
+			},
+			// 元素不限类型，字符串、数字与布尔值均可绑定
+			"args": {
+				Name: "args",
+				Type: Array,
+				Desc: "按顺序绑定到 ? 占位符的参数值（字符串、数字或布尔值）",
+			},
+		},
+	}
+}
+
+func (t *SQLTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	query, ok := params["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("query 参数错误")
+	}
+	var args []interface{}
+	if raw, ok := params["args"]; ok && raw != nil {
+		list, ok := raw.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("args 参数必须是数组")
+		}
+		args = list
+	}
+
+	stmt, err := t.checkStatement(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	if !isQuery(stmt) {
+		res, err := t.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("执行失败: %w", err)
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("执行失败: %w", err)
+		}
+		return map[string]interface{}{"rows_affected": affected}, nil
+	}
+
+	if !t.readOnly {
+		rows, err := t.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("查询失败: %w", err)
+		}
+		defer rows.Close()
+		return t.scanRows(rows)
+	}
+
+	// 只读模式下在只读事务中查询并回滚，由数据库拒绝查询中的写操作
+	tx, err := t.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("查询失败: %w", err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询失败: %w", err)
+	}
+	defer rows.Close()
+	return t.scanRows(rows)
+}
+
+// isQuery reports whether stmt, a leading keyword, starts a query returning
+// rows.
+func isQuery(stmt string) bool {
+	return stmt == "SELECT" || stmt == "WITH"
+}
+
+// checkStatement returns the leading keyword of a single statement query and
+// rejects it if it is not allowed.
+func (t *SQLTool) checkStatement(query string) (string, error) {
+	trimmed := strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+	// 禁止一次提交多条语句
+	if strings.Contains(trimmed, ";") {
+		return "", fmt.Errorf("不支持多条语句")
+	}
+	fields := strings.Fields(trimmed)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("query 参数错误")
+	}
+	stmt := strings.ToUpper(fields[0])
+	if t.readOnly && !isQuery(stmt) {
+		return "", fmt.Errorf("只读模式下不允许执行 %s 语句", stmt)
+	}
+	if t.allowed != nil && !t.allowed[stmt] {
+		return "", fmt.Errorf("不允许执行 %s 语句", stmt)
+	}
+	return stmt, nil
+}
+
+// scanRows converts up to maxRows rows into column-name keyed maps and
+// reports whether rows were left unread.
+func (t *SQLTool) scanRows(rows *sql.Rows) (map[string]interface{}, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("查询失败: %w", err)
+	}
+	out := make([]map[string]interface{}, 0)
+	truncated := false
+	for rows.Next() {
+		if len(out) == t.maxRows {
+			truncated = true
+			break
+		}
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("读取结果失败: %w", err)
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			// []byte 转为字符串，便于序列化给模型
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		out = append(out, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("读取结果失败: %w", err)
+	}
+	return map[string]interface{}{"rows": out, "truncated": truncated}, nil
+}
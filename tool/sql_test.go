@@ -0,0 +1,232 @@
+package tool_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reAct-agent/tool"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubDriver is a minimal database/sql driver serving a fixed table and
+// recording the queries and bound arguments it receives.
+type stubDriver struct {
+	mu        sync.Mutex
+	queries   []string
+	args      [][]driver.NamedValue
+	rows      [][]driver.Value
+	txs       []driver.TxOptions
+	rollbacks int
+}
+
+func (d *stubDriver) Open(name string) (driver.Conn, error) { return &stubConn{d: d}, nil }
+
+func (d *stubDriver) record(query string, args []driver.NamedValue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queries = append(d.queries, query)
+	d.args = append(d.args, args)
+}
+
+type stubConn struct{ d *stubDriver }
+
+func (c *stubConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+func (c *stubConn) Close() error              { return nil }
+func (c *stubConn) Begin() (driver.Tx, error) { return nil, errors.New("use BeginTx") }
+
+func (c *stubConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.txs = append(c.d.txs, opts)
+	return stubTx{c.d}, nil
+}
+
+type stubTx struct{ d *stubDriver }
+
+func (tx stubTx) Commit() error { return nil }
+func (tx stubTx) Rollback() error {
+	tx.d.mu.Lock()
+	defer tx.d.mu.Unlock()
+	tx.d.rollbacks++
+	return nil
+}
+
+func (c *stubConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.record(query, args)
+	if strings.Contains(query, "slow") {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &stubRows{rows: c.d.rows}, nil
+}
+
+func (c *stubConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.record(query, args)
+	return driver.RowsAffected(3), nil
+}
+
+type stubRows struct {
+	rows [][]driver.Value
+	pos  int
+}
+
+func (r *stubRows) Columns() []string { return []string{"id", "name"} }
+func (r *stubRows) Close() error      { return nil }
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+var registerOnce sync.Once
+var stub = &stubDriver{}
+
+func openStubDB(t *testing.T, rows [][]driver.Value) (*sql.DB, *stubDriver) {
+	t.Helper()
+	registerOnce.Do(func() { sql.Register("tool-stub", stub) })
+	stub.mu.Lock()
+	stub.queries, stub.args, stub.rows, stub.txs, stub.rollbacks = nil, nil, rows, nil, 0
+	stub.mu.Unlock()
+	db, err := sql.Open("tool-stub", "")
+	if err != nil {
+		t.Fatalf("open stub db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, stub
+}
+
+func TestSQLToolBindsArgsAndReturnsRows(t *testing.T) {
+	db, d := openStubDB(t, [][]driver.Value{{int64(1), []byte("alice")}, {int64(2), "bob"}})
+	st := tool.NewSQLTool(db)
+
+	res, err := st.Execute(context.Background(), map[string]interface{}{
+		"query": "SELECT id, name FROM users WHERE name = ?",
+		"args":  []interface{}{"alice'; DROP TABLE users; --"},
+	})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	result := res.(map[string]interface{})
+	rows := result["rows"].([]map[string]interface{})
+	if result["truncated"] != false || len(rows) != 2 || rows[0]["name"] != "alice" || rows[1]["id"] != int64(2) {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	// 参数必须通过绑定传递，而非拼接进 SQL
+	if d.queries[0] != "SELECT id, name FROM users WHERE name = ?" {
+		t.Fatalf("query was rewritten: %q", d.queries[0])
+	}
+	if len(d.args[0]) != 1 || d.args[0][0].Value != "alice'; DROP TABLE users; --" {
+		t.Fatalf("args not bound: %v", d.args[0])
+	}
+}
+
+func TestSQLToolReadOnlyQueriesRunInReadOnlyTx(t *testing.T) {
+	db, d := openStubDB(t, [][]driver.Value{{int64(1), "alice"}})
+	st := tool.NewSQLTool(db)
+
+	for _, q := range []string{"SELECT id, name FROM users", "WITH u AS (SELECT id, name FROM users) SELECT * FROM u"} {
+		if _, err := st.Execute(context.Background(), map[string]interface{}{"query": q}); err != nil {
+			t.Fatalf("Execute(%q) failed: %v", q, err)
+		}
+	}
+	if len(d.txs) != 2 || !d.txs[0].ReadOnly || !d.txs[1].ReadOnly {
+		t.Fatalf("queries should run in read-only transactions, got %+v", d.txs)
+	}
+	if d.rollbacks != 2 {
+		t.Fatalf("read-only transactions should be rolled back, got %d rollbacks", d.rollbacks)
+	}
+}
+
+func TestSQLToolEnforcesRowCap(t *testing.T) {
+	var data [][]driver.Value
+	for i := 0; i < 10; i++ {
+		data = append(data, []driver.Value{int64(i), "n"})
+	}
+	db, _ := openStubDB(t, data)
+	st := tool.NewSQLTool(db, tool.WithSQLMaxRows(3))
+
+	res, err := st.Execute(context.Background(), map[string]interface{}{"query": "SELECT id, name FROM users"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	result := res.(map[string]interface{})
+	if rows := result["rows"].([]map[string]interface{}); len(rows) != 3 || result["truncated"] != true {
+		t.Fatalf("expected 3 rows marked truncated, got %v", result)
+	}
+}
+
+func TestSQLToolAcceptsScalarArgs(t *testing.T) {
+	db, d := openStubDB(t, nil)
+	st := tool.NewSQLTool(db)
+
+	args := map[string]interface{}{
+		"query": "SELECT id, name FROM users WHERE id = ? AND active = ? AND name = ?",
+		"args":  []interface{}{float64(42), true, "alice"},
+	}
+	if err := tool.ValidateArgs(st.Info(), args); err != nil {
+		t.Fatalf("numeric and boolean args should validate, got %v", err)
+	}
+	if _, err := st.Execute(context.Background(), args); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(d.args[0]) != 3 || d.args[0][0].Value != float64(42) || d.args[0][1].Value != true {
+		t.Fatalf("args not bound: %v", d.args[0])
+	}
+}
+
+func TestSQLToolReadOnlyRejectsWrites(t *testing.T) {
+	db, d := openStubDB(t, nil)
+	st := tool.NewSQLTool(db)
+
+	for _, q := range []string{"DELETE FROM users", "  update users set name = 'x'", "SELECT 1; DROP TABLE users"} {
+		if _, err := st.Execute(context.Background(), map[string]interface{}{"query": q}); err == nil {
+			t.Fatalf("expected %q to be rejected", q)
+		}
+	}
+	if len(d.queries) != 0 {
+		t.Fatalf("rejected statements reached the database: %v", d.queries)
+	}
+}
+
+func TestSQLToolAllowlistInWriteMode(t *testing.T) {
+	db, _ := openStubDB(t, nil)
+	st := tool.NewSQLTool(db, tool.WithSQLReadOnly(false), tool.WithSQLAllowedStatements("select", "insert"))
+
+	res, err := st.Execute(context.Background(), map[string]interface{}{
+		"query": "INSERT INTO users(name) VALUES (?)",
+		"args":  []interface{}{"carol"},
+	})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if res.(map[string]interface{})["rows_affected"] != int64(3) {
+		t.Fatalf("unexpected result %v", res)
+	}
+	if _, err := st.Execute(context.Background(), map[string]interface{}{"query": "DELETE FROM users"}); err == nil {
+		t.Fatal("expected DELETE outside the allowlist to be rejected")
+	}
+}
+
+func TestSQLToolTimeout(t *testing.T) {
+	db, _ := openStubDB(t, nil)
+	st := tool.NewSQLTool(db, tool.WithSQLTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	_, err := st.Execute(context.Background(), map[string]interface{}{"query": "SELECT slow FROM t"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("query timeout not enforced")
+	}
+}
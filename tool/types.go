@@ -1,6 +1,10 @@
 package tool
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
 // DataType represents the parameter data type.
 // Aligns with UML enum: Integer, String, Number, Boolean, Object, Array.
@@ -34,9 +38,49 @@ type ToolInfo struct {
 	Name       string
 	Desc       string
 	Parameters map[string]*ParameterInfo
+
+	// Strict asks providers that support it (OpenAI-style "strict": true)
+	// to constrain the generated arguments to the schema. JSONSchema then
+	// follows the strict-mode rules.
+	Strict bool
+
+	// ReturnSchema optionally describes the shape of the result returned by
+	// Execute, e.g. an Object with its fields. The agent can send it with
+	// the observation (see ReactAgentConfig.IncludeReturnSchema) so the
+	// model knows how to read the result. It is not sent with the tool
+	// definition.
+	ReturnSchema *ParameterInfo
+}
+
+// Validate reports malformed metadata that would produce a broken schema: an
+// empty tool or parameter name, an unknown type, an array without ElemInfo
+// or an object without SubInfo, checked recursively.
+func (ti ToolInfo) Validate() error {
+	if ti.Name == "" {
+		return errors.New("tool name is required")
+	}
+	for key, p := range ti.Parameters {
+		if p == nil {
+			return fmt.Errorf("tool %q: parameter %q is nil", ti.Name, key)
+		}
+		if err := checkParam(p, fmt.Sprintf("tool %q parameter", ti.Name)); err != nil {
+			return err
+		}
+	}
+	if ti.ReturnSchema != nil {
+		if err := checkParam(ti.ReturnSchema, fmt.Sprintf("tool %q return schema", ti.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Tool defines the interface a tool must implement to expose its info.
+//
+// The context passed to Execute derives from the one given to the agent, so
+// it carries the run ID (see RunIDFromContext), deadlines and any tracing
+// values. Tools that call other services should pass it on to propagate the
+// trace end to end.
 type Tool interface {
 	Info() ToolInfo
 	Execute(ctx context.Context, params map[string]interface{}) (interface{}, error)
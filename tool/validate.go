@@ -0,0 +1,280 @@
+package tool
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ValidationError describes the first argument that does not match a tool's
+// parameters. Its message names the parameter, the expected type and an
+// example of a correct call, so it can be fed back to the model verbatim.
+type ValidationError struct {
+	Tool string
+	// Param is the path of the offending parameter, e.g. "filter.lang" or
+	// "tags[1]".
+	Param    string
+	Expected DataType
+	// Reason says what is wrong, e.g. "is required" or "got string".
+	Reason string
+	// Example is a JSON call with placeholder values derived from the
+	// ToolInfo; see ExampleCall.
+	Example string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid arguments for tool %q: parameter %q %s, expected %s; example of a valid call: %s",
+		e.Tool, e.Param, e.Reason, e.Expected, e.Example)
+}
+
+// MalformedArgsError reports tool-call arguments that are not a JSON object,
+// e.g. streamed arguments that were cut off before they were complete.
+type MalformedArgsError struct {
+	Tool string
+	Err  error
+	// Example is a valid call as rendered by ExampleCall, or "" when the
+	// tool's parameters are unknown.
+	Example string
+}
+
+func (e *MalformedArgsError) Error() string {
+	msg := fmt.Sprintf("invalid arguments for tool %q: arguments are not a valid JSON object (%v)", e.Tool, e.Err)
+	if e.Example != "" {
+		msg += "; example of a valid call: " + e.Example
+	}
+	return msg
+}
+
+func (e *MalformedArgsError) Unwrap() error {
+	return e.Err
+}
+
+// ParseRawArgs decodes the raw JSON arguments of a call to the tool described
+// by info, such as arguments assembled from stream deltas; "" decodes to nil.
+// It returns a *MalformedArgsError, with an example call when info has
+// parameters, if raw is not a JSON object. Check the result with
+// ValidateArgs before dispatching the call.
+func ParseRawArgs(info ToolInfo, raw string) (map[string]interface{}, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var args map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &args); err != nil {
+		e := &MalformedArgsError{Tool: info.Name, Err: err}
+		if len(info.Parameters) > 0 {
+			e.Example = ExampleCall(info)
+		}
+		return nil, e
+	}
+	return args, nil
+}
+
+// ValidateOption configures ValidateArgs.
+type ValidateOption func(*validator)
+
+// WithJSONStringCoercion makes ValidateArgs accept an object or array
+// parameter sent as a JSON string, as models often do, e.g.
+// {"filter":"{\"lang\":\"go\"}"}. The decoded value replaces the string in
+// args before it is checked, so the tool receives the structured value.
+func WithJSONStringCoercion(enabled bool) ValidateOption {
+	return func(v *validator) {
+		v.coerceJSON = enabled
+	}
+}
+
+type validator struct {
+	coerceJSON bool
+}
+
+// ValidateArgs checks decoded JSON arguments against the tool's parameters:
+// required parameters must be present and every known parameter must have
+// the declared type, recursively for objects and arrays. Unknown parameters
+// are allowed. It returns a *ValidationError for the first mismatch.
+func ValidateArgs(info ToolInfo, args map[string]interface{}, opts ...ValidateOption) error {
+	var vd validator
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&vd)
+		}
+	}
+	if param, expected, reason, ok := vd.checkFields(info.Parameters, args, ""); !ok {
+		return &ValidationError{Tool: info.Name, Param: param, Expected: expected, Reason: reason, Example: ExampleCall(info)}
+	}
+	return nil
+}
+
+// checkFields validates an object's fields in name order so the reported
+// parameter is deterministic.
+func (vd *validator) checkFields(params map[string]*ParameterInfo, args map[string]interface{}, prefix string) (string, DataType, string, bool) {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := params[name]
+		path := prefix + name
+		v, present := args[name]
+		if !present || v == nil {
+			if p.Required {
+				return path, p.Type, "is required", false
+			}
+			continue
+		}
+		if c, ok := vd.coerce(p, v); ok {
+			args[name], v = c, c
+		}
+		if param, expected, reason, ok := vd.checkValue(p, v, path); !ok {
+			return param, expected, reason, false
+		}
+	}
+	return "", 0, "", true
+}
+
+// coerce decodes a JSON string sent for an object or array parameter when
+// coercion is enabled. It reports false when v is left as it is.
+func (vd *validator) coerce(p *ParameterInfo, v interface{}) (interface{}, bool) {
+	s, isString := v.(string)
+	if !vd.coerceJSON || !isString || (p.Type != Object && p.Type != Array) {
+		return nil, false
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(s), &decoded); err != nil {
+		return nil, false
+	}
+	switch decoded.(type) {
+	case map[string]interface{}:
+		return decoded, p.Type == Object
+	case []interface{}:
+		return decoded, p.Type == Array
+	}
+	return nil, false
+}
+
+func (vd *validator) checkValue(p *ParameterInfo, v interface{}, path string) (string, DataType, string, bool) {
+	mismatch := func() (string, DataType, string, bool) {
+		return path, p.Type, "got " + jsonKind(v), false
+	}
+	switch p.Type {
+	case String:
+		if _, ok := v.(string); !ok {
+			return mismatch()
+		}
+	case Boolean:
+		if _, ok := v.(bool); !ok {
+			return mismatch()
+		}
+	case Number:
+		if _, ok := toFloat(v); !ok {
+			return mismatch()
+		}
+	case Integer:
+		f, ok := toFloat(v)
+		if !ok {
+			return mismatch()
+		}
+		if f != math.Trunc(f) {
+			return path, p.Type, fmt.Sprintf("got non-integer number %v", f), false
+		}
+	case Object:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		return vd.checkFields(p.SubInfo, obj, path+".")
+	case Array:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		if p.ElemInfo != nil {
+			for i, elem := range arr {
+				if c, ok := vd.coerce(p.ElemInfo, elem); ok {
+					arr[i], elem = c, c
+				}
+				if param, expected, reason, ok := vd.checkValue(p.ElemInfo, elem, fmt.Sprintf("%s[%d]", path, i)); !ok {
+					return param, expected, reason, false
+				}
+			}
+		}
+	}
+	return "", 0, "", true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonKind names the JSON type of a decoded value.
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, float32, int, int64, json.Number:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// ExampleCall renders a JSON call of the tool with a placeholder value for
+// every parameter, e.g. {"name":"search","arguments":{"q":"<q>"}}.
+func ExampleCall(info ToolInfo) string {
+	// 不转义 <>，让占位符对模型保持可读
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(map[string]interface{}{
+		"name":      info.Name,
+		"arguments": exampleFields(info.Parameters),
+	})
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func exampleFields(params map[string]*ParameterInfo) map[string]interface{} {
+	out := make(map[string]interface{}, len(params))
+	for name, p := range params {
+		out[name] = exampleValue(name, p)
+	}
+	return out
+}
+
+func exampleValue(name string, p *ParameterInfo) interface{} {
+	switch p.Type {
+	case Integer:
+		return 1
+	case Number:
+		return 1.5
+	case Boolean:
+		return true
+	case Object:
+		return exampleFields(p.SubInfo)
+	case Array:
+		if p.ElemInfo == nil {
+			return []interface{}{}
+		}
+		return []interface{}{exampleValue(name, p.ElemInfo)}
+	}
+	return "<" + name + ">"
+}
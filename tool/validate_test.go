@@ -0,0 +1,147 @@
+package tool_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reAct-agent/tool"
+	"strings"
+	"testing"
+)
+
+func searchInfo(t *testing.T) tool.ToolInfo {
+	t.Helper()
+	info, err := tool.NewToolInfo("search", "search documents").
+		AddString("q", "query text", true).
+		AddInteger("limit", "max results", false).
+		AddObject("filter", "optional filters", false,
+			tool.NewParam("lang", tool.String, "language code", true)).
+		AddArray("tags", "tags to match", false, tool.NewParam("tag", tool.String, "a tag", false)).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	return info
+}
+
+func TestValidateArgs(t *testing.T) {
+	info := searchInfo(t)
+	cases := map[string]struct {
+		args     string
+		param    string
+		expected tool.DataType
+	}{
+		"missing required": {`{"limit":3}`, "q", tool.String},
+		"wrong type":       {`{"q":42}`, "q", tool.String},
+		"non-integer":      {`{"q":"go","limit":2.5}`, "limit", tool.Integer},
+		"nested field":     {`{"q":"go","filter":{}}`, "filter.lang", tool.String},
+		"array element":    {`{"q":"go","tags":["a",1]}`, "tags[1]", tool.String},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var args map[string]interface{}
+			if err := json.Unmarshal([]byte(tc.args), &args); err != nil {
+				t.Fatal(err)
+			}
+			err := tool.ValidateArgs(info, args)
+			var verr *tool.ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected ValidationError, got %v", err)
+			}
+			if verr.Param != tc.param || verr.Expected != tc.expected {
+				t.Fatalf("got param %q expected %s, want %q %s", verr.Param, verr.Expected, tc.param, tc.expected)
+			}
+			msg := err.Error()
+			if !strings.Contains(msg, `"`+tc.param+`"`) || !strings.Contains(msg, tc.expected.String()) {
+				t.Fatalf("message should name the parameter and type: %s", msg)
+			}
+			if !strings.Contains(msg, verr.Example) {
+				t.Fatalf("message should include the example call: %s", msg)
+			}
+		})
+	}
+
+	if err := tool.ValidateArgs(info, map[string]interface{}{"q": "go", "limit": float64(3), "extra": 1}); err != nil {
+		t.Fatalf("valid arguments rejected: %v", err)
+	}
+}
+
+func TestValidateArgsCoercesJSONStrings(t *testing.T) {
+	info := searchInfo(t)
+	raw := `{"q":"go","filter":"{\"lang\":\"zh\"}","tags":"[\"a\",\"b\"]"}`
+	decode := func() map[string]interface{} {
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &args); err != nil {
+			t.Fatal(err)
+		}
+		return args
+	}
+
+	// 默认不转换，字符串化的对象按类型不符拒绝
+	var verr *tool.ValidationError
+	if err := tool.ValidateArgs(info, decode()); !errors.As(err, &verr) || verr.Param != "filter" {
+		t.Fatalf("expected filter to be rejected without coercion, got %v", err)
+	}
+
+	args := decode()
+	if err := tool.ValidateArgs(info, args, tool.WithJSONStringCoercion(true)); err != nil {
+		t.Fatalf("stringified arguments rejected: %v", err)
+	}
+	filter, ok := args["filter"].(map[string]interface{})
+	if !ok || filter["lang"] != "zh" {
+		t.Fatalf("filter should be replaced by the decoded object: %#v", args["filter"])
+	}
+	if tags, ok := args["tags"].([]interface{}); !ok || len(tags) != 2 {
+		t.Fatalf("tags should be replaced by the decoded array: %#v", args["tags"])
+	}
+
+	// 解析结果仍需通过校验；不是 JSON 的字符串保持原样
+	for _, bad := range []string{`{"q":"go","filter":"{}"}`, `{"q":"go","filter":"not json"}`, `{"q":"go","filter":"[1]"}`} {
+		var args map[string]interface{}
+		json.Unmarshal([]byte(bad), &args)
+		if err := tool.ValidateArgs(info, args, tool.WithJSONStringCoercion(true)); !errors.As(err, &verr) || !strings.HasPrefix(verr.Param, "filter") {
+			t.Fatalf("%s: expected a filter validation error, got %v", bad, err)
+		}
+	}
+}
+
+func TestParseRawArgs(t *testing.T) {
+	info := searchInfo(t)
+	args, err := tool.ParseRawArgs(info, `{"q":"go"}`)
+	if err != nil || args["q"] != "go" {
+		t.Fatalf("ParseRawArgs = %v, %v", args, err)
+	}
+	if args, err := tool.ParseRawArgs(info, ""); err != nil || args != nil {
+		t.Fatalf("empty arguments should decode to nil, got %v, %v", args, err)
+	}
+
+	_, err = tool.ParseRawArgs(info, `{"q":"g`)
+	var malformed *tool.MalformedArgsError
+	if !errors.As(err, &malformed) {
+		t.Fatalf("expected *MalformedArgsError, got %T: %v", err, err)
+	}
+	if malformed.Tool != "search" || !strings.Contains(err.Error(), tool.ExampleCall(info)) {
+		t.Fatalf("error should name the tool and show an example: %v", err)
+	}
+	// 参数未知的工具不附带示例
+	_, err = tool.ParseRawArgs(tool.ToolInfo{Name: "remote"}, `[1]`)
+	if !errors.As(err, &malformed) || malformed.Example != "" {
+		t.Fatalf("expected a *MalformedArgsError without example, got %v", err)
+	}
+}
+
+func TestExampleCallIsValid(t *testing.T) {
+	info := searchInfo(t)
+	var call struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	if err := json.Unmarshal([]byte(tool.ExampleCall(info)), &call); err != nil {
+		t.Fatalf("example is not valid JSON: %v", err)
+	}
+	if call.Name != "search" {
+		t.Fatalf("unexpected example name %q", call.Name)
+	}
+	if err := tool.ValidateArgs(info, call.Arguments); err != nil {
+		t.Fatalf("example call does not validate: %v", err)
+	}
+}
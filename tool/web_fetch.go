@@ -0,0 +1,274 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"net"
+	"net/netip"
+	"net/url"
+	httpclient "reAct-agent/http_client"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var _ Tool = (*WebFetchTool)(nil)
+
+// Extractor turns an HTML page into its title and readable text.
+type Extractor interface {
+	Extract(page []byte) (title, text string, err error)
+}
+
+// TagStripper is the default Extractor. It drops scripts, styles and
+// comments, removes the remaining tags, decodes entities and collapses
+// whitespace, keeping one line per block element. It does no boilerplate
+// detection; plug in a readability Extractor for cleaner article text.
+type TagStripper struct{}
+
+var (
+	titlePattern   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	hiddenPattern  = regexp.MustCompile(`(?is)<!--.*?-->|<(script|style|noscript|template|head)\b[^>]*>.*?</(script|style|noscript|template|head)>`)
+	blockPattern   = regexp.MustCompile(`(?i)</?(p|div|br|li|ul|ol|tr|table|h[1-6]|section|article|header|footer|blockquote|pre)\b[^>]*>`)
+	tagPattern     = regexp.MustCompile(`(?s)<[^>]*>`)
+	spacesPattern  = regexp.MustCompile(`[ \t\r\f\v\x{00a0}]+`)
+	newlinePattern = regexp.MustCompile(`\s*\n\s*`)
+)
+
+func (TagStripper) Extract(page []byte) (string, string, error) {
+	s := string(page)
+	var title string
+	if m := titlePattern.FindStringSubmatch(s); m != nil {
+		title = collapseSpaces(html.UnescapeString(tagPattern.ReplaceAllString(m[1], "")))
+	}
+	s = hiddenPattern.ReplaceAllString(s, " ")
+	s = blockPattern.ReplaceAllString(s, "\n")
+	s = tagPattern.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	s = spacesPattern.ReplaceAllString(s, " ")
+	s = newlinePattern.ReplaceAllString(s, "\n")
+	return title, strings.TrimSpace(s), nil
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// WebFetchTool GETs a web page and returns its title and readable text, cut
+// to MaxChars characters. Plain-text responses (text/*, JSON, XML) are
+// returned as they are; other content types, such as images or PDFs, are
+// reported as unsupported.
+//
+// As the model picks the URL, loopback, private and link-local addresses
+// (e.g. the 169.254.169.254 metadata service) are refused unless
+// WithFetchAllowPrivate is set. The default client checks the address it
+// dials, so host names and redirects resolving to them are refused too; it
+// connects directly, ignoring proxy settings. At most MaxBytes of the
+// response body are read.
+type WebFetchTool struct {
+	client       httpclient.IHTTPClient
+	extractor    Extractor
+	maxChars     int
+	maxBytes     int64
+	allowPrivate bool
+}
+
+// WebFetchOption configures a WebFetchTool.
+type WebFetchOption func(*WebFetchTool)
+
+// WithFetchHTTPClient sets the client used for the requests. The page URL is
+// passed with httpclient.WithRequestURL, so the client's own URL is ignored.
+// Only IP literals in the URL are checked then; the client must refuse
+// private addresses at dial time and cap response sizes itself.
+func WithFetchHTTPClient(client httpclient.IHTTPClient) WebFetchOption {
+	return func(t *WebFetchTool) {
+		t.client = client
+	}
+}
+
+// WithFetchExtractor replaces the default TagStripper.
+func WithFetchExtractor(e Extractor) WebFetchOption {
+	return func(t *WebFetchTool) {
+		t.extractor = e
+	}
+}
+
+// WithFetchMaxChars sets the maximum number of characters of text returned.
+func WithFetchMaxChars(n int) WebFetchOption {
+	return func(t *WebFetchTool) {
+		if n > 0 {
+			t.maxChars = n
+		}
+	}
+}
+
+// WithFetchMaxBytes sets the maximum number of bytes read from a response
+// body; the rest is discarded and the result marked truncated.
+func WithFetchMaxBytes(n int64) WebFetchOption {
+	return func(t *WebFetchTool) {
+		if n > 0 {
+			t.maxBytes = n
+		}
+	}
+}
+
+// WithFetchAllowPrivate allows fetching loopback, private and link-local
+// addresses, e.g. for an intranet agent or tests against a local server.
+func WithFetchAllowPrivate(allow bool) WebFetchOption {
+	return func(t *WebFetchTool) {
+		t.allowPrivate = allow
+	}
+}
+
+// NewWebFetchTool creates a WebFetchTool returning at most 8000 characters
+// of text extracted with TagStripper from at most 2MiB of response body,
+// and refusing private addresses, unless configured otherwise.
+func NewWebFetchTool(opts ...WebFetchOption) *WebFetchTool {
+	t := &WebFetchTool{extractor: TagStripper{}, maxChars: 8000, maxBytes: 2 << 20}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(t)
+		}
+	}
+	if t.client == nil {
+		transport := httpclient.NewTransport()
+		if !t.allowPrivate {
+			// 在建立连接时检查实际地址，域名解析与重定向都无法绕过；经代理时无法检查，故直连
+			transport.Proxy = nil
+			transport.DialContext = (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				Control:   refusePrivateAddr,
+			}).DialContext
+		}
+		t.client = httpclient.NewDefaultHTTPClient(
+			httpclient.WithTransport(transport),
+			httpclient.WithMaxResponseBytes(t.maxBytes),
+		)
+	}
+	return t
+}
+
+// errPrivateAddr is reported for URLs targeting a refused address.
+var errPrivateAddr = errors.New("不允许访问内网、回环或链路本地地址")
+
+// isPrivateAddr reports whether addr is loopback, private, link-local,
+// multicast or unspecified.
+func isPrivateAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified()
+}
+
+// refusePrivateAddr is a net.Dialer Control function refusing connections
+// to private addresses.
+func refusePrivateAddr(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errPrivateAddr, address)
+	}
+	if isPrivateAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", errPrivateAddr, addrPort.Addr())
+	}
+	return nil
+}
+
+func (t *WebFetchTool) Info() ToolInfo {
+	return ToolInfo{
+		Name: "web_fetch",
+		Desc: "获取网页内容，返回标题与提取出的正文文本",
+		Parameters: map[string]*ParameterInfo{
+			"url": {
+				Name:     "url",
+				Type:     String,
+				Desc:     "网页地址，需以 http:// 或 https:// 开头",
+				Required: true,
+			},
+		},
+	}
+}
+
+func (t *WebFetchTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	raw, _ := params["url"].(string)
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("url 参数错误，仅支持 http/https 地址")
+	}
+	// 自定义客户端无法在连接时检查，至少拒绝地址字面量
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !t.allowPrivate && isPrivateAddr(addr) {
+		return nil, fmt.Errorf("%w: %s", errPrivateAddr, addr)
+	}
+
+	ctx = httpclient.WithRequestURL(ctx, u.String())
+	ctx = httpclient.WithRequestHeaders(ctx, httpclient.HTTPHeader{
+		"Accept": "text/html,application/xhtml+xml,text/plain;q=0.9,*/*;q=0.8",
+	})
+	resp, err := t.client.Send(ctx, httpclient.HTTPMethodGET, nil)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("请求失败，状态码 %d", resp.StatusCode)
+	}
+
+	cut := resp.Truncated
+	if int64(len(resp.Body)) > t.maxBytes {
+		resp.Body, cut = resp.Body[:t.maxBytes], true
+	}
+
+	var title, text string
+	mediaType := contentType(resp)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		if title, text, err = t.extractor.Extract(resp.Body); err != nil {
+			return nil, fmt.Errorf("正文提取失败: %w", err)
+		}
+	case strings.HasPrefix(mediaType, "text/") || isTextual(mediaType):
+		text = strings.TrimSpace(string(resp.Body))
+	default:
+		return nil, fmt.Errorf("不支持的内容类型 %q", mediaType)
+	}
+
+	text, truncated := truncateRunes(text, t.maxChars)
+	return map[string]interface{}{
+		"url":          u.String(),
+		"title":        title,
+		"content_type": mediaType,
+		"text":         text,
+		"truncated":    truncated || cut,
+	}, nil
+}
+
+// contentType returns the media type of resp, sniffing HTML when the
+// server does not declare one.
+func contentType(resp *httpclient.HTTPResponse) string {
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		return strings.ToLower(mediaType)
+	}
+	head := strings.ToLower(strings.TrimSpace(string(resp.Body[:min(len(resp.Body), 512)])))
+	if strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html") {
+		return "text/html"
+	}
+	return "application/octet-stream"
+}
+
+func isTextual(mediaType string) bool {
+	return mediaType == "application/json" || mediaType == "application/xml" ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// truncateRunes cuts s to at most n characters.
+func truncateRunes(s string, n int) (string, bool) {
+	if len(s) <= n {
+		return s, false
+	}
+	r := []rune(s)
+	if len(r) <= n {
+		return s, false
+	}
+	return string(r[:n]), true
+}
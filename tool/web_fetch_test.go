@@ -0,0 +1,164 @@
+package tool_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reAct-agent/tool"
+	"strings"
+	"testing"
+)
+
+const samplePage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Go &amp; Agents</title>
+  <style>body { color: red; }</style>
+  <script>var tracking = "ignore me";</script>
+</head>
+<body>
+  <header><nav>Home | About</nav></header>
+  <article>
+    <h1>Building agents</h1>
+    <p>Agents call <b>tools</b> in a loop.</p>
+    <!-- hidden comment -->
+    <p>Observations &lt;feed&gt; the next step.</p>
+  </article>
+</body>
+</html>`
+
+func fetchServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(samplePage))
+		case "/data":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"answer":42}`))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G'})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func fetch(t *testing.T, wf *tool.WebFetchTool, url string) (map[string]interface{}, error) {
+	t.Helper()
+	out, err := wf.Execute(context.Background(), map[string]interface{}{"url": url})
+	if err != nil {
+		return nil, err
+	}
+	return out.(map[string]interface{}), nil
+}
+
+func TestWebFetchExtractsReadableText(t *testing.T) {
+	srv := fetchServer(t)
+	res, err := fetch(t, tool.NewWebFetchTool(tool.WithFetchAllowPrivate(true)), srv.URL+"/article")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if res["title"] != "Go & Agents" {
+		t.Fatalf("unexpected title %q", res["title"])
+	}
+	text := res["text"].(string)
+	for _, want := range []string{"Building agents", "Agents call tools in a loop.", "Observations <feed> the next step."} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("text missing %q:\n%s", want, text)
+		}
+	}
+	for _, unwanted := range []string{"tracking", "color", "hidden comment", "<p>"} {
+		if strings.Contains(text, unwanted) {
+			t.Fatalf("text should not contain %q:\n%s", unwanted, text)
+		}
+	}
+	if res["truncated"] != false {
+		t.Fatalf("short page should not be truncated")
+	}
+}
+
+func TestWebFetchTruncatesText(t *testing.T) {
+	srv := fetchServer(t)
+	res, err := fetch(t, tool.NewWebFetchTool(tool.WithFetchAllowPrivate(true), tool.WithFetchMaxChars(10)), srv.URL+"/article")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if text := res["text"].(string); len([]rune(text)) != 10 || res["truncated"] != true {
+		t.Fatalf("expected 10 characters and truncated, got %q, %v", text, res["truncated"])
+	}
+}
+
+func TestWebFetchContentTypes(t *testing.T) {
+	srv := fetchServer(t)
+	wf := tool.NewWebFetchTool(tool.WithFetchAllowPrivate(true))
+
+	res, err := fetch(t, wf, srv.URL+"/data")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if res["text"] != `{"answer":42}` || res["title"] != "" {
+		t.Fatalf("JSON should be returned as is: %v", res)
+	}
+	if _, err := fetch(t, wf, srv.URL+"/image"); err == nil || !strings.Contains(err.Error(), "image/png") {
+		t.Fatalf("expected an unsupported content type error, got %v", err)
+	}
+	if _, err := fetch(t, wf, srv.URL+"/missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected a status error, got %v", err)
+	}
+	if _, err := fetch(t, wf, "file:///etc/passwd"); err == nil {
+		t.Fatal("non-http URLs should be rejected")
+	}
+}
+
+func TestWebFetchRefusesPrivateAddresses(t *testing.T) {
+	srv := fetchServer(t)
+	wf := tool.NewWebFetchTool()
+
+	// 主机名在连接时解析为回环地址，同样被拒绝
+	local := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	for _, u := range []string{srv.URL + "/article", local + "/article", "http://169.254.169.254/latest/meta-data/", "http://[::1]/"} {
+		if _, err := fetch(t, wf, u); err == nil || !strings.Contains(err.Error(), "不允许访问") {
+			t.Fatalf("expected %s to be refused, got %v", u, err)
+		}
+	}
+}
+
+func TestWebFetchCapsBodyBytes(t *testing.T) {
+	srv := fetchServer(t)
+	res, err := fetch(t, tool.NewWebFetchTool(tool.WithFetchAllowPrivate(true), tool.WithFetchMaxBytes(64)), srv.URL+"/data")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if res["truncated"] != false {
+		t.Fatalf("a small body should not be truncated: %v", res)
+	}
+	res, err = fetch(t, tool.NewWebFetchTool(tool.WithFetchAllowPrivate(true), tool.WithFetchMaxBytes(8)), srv.URL+"/data")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if res["text"] != `{"answer` || res["truncated"] != true {
+		t.Fatalf("expected 8 bytes marked truncated, got %v", res)
+	}
+}
+
+type fixedExtractor struct{}
+
+func (fixedExtractor) Extract(page []byte) (string, string, error) {
+	return "custom", "EXTRACTED", nil
+}
+
+func TestWebFetchCustomExtractor(t *testing.T) {
+	srv := fetchServer(t)
+	res, err := fetch(t, tool.NewWebFetchTool(tool.WithFetchAllowPrivate(true), tool.WithFetchExtractor(fixedExtractor{})), srv.URL+"/article")
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if res["title"] != "custom" || res["text"] != "EXTRACTED" {
+		t.Fatalf("custom extractor not used: %v", res)
+	}
+}